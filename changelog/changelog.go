@@ -60,16 +60,56 @@ func partition(line, delim string) (string, string) {
 
 }
 
+// Distributions returns the list of distributions the entry was uploaded
+// to, such as `unstable`, or `stretch-security`.
+func (c ChangelogEntry) Distributions() []string {
+	return strings.Fields(c.Target)
+}
+
+// Urgency returns the urgency of the upload, such as `low` or `high`, or an
+// empty string if the header didn't set one.
+func (c ChangelogEntry) Urgency() string {
+	return c.Arguments["urgency"]
+}
+
+// lineReader keeps track of the line number while reading a changelog, so
+// that errors can tell the user where to look.
+type lineReader struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (l *lineReader) readLine() (string, error) {
+	line, err := l.reader.ReadString('\n')
+	if err == io.EOF && line != "" {
+		/* Missing the final newline; that's fine. */
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	l.line++
+	return line, nil
+}
+
+func (l *lineReader) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
 func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
+	return parseOne(&lineReader{reader: reader})
+}
+
+func parseOne(reader *lineReader) (*ChangelogEntry, error) {
 	changeLog := ChangelogEntry{}
 
 	var header string
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := reader.readLine()
 		if err != nil {
 			return nil, err
 		}
-		if line == "\n" {
+		if trim(line) == "" {
 			continue
 		}
 		if !strings.HasPrefix(line, " ") {
@@ -77,7 +117,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 			header = line
 			break
 		} else {
-			return nil, fmt.Errorf("Unexpected line: %s", line)
+			return nil, reader.errorf("Unexpected line: %s", trim(line))
 		}
 	}
 
@@ -96,7 +136,7 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	changeLog.Source = trim(source)
 	changeLog.Version, err = version.Parse(trim(versionString))
 	if err != nil {
-		return nil, err
+		return nil, reader.errorf("%v", err)
 	}
 	changeLog.Target = trim(suite)
 
@@ -110,12 +150,15 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	var signoff string
 	/* OK, we've got the header. Let's zip down. */
 	for {
-		line, err := reader.ReadString('\n')
+		line, err := reader.readLine()
+		if err == io.EOF {
+			return nil, reader.errorf("Reached EOF before the trailer line of %s", changeLog.Source)
+		}
 		if err != nil {
 			return nil, err
 		}
 		if !strings.HasPrefix(line, " ") && trim(line) != "" {
-			return nil, fmt.Errorf("Error! Didn't get ending line!")
+			return nil, reader.errorf("Didn't get ending line, got: %s", trim(line))
 		}
 
 		if strings.HasPrefix(line, " -- ") {
@@ -130,9 +173,12 @@ func ParseOne(reader *bufio.Reader) (*ChangelogEntry, error) {
 	_, signoff = partition(signoff, "--")  /* Get rid of the leading " -- " */
 	whom, when := partition(signoff, "  ") /* Split on the "  " */
 	changeLog.ChangedBy = trim(whom)
+	if changeLog.ChangedBy == "" || trim(when) == "" {
+		return nil, reader.errorf("Malformed trailer line: %s", trim(signoff))
+	}
 	changeLog.When, err = time.Parse(whenLayout, trim(when))
 	if err != nil {
-		return nil, fmt.Errorf("Failed parsing When %q: %v", when, err)
+		return nil, reader.errorf("Failed parsing When %q: %v", when, err)
 	}
 
 	return &changeLog, nil
@@ -148,11 +194,13 @@ func ParseFileOne(path string) (*ChangelogEntry, error) {
 	return ParseOne(bufio.NewReader(f))
 }
 
+// Parse all the entries of a changelog, such as `debian/changelog`. The
+// first entry is the most recent one.
 func Parse(reader io.Reader) (ChangelogEntries, error) {
-	stream := bufio.NewReader(reader)
+	stream := &lineReader{reader: bufio.NewReader(reader)}
 	ret := ChangelogEntries{}
 	for {
-		entry, err := ParseOne(stream)
+		entry, err := parseOne(stream)
 		if err == io.EOF {
 			break
 		}
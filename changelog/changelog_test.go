@@ -99,4 +99,37 @@ func TestChangelogEntries(t *testing.T) {
 	assert(t, len(changeLogs) == 2)
 }
 
+func TestChangelogEntryFields(t *testing.T) {
+	changeLogs, err := changelog.Parse(strings.NewReader(changeLog))
+	isok(t, err)
+	entry := changeLogs[0]
+	assert(t, entry.Source == "hello")
+	assert(t, entry.Version.String() == "2.10-1")
+	assert(t, len(entry.Distributions()) == 1)
+	assert(t, entry.Distributions()[0] == "unstable")
+	assert(t, entry.Urgency() == "low")
+	assert(t, strings.HasPrefix(entry.Changelog, "\n  * New upstream release.\n"))
+	assert(t, entry.When.Year() == 2015)
+	assert(t, changeLogs[1].When.Before(entry.When))
+}
+
+func TestChangelogNoTrailingNewline(t *testing.T) {
+	changeLogs, err := changelog.Parse(strings.NewReader(strings.TrimSuffix(changeLog, "\n")))
+	isok(t, err)
+	assert(t, len(changeLogs) == 2)
+}
+
+func TestChangelogBadTrailer(t *testing.T) {
+	_, err := changelog.Parse(strings.NewReader(strings.Replace(
+		changeLog, "Thu, 06 Nov 2014 12:03:40 +0100", "yesterday", 1,
+	)))
+	notok(t, err)
+	assert(t, strings.HasPrefix(err.Error(), "Line 23: "))
+
+	_, err = changelog.Parse(strings.NewReader(strings.Replace(
+		changeLog, "\n -- Santiago Vila <sanvila@debian.org>  Thu, 06 Nov 2014 12:03:40 +0100", "", 1,
+	)))
+	notok(t, err)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,211 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/version"
+)
+
+// {{{ Installed-Build-Depends entries
+
+// An InstalledPackage is a single entry of the Installed-Build-Depends
+// field of a .buildinfo, naming a package that was installed in the build
+// environment, and the exact version it was installed at, such as
+// `libc6:amd64 (= 2.28-10)`.
+type InstalledPackage struct {
+	Name    string
+	Arch    *dependency.Arch
+	Version version.Version
+}
+
+// Return the name of the package, including the architecture qualifier
+// if there is one, such as `libc6:amd64`.
+func (p InstalledPackage) Key() string {
+	if p.Arch == nil {
+		return p.Name
+	}
+	return p.Name + ":" + p.Arch.String()
+}
+
+func (p InstalledPackage) String() string {
+	return fmt.Sprintf("%s (= %s)", p.Key(), p.Version)
+}
+
+// InstalledPackages are the contents of the Installed-Build-Depends field
+// of a .buildinfo. Each entry has to be pinned to an exact version.
+type InstalledPackages []InstalledPackage
+
+func (p *InstalledPackages) UnmarshalControl(data string) error {
+	dep, err := dependency.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	ret := InstalledPackages{}
+	for _, relation := range dep.Relations {
+		if len(relation.Possibilities) != 1 {
+			return fmt.Errorf("Installed package '%s' has alternatives", relation)
+		}
+		possi := relation.Possibilities[0]
+		if possi.Version == nil || possi.Version.Operator != "=" {
+			return fmt.Errorf("Installed package '%s' isn't pinned to a version", relation)
+		}
+		ver, err := version.Parse(possi.Version.Number)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, InstalledPackage{
+			Name:    possi.Name,
+			Arch:    possi.Arch,
+			Version: ver,
+		})
+	}
+	*p = ret
+	return nil
+}
+
+func (p InstalledPackages) MarshalControl() (string, error) {
+	els := []string{}
+	for _, pkg := range p {
+		els = append(els, pkg.String())
+	}
+	return strings.Join(els, ",\n"), nil
+}
+
+// }}}
+
+// The BuildInfo struct represents a Debian .buildinfo file, which records
+// the environment a package was built in (most importantly, the exact
+// version of every package installed at the time), so that the build can
+// be reproduced later.
+type BuildInfo struct {
+	Paragraph
+
+	Filename string `control:"-"`
+
+	Format                string
+	Source                string
+	Binaries              []string          `control:"Binary" delim:" "`
+	Architectures         []dependency.Arch `control:"Architecture"`
+	Version               version.Version
+	ChecksumsMd5          []MD5FileHash     `control:"Checksums-Md5" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha1         []SHA1FileHash    `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256       []SHA256FileHash  `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha512       []SHA512FileHash  `control:"Checksums-Sha512" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	BuildOrigin           string            `control:"Build-Origin"`
+	BuildArchitecture     dependency.Arch   `control:"Build-Architecture"`
+	BuildDate             string            `control:"Build-Date"`
+	BuildPath             string            `control:"Build-Path"`
+	InstalledBuildDepends InstalledPackages `control:"Installed-Build-Depends" multiline:"true"`
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new BuildInfo struct, unless error is set to a value
+// other than nil.
+func ParseBuildInfoFile(path string) (*BuildInfo, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseBuildInfo(bufio.NewReader(f), path)
+}
+
+// Given a bufio.Reader, consume the Reader, and return a BuildInfo object
+// for use. Clearsigned .buildinfo files may be passed in as-is, although
+// the OpenPGP signature isn't checked.
+func ParseBuildInfo(reader *bufio.Reader, path string) (*BuildInfo, error) {
+	ret := &BuildInfo{Filename: path}
+	if err := Unmarshal(ret, reader); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// An InstalledChange is a difference between the Installed-Build-Depends
+// of two .buildinfo files, as returned by BuildInfo.DiffInstalled. Old is
+// nil if the package was only installed in the other build environment,
+// and New is nil if it was only installed in this one.
+type InstalledChange struct {
+	Package string
+	Old     *version.Version
+	New     *version.Version
+}
+
+// Compare the Installed-Build-Depends of this .buildinfo against other,
+// returning every package that was installed at a different version (or
+// only in one of the two), sorted by package. This is a good place to
+// start when looking for the cause of a build that isn't reproducible.
+func (b *BuildInfo) DiffInstalled(other *BuildInfo) []InstalledChange {
+	index := func(pkgs InstalledPackages) map[string]version.Version {
+		ret := map[string]version.Version{}
+		for _, pkg := range pkgs {
+			ret[pkg.Key()] = pkg.Version
+		}
+		return ret
+	}
+	before := index(b.InstalledBuildDepends)
+	after := index(other.InstalledBuildDepends)
+
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ret := []InstalledChange{}
+	for _, name := range names {
+		change := InstalledChange{Package: name}
+		if ver, ok := before[name]; ok {
+			change.Old = &ver
+		}
+		if ver, ok := after[name]; ok {
+			change.New = &ver
+		}
+		if change.Old != nil && change.New != nil &&
+			version.Compare(*change.Old, *change.New) == 0 {
+			continue
+		}
+		ret = append(ret, change)
+	}
+	return ret
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,130 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+// {{{ test .buildinfo file
+var buildInfoFile = `Format: 1.0
+Source: hello
+Binary: hello hello-doc
+Architecture: amd64 all
+Version: 1.0-1
+Checksums-Md5:
+ a2d5d1b5a1b8b36e4d8e6a4c09b8c6f1 1234 hello_1.0-1_amd64.deb
+Checksums-Sha256:
+ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 1234 hello_1.0-1_amd64.deb
+Build-Origin: Debian
+Build-Architecture: amd64
+Build-Date: Fri, 02 Jan 2015 03:04:05 +0000
+Build-Path: /build/hello-1.0
+Installed-Build-Depends:
+ autoconf (= 2.69-11),
+ automake (= 1:1.16.1-4),
+ libc6:amd64 (= 2.28-10)
+Environment:
+ DEB_BUILD_OPTIONS="parallel=4"
+`
+
+// }}}
+
+func TestBuildInfoParse(t *testing.T) {
+	info, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(buildInfoFile)), "")
+	isok(t, err)
+	assert(t, info.Source == "hello")
+	assert(t, strings.Join(info.Binaries, " ") == "hello hello-doc")
+	assert(t, len(info.Architectures) == 2)
+	assert(t, info.Version.String() == "1.0-1")
+	assert(t, len(info.ChecksumsMd5) == 1)
+	assert(t, info.ChecksumsSha256[0].Filename == "hello_1.0-1_amd64.deb")
+	assert(t, info.BuildOrigin == "Debian")
+	assert(t, info.BuildArchitecture.CPU == "amd64")
+	assert(t, info.BuildPath == "/build/hello-1.0")
+	assert(t, info.Values["Environment"] != "")
+
+	assert(t, len(info.InstalledBuildDepends) == 3)
+	assert(t, info.InstalledBuildDepends[0].Name == "autoconf")
+	assert(t, info.InstalledBuildDepends[1].Version.Epoch == 1)
+	assert(t, info.InstalledBuildDepends[2].Key() == "libc6:amd64")
+	assert(t, info.InstalledBuildDepends[2].String() == "libc6:amd64 (= 2.28-10)")
+
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, info))
+	assert(t, strings.Contains(out.String(), `Installed-Build-Depends:
+ autoconf (= 2.69-11),
+ automake (= 1:1.16.1-4),
+ libc6:amd64 (= 2.28-10)
+`))
+}
+
+func TestBuildInfoParseUnpinned(t *testing.T) {
+	_, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(`Source: hello
+Installed-Build-Depends: autoconf (>= 2.69)
+`)), "")
+	notok(t, err)
+
+	_, err = control.ParseBuildInfo(bufio.NewReader(strings.NewReader(`Source: hello
+Installed-Build-Depends: autoconf (= 2.69) | automake (= 1.16)
+`)), "")
+	notok(t, err)
+}
+
+func TestBuildInfoDiffInstalled(t *testing.T) {
+	old, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(buildInfoFile)), "")
+	isok(t, err)
+	other, err := control.ParseBuildInfo(bufio.NewReader(strings.NewReader(`Source: hello
+Installed-Build-Depends:
+ automake (= 1:1.16.1-4),
+ debhelper (= 12.1),
+ libc6:amd64 (= 2.29-1)
+`)), "")
+	isok(t, err)
+
+	changes := old.DiffInstalled(other)
+	assert(t, len(changes) == 3)
+
+	assert(t, changes[0].Package == "autoconf")
+	assert(t, changes[0].Old.String() == "2.69-11")
+	assert(t, changes[0].New == nil)
+
+	assert(t, changes[1].Package == "debhelper")
+	assert(t, changes[1].Old == nil)
+	assert(t, changes[1].New.String() == "12.1")
+
+	assert(t, changes[2].Package == "libc6:amd64")
+	assert(t, changes[2].Old.String() == "2.28-10")
+	assert(t, changes[2].New.String() == "2.29-1")
+
+	assert(t, len(old.DiffInstalled(old)) == 0)
+}
+
+// vim: foldmethod=marker
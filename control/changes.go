@@ -22,16 +22,21 @@ package control
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cinello/go-debian/dependency"
 	"github.com/cinello/go-debian/internal"
 	"github.com/cinello/go-debian/version"
+
+	"golang.org/x/crypto/openpgp"
 )
 
 // {{{ .changes Files list entries
@@ -46,8 +51,8 @@ type FileListChangesFileHash struct {
 func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 	var err error
 	c.Algorithm = "md5"
-	vals := strings.Split(data, " ")
-	if len(vals) < 5 {
+	vals := strings.Fields(data)
+	if len(vals) != 5 {
 		return fmt.Errorf("Error: Unknown File List Hash line: '%s'", data)
 	}
 
@@ -63,6 +68,19 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 	return nil
 }
 
+// Write the Files line out, with a `-` in place of a missing Component or
+// Priority, as dpkg-genchanges does, so that there are always five fields.
+func (c FileListChangesFileHash) MarshalControl() (string, error) {
+	return fmt.Sprintf("%s %d %s %s %s", c.Hash, c.Size, orDash(c.Component), orDash(c.Priority), c.Filename), nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
 // }}}
 
 // The Changes struct is the default encapsulation of the Debian .changes
@@ -77,9 +95,10 @@ func (c *FileListChangesFileHash) UnmarshalControl(data string) error {
 type Changes struct {
 	Paragraph
 
-	Filename string
+	Filename string `control:"-"`
 
 	Format          string
+	Date            string
 	Source          string
 	Binaries        []string          `control:"Binary" delim:" "`
 	Architectures   []dependency.Arch `control:"Architecture"`
@@ -89,11 +108,13 @@ type Changes struct {
 	Urgency         string
 	Maintainer      string
 	ChangedBy       string `control:"Changed-By"`
-	Closes          []string
+	Description     string `multiline:"true"`
+	Closes          []int  `delim:" "`
 	Changes         string
-	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t "`
+	ChecksumsSha1   []SHA1FileHash            `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash          `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha512 []SHA512FileHash          `control:"Checksums-Sha512" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []FileListChangesFileHash `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
 }
 
 // Given a path on the filesystem, Parse the file off the disk and return
@@ -124,6 +145,22 @@ func ParseChanges(reader *bufio.Reader, path string) (*Changes, error) {
 	return ret, Unmarshal(ret, reader)
 }
 
+// Given a bufio.Reader, consume the Reader, check the OpenPGP clearsignature
+// around the .changes against the given keyring, and return the Changes
+// object along with the Entity that signed it, and the exact bytes the
+// signature covered (with the dash-escaping already undone).
+//
+// As with ParseDscSigned, ErrNotSigned is returned if the .changes is not
+// signed at all.
+func ParseChangesSigned(reader *bufio.Reader, keyring openpgp.KeyRing, path string) (*Changes, *openpgp.Entity, []byte, error) {
+	ret := &Changes{Filename: path}
+	signer, signed, err := decodeSigned(reader, keyring, ret)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ret, signer, signed, nil
+}
+
 // Return a list of FileListChangesFileHash entries from the `changes.Files`
 // entry, with the exception that each `Filename` will be joined to the root
 // directory of the Changes file.
@@ -139,6 +176,40 @@ func (changes *Changes) AbsFiles() []FileListChangesFileHash {
 	return ret
 }
 
+// Validate the files referenced by the .changes, making sure they exist
+// next to the .changes, and that their sizes and hashes match those listed
+// in the Files and Checksums-* fields, using the same rules as
+// DSC.Validate.
+func (changes *Changes) Validate() error {
+	return changes.ValidateContext(context.Background())
+}
+
+// ValidateContext behaves like Validate, but stops hashing as soon as ctx
+// is cancelled, as with DSC.ValidateContext.
+func (changes *Changes) ValidateContext(ctx context.Context) error {
+	return validateChecksums(ctx, changes.Filename, []checksumSection{
+		{"Files", "md5", checksumsOf(changes.Files)},
+		{"Checksums-Sha1", "sha1", checksumsOf(changes.ChecksumsSha1)},
+		{"Checksums-Sha256", "sha256", checksumsOf(changes.ChecksumsSha256)},
+		{"Checksums-Sha512", "sha512", checksumsOf(changes.ChecksumsSha512)},
+	})
+}
+
+// Reject a .changes that lists the same architecture (including `source`)
+// more than once. This is called by Unmarshal once the .changes has been
+// read in.
+func (changes *Changes) ValidateControl() error {
+	return checkDuplicateArchs(changes.Architectures)
+}
+
+// Return every entry of the Files and Checksums-* fields, in that order.
+func (changes *Changes) Checksums() []Checksum {
+	ret := checksumsOf(changes.Files)
+	ret = append(ret, checksumsOf(changes.ChecksumsSha1)...)
+	ret = append(ret, checksumsOf(changes.ChecksumsSha256)...)
+	return append(ret, checksumsOf(changes.ChecksumsSha512)...)
+}
+
 // Return a DSC struct for the DSC listed in the .changes file. This requires
 // Changes.Filename to be correctly set, and for the .dsc file to exist
 // in the correct place next to the .changes.
@@ -191,6 +262,8 @@ func (changes *Changes) Copy(dest string) error {
 // Move the .changes file and all referenced files to the directory
 // listed by the dest argument. This function will error out if the dest
 // argument is not a directory, or if there is an IO operation in transfer.
+// If dest is on another filesystem, files are copied (preserving mode and
+// modification time) and the originals removed.
 //
 // This function will always move .changes last, making it suitable to
 // be used to move something into an incoming directory with an inotify
@@ -202,14 +275,14 @@ func (changes *Changes) Move(dest string) error {
 
 	for _, file := range changes.AbsFiles() {
 		dirname := filepath.Base(file.Filename)
-		err := os.Rename(file.Filename, dest+"/"+dirname)
+		err := internal.Move(file.Filename, dest+"/"+dirname)
 		if err != nil {
 			return err
 		}
 	}
 
 	dirname := filepath.Base(changes.Filename)
-	err := os.Rename(changes.Filename, dest+"/"+dirname)
+	err := internal.Move(changes.Filename, dest+"/"+dirname)
 	changes.Filename = dest + "/" + dirname
 	return err
 }
@@ -227,4 +300,302 @@ func (changes *Changes) Remove() error {
 	return os.Remove(changes.Filename)
 }
 
+// {{{ splitting a .changes by architecture
+
+// Return the architecture a file listed in a .changes is for, going by its
+// name. Binary packages and .buildinfo files end in `_arch`, and everything
+// else is part of the source.
+func changesFileArch(filename string) string {
+	ext := filepath.Ext(filename)
+	switch ext {
+	case ".deb", ".udeb", ".ddeb", ".buildinfo":
+		base := strings.TrimSuffix(filename, ext)
+		if i := strings.LastIndex(base, "_"); i >= 0 {
+			return base[i+1:]
+		}
+	}
+	return "source"
+}
+
+// Split the .changes into one Changes per architecture in the upload
+// (including `all`), each listing only the files built for that
+// architecture, along with the source files, if this is a sourceful upload.
+// The Architecture, Binary, Description, Files and Checksums-* fields of
+// each are narrowed down to match. A source-only upload comes back as a
+// single Changes for the `source` architecture.
+//
+// The Filename of each Changes is left as-is, so that AbsFiles still points
+// at the files next to the original .changes.
+func (changes *Changes) SplitByArch() map[dependency.Arch]*Changes {
+	files := map[string][]string{}
+	for _, file := range changes.Files {
+		arch := changesFileArch(file.Filename)
+		files[arch] = append(files[arch], file.Filename)
+	}
+
+	var source *dependency.Arch
+	arches := map[string]dependency.Arch{}
+	for _, arch := range changes.Architectures {
+		if arch.IsSource() {
+			sourceArch := arch
+			source = &sourceArch
+			continue
+		}
+		/* Files are named after the arch in lower case */
+		arches[strings.ToLower(arch.String())] = arch
+	}
+	for name := range files {
+		if _, found := arches[name]; found || name == "source" {
+			continue
+		}
+		if arch, err := dependency.ParseArch(name); err == nil {
+			arches[name] = *arch
+		}
+	}
+	if source == nil && len(files["source"]) > 0 {
+		source, _ = dependency.ParseArch("source")
+	}
+
+	ret := map[dependency.Arch]*Changes{}
+	if len(arches) == 0 && source != nil {
+		ret[*source] = changes.narrowed(files["source"], []dependency.Arch{*source})
+		return ret
+	}
+
+	for name, arch := range arches {
+		narrowedArches := []dependency.Arch{arch}
+		if source != nil {
+			narrowedArches = []dependency.Arch{*source, arch}
+		}
+		narrowedFiles := append(append([]string{}, files["source"]...), files[name]...)
+		ret[arch] = changes.narrowed(narrowedFiles, narrowedArches)
+	}
+	return ret
+}
+
+// Return a copy of the Changes with only the given files, and the given
+// Architectures, keeping only the binaries that have one of those files.
+func (changes *Changes) narrowed(filenames []string, arches []dependency.Arch) *Changes {
+	ret := *changes
+	ret.Paragraph = Paragraph{
+		Order:    append([]string{}, changes.Order...),
+		Values:   map[string]string{},
+		Comments: append([]Comment{}, changes.Comments...),
+	}
+	for key, value := range changes.Values {
+		ret.Values[key] = value
+	}
+	ret.Architectures = arches
+
+	included := map[string]bool{}
+	packages := map[string]bool{}
+	for _, filename := range filenames {
+		included[filename] = true
+		if changesFileArch(filename) != "source" && !strings.HasSuffix(filename, ".buildinfo") {
+			packages[strings.SplitN(filename, "_", 2)[0]] = true
+		}
+	}
+
+	ret.Binaries = []string{}
+	for _, binary := range changes.Binaries {
+		if packages[binary] {
+			ret.Binaries = append(ret.Binaries, binary)
+		}
+	}
+
+	descriptions := []string{}
+	for _, line := range strings.Split(changes.Description, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && packages[fields[0]] {
+			descriptions = append(descriptions, line)
+		}
+	}
+	ret.Description = ""
+	if len(descriptions) > 0 {
+		ret.Description = strings.Join(descriptions, "\n") + "\n"
+	}
+
+	ret.Files = []FileListChangesFileHash{}
+	for _, file := range changes.Files {
+		if included[file.Filename] {
+			ret.Files = append(ret.Files, file)
+		}
+	}
+	ret.ChecksumsSha1 = []SHA1FileHash{}
+	for _, file := range changes.ChecksumsSha1 {
+		if included[file.Filename] {
+			ret.ChecksumsSha1 = append(ret.ChecksumsSha1, file)
+		}
+	}
+	ret.ChecksumsSha256 = []SHA256FileHash{}
+	for _, file := range changes.ChecksumsSha256 {
+		if included[file.Filename] {
+			ret.ChecksumsSha256 = append(ret.ChecksumsSha256, file)
+		}
+	}
+	ret.ChecksumsSha512 = []SHA512FileHash{}
+	for _, file := range changes.ChecksumsSha512 {
+		if included[file.Filename] {
+			ret.ChecksumsSha512 = append(ret.ChecksumsSha512, file)
+		}
+	}
+	return &ret
+}
+
+// }}}
+
+// {{{ .changes builder
+
+// A ChangesBuilder assembles a Changes from a set of built artifacts, such
+// as the .dsc, .deb and .buildinfo files of an upload, taking care of the
+// hashes, the Binary and Architecture fields, and the Description.
+type ChangesBuilder struct {
+	changes      Changes
+	date         time.Time
+	sourceUpload bool
+	binaries     map[string]string
+	archs        map[string]dependency.Arch
+}
+
+// Create a new, empty ChangesBuilder.
+func NewChangesBuilder() *ChangesBuilder {
+	return &ChangesBuilder{
+		binaries: map[string]string{},
+		archs:    map[string]dependency.Arch{},
+	}
+}
+
+// Set the Source field of the .changes.
+func (b *ChangesBuilder) SetSource(source string) {
+	b.changes.Source = source
+}
+
+// Set the Version field of the .changes.
+func (b *ChangesBuilder) SetVersion(version version.Version) {
+	b.changes.Version = version
+}
+
+// Set the Distribution field of the .changes.
+func (b *ChangesBuilder) SetDistribution(distribution string) {
+	b.changes.Distribution = distribution
+}
+
+// Set the Urgency field of the .changes.
+func (b *ChangesBuilder) SetUrgency(urgency string) {
+	b.changes.Urgency = urgency
+}
+
+// Set the Maintainer field of the .changes.
+func (b *ChangesBuilder) SetMaintainer(maintainer string) {
+	b.changes.Maintainer = maintainer
+}
+
+// Set the Date of the .changes. If this is never called, Build uses the
+// time it was called at.
+func (b *ChangesBuilder) SetDate(date time.Time) {
+	b.date = date
+}
+
+// Hash the file at path, and list it in the .changes with the given section
+// and priority, either of which may be empty, in which case it's listed as
+// `-`. A .dsc file marks the upload as containing source, adding "source"
+// to the Architecture field.
+func (b *ChangesBuilder) AddFile(path, section, priority string) error {
+	md5, sha1, sha256, err := HashFile(path)
+	if err != nil {
+		return err
+	}
+
+	b.changes.Files = append(b.changes.Files, FileListChangesFileHash{
+		FileHash:  md5.FileHash,
+		Component: orDash(section),
+		Priority:  orDash(priority),
+	})
+	b.changes.ChecksumsSha1 = append(b.changes.ChecksumsSha1, sha1)
+	b.changes.ChecksumsSha256 = append(b.changes.ChecksumsSha256, sha256)
+
+	if strings.HasSuffix(path, ".dsc") {
+		b.sourceUpload = true
+	}
+	return nil
+}
+
+// Hash the binary package at path and list it in the .changes, using the
+// Section and Priority of the given control data. The package is added to
+// the Binary field, its Architecture to the Architecture field, and the
+// first line of its Description to the Description field.
+func (b *ChangesBuilder) AddBinary(path string, binary BinaryIndex) error {
+	if binary.Package == "" {
+		return fmt.Errorf("No Package given for %s", path)
+	}
+	if err := b.AddFile(path, string(binary.Section), string(binary.Priority)); err != nil {
+		return err
+	}
+
+	summary := strings.TrimSpace(strings.SplitN(binary.Description, "\n", 2)[0])
+	b.binaries[binary.Package] = summary
+	b.archs[binary.Architecture.String()] = binary.Architecture
+	return nil
+}
+
+// Assemble the Changes. This will error out if the Source or Version were
+// never set, or if no files were added.
+func (b *ChangesBuilder) Build() (*Changes, error) {
+	if b.changes.Source == "" {
+		return nil, fmt.Errorf("No Source set for the .changes")
+	}
+	if b.changes.Version.Version == "" {
+		return nil, fmt.Errorf("No Version set for the .changes")
+	}
+	if len(b.changes.Files) == 0 {
+		return nil, fmt.Errorf("No files added to the .changes")
+	}
+
+	ret := b.changes
+	ret.Format = "1.8"
+
+	date := b.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	ret.Date = date.Format(time.RFC1123Z)
+
+	ret.Architectures = []dependency.Arch{}
+	if b.sourceUpload {
+		source, err := dependency.ParseArch("source")
+		if err != nil {
+			return nil, err
+		}
+		ret.Architectures = append(ret.Architectures, *source)
+	}
+	archs := []string{}
+	for name := range b.archs {
+		archs = append(archs, name)
+	}
+	sort.Strings(archs)
+	for _, name := range archs {
+		ret.Architectures = append(ret.Architectures, b.archs[name])
+	}
+
+	ret.Binaries = []string{}
+	for name := range b.binaries {
+		ret.Binaries = append(ret.Binaries, name)
+	}
+	sort.Strings(ret.Binaries)
+
+	if len(ret.Binaries) != 0 {
+		descriptions := []string{}
+		for _, name := range ret.Binaries {
+			descriptions = append(descriptions, name+" - "+b.binaries[name])
+		}
+		ret.Description = strings.Join(descriptions, "\n") + "\n"
+	}
+
+	ret.Files = append([]FileListChangesFileHash{}, b.changes.Files...)
+	ret.ChecksumsSha1 = append([]SHA1FileHash{}, b.changes.ChecksumsSha1...)
+	ret.ChecksumsSha256 = append([]SHA256FileHash{}, b.changes.ChecksumsSha256...)
+	return &ret, nil
+}
+
+// }}}
+
 // vim: foldmethod=marker
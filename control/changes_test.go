@@ -22,10 +22,24 @@ package control_test
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cinello/go-debian/control"
+	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/version"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
 )
 
 /*
@@ -77,12 +91,13 @@ Files:
 	changes, err := control.ParseChanges(reader, "")
 	isok(t, err)
 	assert(t, changes.Format == "1.8")
+	assert(t, changes.Date == "Wed, 29 Apr 2015 21:29:13 -0400")
 	assert(t, changes.ChangedBy == "Paul Tagliamonte <paultag@debian.org>")
 	assert(t, len(changes.Binaries) == 3)
 	assert(t, changes.Binaries[2] == "dput-ng-doc")
 
 	assert(t, len(changes.Closes) == 1)
-	assert(t, changes.Closes[0] == "783746")
+	assert(t, changes.Closes[0] == 783746)
 }
 
 func TestChangesParseFiles(t *testing.T) {
@@ -135,4 +150,319 @@ Files:
 	assert(t, len(changes.Files) == 2)
 }
 
+func TestChangesValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-changes")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	md5s, sha1s, sha256s := "", "", ""
+	for name, content := range map[string]string{
+		"hello_1.0-1.dsc":           "dsc",
+		"hello_1.0-1_amd64.deb":     "binary",
+		"hello_1.0-1.debian.tar.xz": "packaging",
+	} {
+		isok(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		md5s += fmt.Sprintf(" %x %d devel optional %s\n", md5.Sum([]byte(content)), len(content), name)
+		sha1s += fmt.Sprintf(" %x %d %s\n", sha1.Sum([]byte(content)), len(content), name)
+		sha256s += fmt.Sprintf(" %x %d %s\n", sha256.Sum256([]byte(content)), len(content), name)
+	}
+	changesPath := filepath.Join(dir, "hello_1.0-1_amd64.changes")
+	isok(t, ioutil.WriteFile(changesPath, []byte(`Format: 1.8
+Source: hello
+Version: 1.0-1
+Checksums-Sha1:
+`+sha1s+`Checksums-Sha256:
+`+sha256s+`Files:
+`+md5s), 0644))
+
+	changes, err := control.ParseChangesFile(changesPath)
+	isok(t, err)
+	isok(t, changes.Validate())
+
+	isok(t, ioutil.WriteFile(filepath.Join(dir, "hello_1.0-1_amd64.deb"), []byte("BINARY"), 0644))
+	err = changes.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "hello_1.0-1_amd64.deb"))
+
+	isok(t, os.Remove(filepath.Join(dir, "hello_1.0-1_amd64.deb")))
+	err = changes.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "missing"))
+}
+
+func TestChangesCloses(t *testing.T) {
+	changes, err := control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Closes: 123456  654321 42
+`)), "")
+	isok(t, err)
+	assert(t, len(changes.Closes) == 3)
+	assert(t, changes.Closes[1] == 654321)
+	assert(t, changes.Closes[2] == 42)
+
+	changes, err = control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Closes:
+`)), "")
+	isok(t, err)
+	assert(t, changes.Closes == nil)
+
+	_, err = control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Closes: 123456 #654321
+`)), "")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "'#654321'"))
+}
+
+func TestChangesParseSigned(t *testing.T) {
+	input := "Source: hello\nVersion: 1.0-1\n"
+	signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	isok(t, err)
+
+	signed := bytes.Buffer{}
+	w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+	isok(t, err)
+	_, err = w.Write([]byte(input))
+	isok(t, err)
+	isok(t, w.Close())
+
+	changes, entity, data, err := control.ParseChangesSigned(
+		bufio.NewReader(bytes.NewReader(signed.Bytes())),
+		openpgp.EntityList{signer}, "",
+	)
+	isok(t, err)
+	assert(t, changes.Source == "hello")
+	assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+	assert(t, strings.Contains(string(data), "Version: 1.0-1"))
+
+	_, _, _, err = control.ParseChangesSigned(
+		bufio.NewReader(strings.NewReader(input)),
+		openpgp.EntityList{signer}, "",
+	)
+	assert(t, err == control.ErrNotSigned)
+}
+
+func TestChangesBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-changes")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		isok(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	builder := control.NewChangesBuilder()
+	_, err = builder.Build()
+	notok(t, err)
+
+	builder.SetSource("hello")
+	ver, err := version.Parse("1.0-1")
+	isok(t, err)
+	builder.SetVersion(ver)
+	builder.SetDistribution("unstable")
+	builder.SetUrgency("medium")
+	builder.SetMaintainer("Paul Tagliamonte <paultag@debian.org>")
+	builder.SetDate(time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	_, err = builder.Build()
+	notok(t, err)
+
+	isok(t, builder.AddFile(write("hello_1.0-1.dsc", "dsc"), "misc", "optional"))
+	isok(t, builder.AddFile(write("hello_1.0-1_amd64.buildinfo", "buildinfo"), "misc", "optional"))
+	notok(t, builder.AddFile(filepath.Join(dir, "missing.deb"), "misc", "optional"))
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	all, err := dependency.ParseArch("all")
+	isok(t, err)
+
+	isok(t, builder.AddBinary(write("hello_1.0-1_amd64.deb", "deb"), control.BinaryIndex{
+		Package:      "hello",
+		Architecture: *amd64,
+		Section:      "devel",
+		Priority:     "optional",
+		Description:  "example package\n Longer description.",
+	}))
+	isok(t, builder.AddBinary(write("hello-doc_1.0-1_all.deb", "doc"), control.BinaryIndex{
+		Package:      "hello-doc",
+		Architecture: *all,
+		Section:      "doc",
+		Priority:     "optional",
+		Description:  "documentation for hello",
+	}))
+	notok(t, builder.AddBinary(write("nameless.deb", ""), control.BinaryIndex{}))
+
+	changes, err := builder.Build()
+	isok(t, err)
+	assert(t, changes.Format == "1.8")
+	assert(t, changes.Date == "Fri, 02 Jan 2015 03:04:05 +0000")
+	assert(t, changes.Source == "hello")
+	assert(t, changes.Distribution == "unstable")
+	assert(t, strings.Join(changes.Binaries, " ") == "hello hello-doc")
+	assert(t, len(changes.Architectures) == 3)
+	assert(t, changes.Architectures[0].String() == "source")
+	assert(t, changes.Architectures[1].String() == "all")
+	assert(t, changes.Architectures[2].String() == "amd64")
+	assert(t, changes.Description == "hello - example package\nhello-doc - documentation for hello\n")
+	assert(t, len(changes.Files) == 4)
+	assert(t, len(changes.ChecksumsSha256) == 4)
+	assert(t, changes.Files[2].Component == "devel")
+	assert(t, changes.Files[2].Filename == "hello_1.0-1_amd64.deb")
+
+	changes.Filename = filepath.Join(dir, "hello_1.0-1_amd64.changes")
+	isok(t, changes.Validate())
+
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, changes))
+	assert(t, strings.Contains(out.String(), "Architecture: source all amd64\n"))
+	assert(t, strings.Contains(out.String(), "Description:\n hello - example package\n hello-doc - documentation for hello\n"))
+
+	parsed, err := control.ParseChanges(bufio.NewReader(&out), changes.Filename)
+	isok(t, err)
+	assert(t, parsed.Description == changes.Description)
+	isok(t, parsed.Validate())
+}
+
+func TestChangesBuilderRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-changes")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hello_1.0-1.dsc")
+	isok(t, ioutil.WriteFile(path, []byte("dsc"), 0644))
+
+	builder := control.NewChangesBuilder()
+	builder.SetSource("hello")
+	ver, err := version.Parse("1.0-1")
+	isok(t, err)
+	builder.SetVersion(ver)
+	isok(t, builder.AddFile(path, "", ""))
+
+	changes, err := builder.Build()
+	isok(t, err)
+	changes.Filename = filepath.Join(dir, "hello_1.0-1_source.changes")
+
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, changes))
+	assert(t, strings.Contains(out.String(), " 3 - - hello_1.0-1.dsc\n"))
+
+	parsed, err := control.ParseChanges(bufio.NewReader(&out), changes.Filename)
+	isok(t, err)
+	assert(t, len(parsed.Files) == 1)
+	assert(t, parsed.Files[0].Component == "-")
+	assert(t, parsed.Files[0].Priority == "-")
+	assert(t, parsed.Files[0].Filename == "hello_1.0-1.dsc")
+	isok(t, parsed.Validate())
+}
+
+func TestChangesSplitByArch(t *testing.T) {
+	// Test Paragraph {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 1.8
+Source: hello
+Binary: hello hello-doc
+Architecture: source amd64 arm64 all
+Version: 1.0-1
+Distribution: unstable
+Maintainer: Paul Tagliamonte <paultag@debian.org>
+Description:
+ hello      - example package
+ hello-doc  - example package (documentation)
+Checksums-Sha256:
+ 2489ed1a2e052ccc4c321719a2394ac4b6958209f05b1531305d2a52173aa5c1 1131 hello_1.0-1.dsc
+ 5ef401d9b67b009443f249aa79b952839c69a2b5437fbe957832599b655e1df0 82504 hello_1.0.orig.tar.gz
+ 1111111111111111111111111111111111111111111111111111111111111111 2000 hello_1.0-1_amd64.deb
+ 2222222222222222222222222222222222222222222222222222222222222222 2001 hello_1.0-1_arm64.deb
+ 3333333333333333333333333333333333333333333333333333333333333333 2002 hello-doc_1.0-1_all.deb
+ 4444444444444444444444444444444444444444444444444444444444444444 2003 hello_1.0-1_amd64.buildinfo
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c 1131 devel optional hello_1.0-1.dsc
+ 67e67e85a267c0c8110001b1a6cfc293 82504 devel optional hello_1.0.orig.tar.gz
+ 11111111111111111111111111111111 2000 devel optional hello_1.0-1_amd64.deb
+ 22222222222222222222222222222222 2001 devel optional hello_1.0-1_arm64.deb
+ 33333333333333333333333333333333 2002 doc optional hello-doc_1.0-1_all.deb
+ 44444444444444444444444444444444 2003 devel optional hello_1.0-1_amd64.buildinfo
+`))
+	// }}}
+	changes, err := control.ParseChanges(reader, "")
+	isok(t, err)
+
+	split := changes.SplitByArch()
+	assert(t, len(split) == 3)
+
+	byName := map[string]*control.Changes{}
+	for arch, c := range split {
+		byName[arch.String()] = c
+	}
+
+	amd64 := byName["amd64"]
+	assert(t, amd64 != nil)
+	assert(t, len(amd64.Architectures) == 2)
+	assert(t, amd64.Architectures[0].String() == "source")
+	assert(t, amd64.Architectures[1].String() == "amd64")
+	assert(t, len(amd64.Files) == 4)
+	assert(t, len(amd64.ChecksumsSha256) == 4)
+	for i, file := range amd64.Files {
+		assert(t, file.Filename == amd64.ChecksumsSha256[i].Filename)
+	}
+	assert(t, len(amd64.Binaries) == 1 && amd64.Binaries[0] == "hello")
+	assert(t, strings.Contains(amd64.Description, "hello      - example package"))
+	assert(t, !strings.Contains(amd64.Description, "hello-doc"))
+
+	all := byName["all"]
+	assert(t, all != nil)
+	assert(t, len(all.Files) == 3)
+	assert(t, all.Files[2].Filename == "hello-doc_1.0-1_all.deb")
+	assert(t, len(all.Binaries) == 1 && all.Binaries[0] == "hello-doc")
+
+	arm64 := byName["arm64"]
+	assert(t, arm64 != nil)
+	assert(t, len(arm64.Files) == 3)
+
+	/* The original is left alone */
+	assert(t, len(changes.Files) == 6)
+	assert(t, len(changes.Binaries) == 2)
+
+	buf := bytes.Buffer{}
+	isok(t, control.Marshal(&buf, arm64))
+	assert(t, strings.Contains(buf.String(), "Architecture: source arm64\n"))
+	assert(t, strings.Contains(buf.String(), "Binary: hello\n"))
+	assert(t, !strings.Contains(buf.String(), "amd64"))
+}
+
+func TestChangesSplitByArchSourceOnly(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Format: 1.8
+Source: hello
+Architecture: source
+Version: 1.0-1
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c 1131 devel optional hello_1.0-1.dsc
+ 67e67e85a267c0c8110001b1a6cfc293 82504 devel optional hello_1.0.orig.tar.gz
+`))
+	changes, err := control.ParseChanges(reader, "")
+	isok(t, err)
+
+	split := changes.SplitByArch()
+	assert(t, len(split) == 1)
+	for arch, c := range split {
+		assert(t, arch.String() == "source")
+		assert(t, len(c.Files) == 2)
+	}
+}
+
+func TestChangesArchitectures(t *testing.T) {
+	changes, err := control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Architecture: source all amd64
+`)), "")
+	isok(t, err)
+	assert(t, len(changes.Architectures) == 3)
+	assert(t, changes.Architectures[0].IsSource())
+	assert(t, changes.Architectures[1].IsAll())
+	assert(t, changes.Architectures[2].String() == "amd64")
+
+	_, err = control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Architecture: source amd64 source
+`)), "")
+	notok(t, err)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,83 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/xi2/xz"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+// Given an io.Reader, peek at the first few bytes to see if the stream is
+// gzip or xz compressed (such as a Packages.gz or Sources.xz index), and if
+// so, return a Reader that decompresses it on the fly. Uncompressed data is
+// passed through as-is.
+func NewDecompressingReader(reader io.Reader) (*bufio.Reader, error) {
+	buffered := bufio.NewReader(reader)
+
+	/* Peek may well come back short for tiny files; that's fine, since
+	 * they won't match any of the magic numbers. */
+	magic, _ := buffered.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		decompressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(decompressed), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		decompressed, err := xz.NewReader(buffered, 0)
+		if err != nil {
+			return nil, err
+		}
+		return bufio.NewReader(decompressed), nil
+	}
+	return buffered, nil
+}
+
+// Open the file at the given path, and parse it as if it were passed to
+// the parse function, decompressing it first if it's gzip or xz
+// compressed. This is mostly useful to implement the Parse*File helpers.
+func parseMaybeCompressedFile(path string, parse func(*bufio.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, err := NewDecompressingReader(f)
+	if err != nil {
+		return err
+	}
+	return parse(reader)
+}
+
+// vim: foldmethod=marker
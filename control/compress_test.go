@@ -0,0 +1,100 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+const plainIndex = `Package: fbautostart
+Version: 2.718281828-1
+`
+
+// xz compressed copy of plainIndex
+const xzIndex = "fd377a585a0000016922de360200210116000000742fe5a301002b5061636b" +
+	"6167653a2066626175746f73746172740a56657273696f6e3a20322e37313832" +
+	"38313832382d310a00b37e0f8e0001402ccd9627e29042990d010000000001595a"
+
+func TestDecompressingReader(t *testing.T) {
+	gzipped := bytes.Buffer{}
+	w := gzip.NewWriter(&gzipped)
+	_, err := w.Write([]byte(plainIndex))
+	isok(t, err)
+	isok(t, w.Close())
+
+	xzed, err := hex.DecodeString(xzIndex)
+	isok(t, err)
+
+	for _, data := range [][]byte{[]byte(plainIndex), gzipped.Bytes(), xzed} {
+		reader, err := control.NewDecompressingReader(bytes.NewReader(data))
+		isok(t, err)
+		out, err := ioutil.ReadAll(reader)
+		isok(t, err)
+		assert(t, string(out) == plainIndex)
+	}
+
+	reader, err := control.NewDecompressingReader(bytes.NewReader([]byte("a")))
+	isok(t, err)
+	out, err := ioutil.ReadAll(reader)
+	isok(t, err)
+	assert(t, string(out) == "a")
+}
+
+func TestParseBinaryIndexFileCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-index")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "Packages.gz"))
+	isok(t, err)
+	w := gzip.NewWriter(f)
+	_, err = w.Write([]byte(plainIndex + "\nPackage: hello\nVersion: 1.0-1\n"))
+	isok(t, err)
+	isok(t, w.Close())
+	isok(t, f.Close())
+
+	index, err := control.ParseBinaryIndexFile(filepath.Join(dir, "Packages.gz"))
+	isok(t, err)
+	assert(t, len(index) == 2)
+	assert(t, index[0].Package == "fbautostart")
+	assert(t, index[1].Version.Version == "1.0")
+
+	sources, err := control.ParseSourceIndexFile(filepath.Join(dir, "Packages.gz"))
+	isok(t, err)
+	assert(t, len(sources) == 2)
+
+	_, err = control.ParseBinaryIndexFile(filepath.Join(dir, "Missing.gz"))
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
@@ -25,8 +25,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/version"
 )
 
 // Encapsulation for a debian/control file, which is a series of RFC2822-like
@@ -53,7 +55,7 @@ type SourceParagraph struct {
 	Paragraph
 
 	Maintainer  string
-	Uploaders   []string `delim:","`
+	Uploaders   []string `delim:"," strip:"\n\r\t " quoted:"true"`
 	Source      string
 	Priority    string
 	Section     string
@@ -72,6 +74,12 @@ func (s *SourceParagraph) Maintainers() []string {
 	return append([]string{s.Maintainer}, s.Uploaders...)
 }
 
+// Return the Maintainers, parsed into a Name and Email by ParseMaintainer.
+// An error is returned if any of them isn't a well formed `Name <email>`.
+func (s *SourceParagraph) ParsedMaintainers() ([]Maintainer, error) {
+	return parseMaintainers(s.Maintainers())
+}
+
 // Encapsulation for a debian/control Binary control entry. This contains
 // information that will be eventually put lovingly into the .deb file
 // after it's built on a given Arch.
@@ -98,14 +106,14 @@ type BinaryParagraph struct {
 }
 
 func (para *Paragraph) getDependencyField(field string) (*dependency.Dependency, error) {
-	if val, ok := para.Values[field]; ok {
+	if val, ok := para.Get(field); ok {
 		return dependency.Parse(val)
 	}
 	return nil, fmt.Errorf("Field `%s' Missing", field)
 }
 
 func (para *Paragraph) getOptionalDependencyField(field string) dependency.Dependency {
-	val := para.Values[field]
+	val, _ := para.Get(field)
 	dep, err := dependency.Parse(val)
 	if err != nil {
 		return dependency.Dependency{}
@@ -113,6 +121,47 @@ func (para *Paragraph) getOptionalDependencyField(field string) dependency.Depen
 	return *dep
 }
 
+// Parse the given field of the Paragraph as a Dependency, the same way a
+// dependency.Dependency struct member would be. A missing field is an
+// error.
+func (para *Paragraph) GetDependency(field string) (dependency.Dependency, error) {
+	dep, err := para.getDependencyField(field)
+	if err != nil {
+		return dependency.Dependency{}, err
+	}
+	return *dep, nil
+}
+
+// Parse the given field of the Paragraph as a Version, the same way a
+// version.Version struct member would be. A missing field is an error.
+func (para *Paragraph) GetVersion(field string) (version.Version, error) {
+	ret := version.Version{}
+	val, ok := para.Get(field)
+	if !ok {
+		return ret, fmt.Errorf("Field `%s' Missing", field)
+	}
+	err := ret.UnmarshalControl(val)
+	return ret, err
+}
+
+// Split the given field of the Paragraph on delim, the same way a []string
+// struct member tagged with that `delim` (and stripping whitespace off of
+// each element) would be. A missing or empty field is an empty list.
+func (para *Paragraph) GetList(field, delim string) []string {
+	ret := []string{}
+	val, ok := para.Get(field)
+	if !ok {
+		return ret
+	}
+	fieldType := reflect.StructField{
+		Name: field,
+		Tag:  reflect.StructTag(fmt.Sprintf("delim:%q strip:%q", delim, "\n\r\t ")),
+	}
+	/* Splitting into strings can't fail */
+	decodeStructValueSlice(reflect.ValueOf(&ret).Elem(), fieldType, val)
+	return ret
+}
+
 // Given a path on the filesystem, Parse the file off the disk and return
 // a pointer to a brand new Control struct, unless error is set to a value
 // other than nil.
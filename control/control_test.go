@@ -128,4 +128,53 @@ Description: XDG compliant autostarting app for Fluxbox
 	assert(t, len(arches) == 3)
 }
 
+func TestQuotedUploadersParse(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Source: fbautostart
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Uploaders: "Smith, John" <john@example.org>, John Doe <jdoe@example.com>,
+ "Bar, \"Foo\"" <fnord@baz.fnord>
+`))
+	c, err := control.ParseControl(reader, "")
+	isok(t, err)
+	assert(t, len(c.Source.Uploaders) == 3)
+	assert(t, c.Source.Uploaders[0] == `"Smith, John" <john@example.org>`)
+	assert(t, c.Source.Uploaders[1] == "John Doe <jdoe@example.com>")
+
+	maintainers, err := c.Source.ParsedMaintainers()
+	isok(t, err)
+	assert(t, len(maintainers) == 4)
+	assert(t, maintainers[1].Name == "Smith, John")
+	assert(t, maintainers[3].Name == `Bar, "Foo"`)
+	assert(t, maintainers[3].Email == "fnord@baz.fnord")
+}
+
+func TestParagraphTypedGetters(t *testing.T) {
+	reader, err := control.NewParagraphReader(strings.NewReader(`Package: hello
+Version: 1:2.10-2
+Depends: libc6 (>= 2.14), foo | bar
+Tags: devel::lang:c,  role::program ,
+Binary: hello  hello-doc
+`), nil)
+	isok(t, err)
+	para, err := reader.Next()
+	isok(t, err)
+
+	dep, err := para.GetDependency("depends")
+	isok(t, err)
+	assert(t, len(dep.Relations) == 2)
+	assert(t, dep.Relations[0].Possibilities[0].Version.Number == "2.14")
+	_, err = para.GetDependency("Recommends")
+	notok(t, err)
+
+	ver, err := para.GetVersion("Version")
+	isok(t, err)
+	assert(t, ver.Epoch == 1 && ver.Version == "2.10")
+	_, err = para.GetVersion("Source-Version")
+	notok(t, err)
+
+	assert(t, strings.Join(para.GetList("Tags", ","), "|") == "devel::lang:c|role::program|")
+	assert(t, strings.Join(para.GetList("Binary", " "), "|") == "hello|hello-doc")
+	assert(t, len(para.GetList("Missing", " ")) == 0)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,221 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// {{{ .deb control member
+
+// Given the path to a binary package (.deb), read the `control` file out of
+// its control.tar member, and parse it into a BinaryIndex, without needing
+// to unpack the package. The `conffiles` and `md5sums` files are read too,
+// and can be had from the Conffiles and Md5sums methods of the BinaryIndex.
+//
+// The control.tar may be uncompressed, or gzip, xz or zstd compressed. As
+// there's no native zstd decompressor available, zstd compressed packages
+// are passed through the `zstd` tool, which has to be installed on the
+// system.
+//
+// The deb package has a complete reader for binary packages, but as it is
+// built on top of this package, this is here for when only the control
+// data is needed.
+func ParseDebControl(path string) (*BinaryIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	name, member, err := findArMember(bufio.NewReader(f), "control.tar")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	reader, closer, err := decompressDebMember(name, member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	defer closer()
+
+	var controlFile []byte
+	var conffiles []string
+	var md5sums map[string]string
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+
+		switch strings.TrimPrefix(header.Name, "./") {
+		case "control":
+			if controlFile, err = ioutil.ReadAll(archive); err != nil {
+				return nil, err
+			}
+		case "conffiles":
+			if conffiles, err = parseConffiles(archive); err != nil {
+				return nil, err
+			}
+		case "md5sums":
+			if md5sums, err = parseMd5sums(archive); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	}
+
+	if controlFile == nil {
+		return nil, fmt.Errorf("%s: No control file in %s", path, name)
+	}
+	ret := BinaryIndex{}
+	if err := Unmarshal(&ret, bytes.NewReader(controlFile)); err != nil {
+		return nil, err
+	}
+	ret.conffiles = conffiles
+	ret.md5sums = md5sums
+	return &ret, nil
+}
+
+// Parse a conffiles control file, which lists one absolute path per line.
+// Newer versions of dpkg allow flags (such as `remove-on-upgrade`) before
+// the path, which are dropped.
+func parseConffiles(reader io.Reader) ([]string, error) {
+	ret := []string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		ret = append(ret, fields[len(fields)-1])
+	}
+	return ret, scanner.Err()
+}
+
+// Parse an md5sums control file, which has the md5 hash of each file,
+// followed by two spaces and the path, as written by md5sum(1).
+func parseMd5sums(reader io.Reader) (map[string]string, error) {
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		els := strings.SplitN(line, " ", 2)
+		if len(els) != 2 {
+			return nil, fmt.Errorf("Bad md5sums line: '%s'", line)
+		}
+		ret[strings.TrimLeft(els[1], " *")] = els[0]
+	}
+	return ret, scanner.Err()
+}
+
+// Walk the `ar(1)` archive, and return the name and contents of the first
+// member whose name starts with the given prefix, such as `control.tar`.
+func findArMember(reader *bufio.Reader, prefix string) (string, io.Reader, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != "!<arch>\n" {
+		return "", nil, fmt.Errorf("Not an ar archive")
+	}
+
+	header := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			return "", nil, fmt.Errorf("No %s member in the archive", prefix)
+		} else if err != nil {
+			return "", nil, err
+		}
+		if string(header[58:60]) != "`\n" {
+			return "", nil, fmt.Errorf("Bad ar member header")
+		}
+
+		/* GNU ar ends the names with a `/` */
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("Bad ar member size for '%s'", name)
+		}
+
+		if strings.HasPrefix(name, prefix) {
+			return name, io.LimitReader(reader, size), nil
+		}
+
+		/* Members are aligned on 2 byte boundaries */
+		if _, err := io.CopyN(ioutil.Discard, reader, size+size%2); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+// Return a Reader that decompresses the named member of a .deb, going by
+// its extension, along with a function to clean up once done with it.
+func decompressDebMember(name string, member io.Reader) (io.Reader, func() error, error) {
+	noop := func() error { return nil }
+
+	switch path.Ext(name) {
+	case ".tar":
+		return member, noop, nil
+	case ".gz", ".xz":
+		reader, err := NewDecompressingReader(member)
+		return reader, noop, err
+	case ".zst":
+		cmd := exec.Command("zstd", "-dc")
+		cmd.Stdin = member
+		stderr := bytes.Buffer{}
+		cmd.Stderr = &stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("Can't decompress %s: %v", name, err)
+		}
+		wait := func() error {
+			/* We may not have read everything zstd had to say */
+			io.Copy(ioutil.Discard, stdout)
+			if err := cmd.Wait(); err != nil {
+				return fmt.Errorf("zstd: %v: %s", err, strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		}
+		return stdout, wait, nil
+	}
+	return nil, nil, fmt.Errorf("Unknown compression for %s", name)
+}
+
+// }}}
+
+// vim: foldmethod=marker
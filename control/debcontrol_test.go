@@ -0,0 +1,185 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+const debControl = `Package: hello
+Version: 2.10-2
+Architecture: amd64
+Maintainer: Santiago Vila <sanvila@debian.org>
+Installed-Size: 280
+Depends: libc6 (>= 2.14)
+Section: devel
+Priority: optional
+Description: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+`
+
+// Write a .deb to the path, with a control.tar member under the given name,
+// compressed with the given function.
+func writeDeb(t *testing.T, path, member string, compress func([]byte) []byte) {
+	tarball := bytes.Buffer{}
+	archive := tar.NewWriter(&tarball)
+	for name, content := range map[string]string{
+		"./":        "",
+		"./control": debControl,
+		"./md5sums": "d41d8cd98f00b204e9800998ecf8427e  usr/bin/hello\n" +
+			"0f343b0931126a20f133d67c2b018a3b  usr/share/doc/hello/a file\n",
+		"./conffiles": "/etc/hello.conf\nremove-on-upgrade /etc/hello/old.conf\n",
+	} {
+		header := tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}
+		if name == "./" {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		isok(t, archive.WriteHeader(&header))
+		_, err := archive.Write([]byte(content))
+		isok(t, err)
+	}
+	isok(t, archive.Close())
+
+	deb := bytes.Buffer{}
+	deb.WriteString("!<arch>\n")
+	for _, el := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{member, compress(tarball.Bytes())},
+		{"data.tar", []byte{}},
+	} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", el.name+"/", 0, 0, 0, "100644", len(el.data))
+		deb.Write(el.data)
+		if len(el.data)%2 == 1 {
+			deb.WriteString("\n")
+		}
+	}
+	isok(t, ioutil.WriteFile(path, deb.Bytes(), 0644))
+}
+
+// Return a function that compresses data with the given command, skipping
+// the test if it isn't installed.
+func compressWith(t *testing.T, name string, args ...string) func([]byte) []byte {
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s isn't installed", name)
+	}
+	return func(data []byte) []byte {
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.Output()
+		isok(t, err)
+		return out
+	}
+}
+
+func TestParseDebControl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-deb")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	for member, compress := range map[string]func([]byte) []byte{
+		"control.tar": func(data []byte) []byte { return data },
+		"control.tar.gz": func(data []byte) []byte {
+			buf := bytes.Buffer{}
+			writer := gzip.NewWriter(&buf)
+			writer.Write(data)
+			writer.Close()
+			return buf.Bytes()
+		},
+	} {
+		path := filepath.Join(dir, "hello_2.10-2_amd64.deb")
+		writeDeb(t, path, member, compress)
+
+		index, err := control.ParseDebControl(path)
+		isok(t, err)
+		assert(t, index.Package == "hello")
+		assert(t, index.Version.String() == "2.10-2")
+		assert(t, index.Architecture.String() == "amd64")
+		assert(t, index.Depends.Relations[0].Possibilities[0].Name == "libc6")
+
+		conffiles := index.Conffiles()
+		assert(t, len(conffiles) == 2)
+		assert(t, conffiles[0] == "/etc/hello.conf")
+		assert(t, conffiles[1] == "/etc/hello/old.conf")
+
+		md5sums := index.Md5sums()
+		assert(t, len(md5sums) == 2)
+		assert(t, md5sums["usr/bin/hello"] == "d41d8cd98f00b204e9800998ecf8427e")
+		assert(t, md5sums["usr/share/doc/hello/a file"] == "0f343b0931126a20f133d67c2b018a3b")
+	}
+}
+
+func TestParseDebControlXz(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-deb")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hello_2.10-2_amd64.deb")
+	writeDeb(t, path, "control.tar.xz", compressWith(t, "xz", "-c"))
+
+	index, err := control.ParseDebControl(path)
+	isok(t, err)
+	assert(t, index.Package == "hello")
+	assert(t, len(index.Conffiles()) == 2)
+}
+
+func TestParseDebControlZstd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-deb")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hello_2.10-2_amd64.deb")
+	writeDeb(t, path, "control.tar.zst", compressWith(t, "zstd", "-c", "-q"))
+
+	index, err := control.ParseDebControl(path)
+	isok(t, err)
+	assert(t, index.Package == "hello")
+}
+
+func TestParseDebControlNotADeb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-deb")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hello.deb")
+	isok(t, ioutil.WriteFile(path, []byte(debControl), 0644))
+	_, err = control.ParseDebControl(path)
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
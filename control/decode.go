@@ -21,6 +21,7 @@
 package control
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"reflect"
@@ -41,6 +42,22 @@ type Unmarshallable interface {
 	UnmarshalControl(data string) error
 }
 
+// Unmarshaler is the same interface as Unmarshallable, following the naming
+// used by the encoding packages of the standard library. Anything that
+// implements one implements the other.
+type Unmarshaler interface {
+	Unmarshallable
+}
+
+// The Validatable interface may be implemented by the (pointer to the)
+// Struct a Paragraph is being Unmarshaled into. Once all the fields have
+// been unpacked, ValidateControl is called, and any error it returns is
+// returned from Unmarshal, to reject Paragraphs that parse, but don't make
+// sense.
+type Validatable interface {
+	ValidateControl() error
+}
+
 // }}}
 
 // Unmarshal {{{
@@ -53,20 +70,40 @@ type Unmarshallable interface {
 // This code will attempt to unpack it into the struct based on the
 // literal name of the key, compared byte-for-byte. If this is not
 // OK, the struct tag `control:""` can be used to define the key to use
-// in the RFC822 stream.
+// in the RFC822 stream. More than one key may be given, separated by
+// commas (`control:"Maintainer,XBS-Maintainer"`), in which case each is
+// checked in turn, and the first one found in the Paragraph is used.
 //
 // If you're unpacking into a list of strings, you have the option of defining
 // a string to split tokens on (`delim:", "`), and things to strip off each
-// element (`strip:"\n\r\t "`).
+// element (`strip:"\n\r\t "`). Fields where the delim may show up inside
+// of a double quoted string (such as a comma in the Name of an Uploader)
+// can be tagged `quoted:"true"` to only split on the delims outside quotes.
 //
 // If you're unpacking into a struct, the struct will be walked according to
 // the rules above. If you wish to override how this writes to the nested
 // struct, objects that implement the Unmarshallable interface will be
 // Unmarshaled via that method call only.
 //
+// If you're unpacking into a list of structs that don't implement the
+// Unmarshallable interface, each element (split on `delim:"\n"`, say) is
+// split on whitespace into columns, which are unpacked into the exported
+// fields of the struct in order, following the rules above. This allows
+// for modeling tabular, multi-line fields like the Checksums-* fields.
+// Trailing columns may be missing, unless the field is `required:"true"`.
+//
 // Structs that contain Paragraph as an Anonymous member will have that
 // member populated with the parsed RFC822 block, to allow access to the
 // .Values and .Order members.
+//
+// Fields that are absent from the Paragraph are left as they are, which
+// means an absent field can't be told apart from an empty one, unless the
+// member is a pointer (such as `*string` or `*[]string`): it's only set
+// (to an empty value, if need be) when the field is present, and stays
+// nil otherwise. Paragraph.Get may also be used to check for a field.
+//
+// Structs that implement the Validatable interface are checked by calling
+// ValidateControl once each Paragraph has been unpacked into them.
 func Unmarshal(data interface{}, reader io.Reader) error {
 	decoder, err := NewDecoder(reader, nil)
 	if err != nil {
@@ -81,6 +118,8 @@ func Unmarshal(data interface{}, reader io.Reader) error {
 
 type Decoder struct {
 	paragraphReader ParagraphReader
+
+	rejectTrailingData bool
 }
 
 // NewDecoder {{{
@@ -95,14 +134,147 @@ func NewDecoder(reader io.Reader, keyring *openpgp.EntityList) (*Decoder, error)
 	return &ret, nil
 }
 
+func newDecoder(reader io.Reader, keyring openpgp.KeyRing) (*Decoder, error) {
+	ret := Decoder{}
+	pr, err := newParagraphReader(reader, keyring)
+	if err != nil {
+		return nil, err
+	}
+	ret.paragraphReader = *pr
+	return &ret, nil
+}
+
+// }}}
+
+// PreserveComments {{{
+
+// Keep any `#` comment lines in the Paragraph anonymous member of the
+// structs decoded from here on, so that they're written back out by
+// Marshal. By default, comments are dropped.
+func (d *Decoder) PreserveComments() {
+	d.paragraphReader.PreserveComments()
+}
+
+// }}}
+
+// RejectDuplicates {{{
+
+// Error out when a field is repeated within a paragraph, naming the field,
+// rather than keeping the last value given for it (the default).
+func (d *Decoder) RejectDuplicates() {
+	d.paragraphReader.RejectDuplicates()
+}
+
+// }}}
+
+// TranscodeLatin1 {{{
+
+// Convert any line that isn't valid UTF-8 from ISO-8859-1 (Latin-1), for
+// legacy files. By default, values are decoded as-is.
+func (d *Decoder) TranscodeLatin1() {
+	d.paragraphReader.TranscodeLatin1()
+}
+
+// }}}
+
+// MaxFieldBytes {{{
+
+// Error out when a field (counting its name and continuation lines) is
+// longer than the given number of bytes, rather than reading it into
+// memory. See ParagraphReader.MaxFieldBytes.
+func (d *Decoder) MaxFieldBytes(n int) {
+	d.paragraphReader.MaxFieldBytes(n)
+}
+
+// }}}
+
+// MaxParagraphs {{{
+
+// Error out rather than decoding more than the given number of Paragraphs.
+// See ParagraphReader.MaxParagraphs.
+func (d *Decoder) MaxParagraphs(n int) {
+	d.paragraphReader.MaxParagraphs(n)
+}
+
+// }}}
+
+// RejectTrailingData {{{
+
+// Error out from Decode when decoding into a single struct and the
+// Paragraph is followed by anything other than blank lines, rather than
+// ignoring whatever comes after it (the default). This is useful for
+// files that must only ever contain one Paragraph, such as a .dsc.
+func (d *Decoder) RejectTrailingData() {
+	d.rejectTrailingData = true
+}
+
 // }}}
 
 // Decode {{{
 
 func (d *Decoder) Decode(into interface{}) error {
-	return decode(&d.paragraphReader, reflect.ValueOf(into))
+	if err := decode(&d.paragraphReader, reflect.ValueOf(into)); err != nil {
+		return err
+	}
+	if d.rejectTrailingData {
+		return d.checkTrailingData()
+	}
+	return nil
 }
 
+// Make sure there are no more Paragraphs left to be read.
+func (d *Decoder) checkTrailingData() error {
+	paragraph, err := d.paragraphReader.Next()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return &UnmarshalError{
+		Paragraph: paragraph.index,
+		Line:      paragraph.lines[paragraph.Order[0]],
+		Err:       fmt.Errorf("Unexpected data after the end of the first Paragraph"),
+	}
+}
+
+// Next {{{
+
+// Read the next Paragraph off the stream, and decode it into the given
+// pointer to a struct, following the same rules as Unmarshal. Once there
+// are no more Paragraphs to be read, io.EOF is returned.
+//
+// This allows for processing very large files (such as a Packages index)
+// one Paragraph at a time, without holding all of them in memory at once:
+//
+//     for {
+//         index := control.BinaryIndex{}
+//         if err := decoder.Next(&index); err == io.EOF {
+//             break
+//         } else if err != nil {
+//             return err
+//         }
+//         ...
+//     }
+//
+// The struct is reset to its zero value before being decoded into, so it
+// is safe to reuse the same struct for each call.
+func (d *Decoder) Next(into interface{}) error {
+	data := reflect.ValueOf(into)
+	if data.Type().Kind() != reflect.Ptr || data.Elem().Type().Kind() != reflect.Struct {
+		return fmt.Errorf("Next can only decode into a pointer to a Struct!")
+	}
+
+	paragraph, err := d.paragraphReader.Next()
+	if err != nil {
+		return err
+	}
+
+	data.Elem().Set(reflect.Zero(data.Elem().Type()))
+	return decodeParagraph(*paragraph, data)
+}
+
+// }}}
+
 // Top-level decode dispatch {{{
 
 func decode(p *ParagraphReader, into reflect.Value) error {
@@ -116,7 +288,7 @@ func decode(p *ParagraphReader, into reflect.Value) error {
 		if err != nil {
 			return err
 		}
-		return decodeStruct(*paragraph, into)
+		return decodeParagraph(*paragraph, into)
 	case reflect.Slice:
 		return decodeSlice(p, into)
 	default:
@@ -130,6 +302,30 @@ func decode(p *ParagraphReader, into reflect.Value) error {
 
 // Top-level struct dispatch {{{
 
+// Decode the Paragraph into the pointer to a Struct, and then give it the
+// chance to check the result, if it's Validatable.
+func decodeParagraph(p Paragraph, into reflect.Value) error {
+	if err := decodeStruct(p, into); err != nil {
+		return err
+	}
+
+	validatable, ok := into.Interface().(Validatable)
+	if !ok {
+		return nil
+	}
+	if err := validatable.ValidateControl(); err != nil {
+		if _, ok := err.(*UnmarshalError); ok {
+			return err
+		}
+		return &UnmarshalError{
+			Paragraph: p.index,
+			Line:      p.firstLine(),
+			Err:       err,
+		}
+	}
+	return nil
+}
+
 func decodeStruct(p Paragraph, into reflect.Value) error {
 	/* If we have a pointer, let's follow it */
 	if into.Type().Kind() == reflect.Ptr {
@@ -155,10 +351,8 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 
 		/* First, let's get the name of the field as we'd index into the
 		 * map[string]string. */
-		paragraphKey := fieldType.Name
-		if it := fieldType.Tag.Get("control"); it != "" {
-			paragraphKey = it
-		}
+		paragraphKeys := controlKeys(fieldType)
+		paragraphKey := paragraphKeys[0]
 
 		if paragraphKey == "-" {
 			/* If the key is "-", lets go ahead and skip it */
@@ -178,17 +372,27 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 			}
 		}
 
-		if value, ok := p.Values[paragraphKey]; ok {
-			if err := decodeStructValue(field, fieldType, value); err != nil {
-				return err
+		if key, ok := p.lookupAny(paragraphKeys); ok {
+			if err := decodeStructValue(field, fieldType, p.Values[key]); err != nil {
+				return &UnmarshalError{
+					Field:     key,
+					Paragraph: p.index,
+					Line:      p.lines[key],
+					Err:       err,
+				}
 			}
 			continue
 		} else {
 			if fieldType.Tag.Get("required") == "true" {
-				return fmt.Errorf(
-					"Required field '%s' is missing!",
-					fieldType.Name,
-				)
+				return &UnmarshalError{
+					Field:     paragraphKey,
+					Paragraph: p.index,
+					Line:      p.firstLine(),
+					Err: fmt.Errorf(
+						"Required field '%s' is missing!",
+						fieldType.Name,
+					),
+				}
 			}
 			continue
 		}
@@ -197,11 +401,49 @@ func decodeStruct(p Paragraph, into reflect.Value) error {
 	return nil
 }
 
+// Return the keys the struct field is read from, as given by the `control`
+// tag, or the name of the field if it hasn't got one. The first key is the
+// one the field is written out as.
+func controlKeys(fieldType reflect.StructField) []string {
+	it := fieldType.Tag.Get("control")
+	if it == "" {
+		return []string{fieldType.Name}
+	}
+	keys := []string{}
+	for _, key := range strings.Split(it, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return []string{fieldType.Name}
+	}
+	return keys
+}
+
+// Find the first of the keys that's in the Paragraph, as with lookup.
+func (p *Paragraph) lookupAny(keys []string) (string, bool) {
+	for _, key := range keys {
+		if found, ok := p.lookup(key); ok {
+			return found, true
+		}
+	}
+	return "", false
+}
+
 // }}}
 
 // set a struct field value {{{
 
 func decodeStructValue(field reflect.Value, fieldType reflect.StructField, value string) error {
+	/* Types that know how to read themselves in get first dibs, no
+	 * matter what kind of type they are underneath. */
+	if field.Kind() != reflect.Struct && field.CanAddr() {
+		if unmarshal, ok := field.Addr().Interface().(Unmarshallable); ok {
+			return unmarshal.UnmarshalControl(value)
+		}
+	}
+
 	switch field.Type().Kind() {
 	case reflect.String:
 		field.SetString(value)
@@ -211,11 +453,18 @@ func decodeStructValue(field reflect.Value, fieldType reflect.StructField, value
 			field.SetInt(0)
 			return nil
 		}
-		value, err := strconv.Atoi(value)
+		number, err := strconv.Atoi(value)
 		if err != nil {
+			return fmt.Errorf("Field '%s' has a non-numeric value: '%s'", fieldType.Name, value)
+		}
+		field.SetInt(int64(number))
+		return nil
+	case reflect.Ptr:
+		target := reflect.New(field.Type().Elem())
+		if err := decodeStructValue(target.Elem(), fieldType, value); err != nil {
 			return err
 		}
-		field.SetInt(int64(value))
+		field.Set(target)
 		return nil
 	case reflect.Slice:
 		return decodeStructValueSlice(field, fieldType, value)
@@ -267,12 +516,32 @@ func decodeStructValueSlice(field reflect.Value, fieldType reflect.StructField,
 	}
 
 	value = strings.Trim(value, strip)
+	if value == "" {
+		/* An empty field is an empty list, not a list with one empty
+		 * element in it. */
+		return nil
+	}
 
-	for _, el := range strings.Split(value, delim) {
+	elements := strings.Split(value, delim)
+	if fieldType.Tag.Get("quoted") == "true" {
+		elements = splitQuoted(value, delim)
+	}
+
+	for _, el := range elements {
 		el = strings.Trim(el, strip)
+		if el == "" && strings.TrimSpace(delim) == "" {
+			/* Runs of whitespace between elements don't make for
+			 * empty elements. */
+			continue
+		}
 
 		targetValue := reflect.New(underlyingType)
-		err := decodeStructValue(targetValue.Elem(), fieldType, el)
+		var err error
+		if isColumnStruct(underlyingType) {
+			err = decodeColumns(targetValue.Elem(), el)
+		} else {
+			err = decodeStructValue(targetValue.Elem(), fieldType, el)
+		}
 		if err != nil {
 			return err
 		}
@@ -282,6 +551,96 @@ func decodeStructValueSlice(field reflect.Value, fieldType reflect.StructField,
 	return nil
 }
 
+// Split the string on delim, the same as strings.Split, except for any
+// delims found in between a pair of double quotes. A backslash escapes the
+// character after it while inside quotes.
+func splitQuoted(value, delim string) []string {
+	ret := []string{}
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case quoted && value[i] == '\\':
+			i++
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(value[i:], delim):
+			ret = append(ret, value[start:i])
+			i += len(delim) - 1
+			start = i + 1
+		}
+	}
+	return append(ret, value[start:])
+}
+
+// }}}
+
+// set a slice element of type struct, column by column {{{
+
+// Check to see if elements of a slice of this type should be read column
+// by column, which is the case for structs that don't implement
+// Unmarshallable themselves.
+func isColumnStruct(flavor reflect.Type) bool {
+	if flavor.Kind() != reflect.Struct {
+		return false
+	}
+	_, ok := reflect.New(flavor).Interface().(Unmarshallable)
+	return !ok
+}
+
+// A column of a struct read (or written) column by column, along with the
+// StructField describing it, so that its tags are honored.
+type column struct {
+	value reflect.Value
+	field reflect.StructField
+}
+
+// Get the fields of a struct that columns are read into (or written out
+// from), in order. Unexported fields and fields tagged `control:"-"` are
+// skipped, and the fields of anonymous struct members are taken in place.
+func columnFields(into reflect.Value) []column {
+	ret := []column{}
+	for i := 0; i < into.NumField(); i++ {
+		field := into.Field(i)
+		fieldType := into.Type().Field(i)
+
+		if fieldType.PkgPath != "" || fieldType.Tag.Get("control") == "-" {
+			continue
+		}
+		if fieldType.Anonymous && isColumnStruct(fieldType.Type) {
+			ret = append(ret, columnFields(field)...)
+			continue
+		}
+		ret = append(ret, column{value: field, field: fieldType})
+	}
+	return ret
+}
+
+// Internal method to split a single element of a slice on whitespace, and
+// set each field of the struct to the next column, following the same rules
+// as any other field. Trailing columns may be left off, unless the field
+// they'd go into is tagged `required:"true"`.
+func decodeColumns(into reflect.Value, data string) error {
+	values := strings.Fields(data)
+	columns := columnFields(into)
+	if len(values) > len(columns) {
+		return fmt.Errorf("Too many columns in '%s', expected at most %d", data, len(columns))
+	}
+
+	for i, column := range columns {
+		if i >= len(values) {
+			if column.field.Tag.Get("required") == "true" {
+				return fmt.Errorf("Required column '%s' is missing in '%s'", column.field.Name, data)
+			}
+			continue
+		}
+		if err := decodeStructValue(column.value, column.field, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // }}}
 
 // Top-level slice dispatch {{{
@@ -300,7 +659,7 @@ func decodeSlice(p *ParagraphReader, into reflect.Value) error {
 			return err
 		}
 
-		if err := decodeStruct(*para, targetValue); err != nil {
+		if err := decodeParagraph(*para, targetValue); err != nil {
 			return err
 		}
 		into.Elem().Set(reflect.Append(into.Elem(), targetValue.Elem()))
@@ -321,6 +680,54 @@ func (d *Decoder) Signer() *openpgp.Entity {
 
 // }}}
 
+// SignedData {{{
+
+// Return the exact bytes covered by the OpenPGP signature that was checked
+// when this Decoder was created, or nil if nothing was checked.
+func (d *Decoder) SignedData() []byte {
+	return d.paragraphReader.SignedData()
+}
+
+// }}}
+
+// decodeSigned {{{
+
+// Internal method backing the Parse*Signed functions: check the OpenPGP
+// clearsignature on reader against keyring, decode the signed document into
+// into, and return the signer along with the bytes it signed.
+func decodeSigned(reader *bufio.Reader, keyring openpgp.KeyRing, into interface{}) (*openpgp.Entity, []byte, error) {
+	decoder, err := openSigned(reader, keyring, into)
+	if err != nil {
+		return nil, nil, err
+	}
+	return decoder.Signer(), decoder.SignedData(), nil
+}
+
+// Check and decode, as decodeSigned does, returning the Decoder, for a
+// closer look at the signature.
+func openSigned(reader *bufio.Reader, keyring openpgp.KeyRing, into interface{}) (*Decoder, error) {
+	if keyring == nil {
+		return nil, fmt.Errorf("No keyring given to check the signature against")
+	}
+
+	line, _ := reader.Peek(15)
+	if string(line) != "-----BEGIN PGP " {
+		return nil, ErrNotSigned
+	}
+
+	decoder, err := newDecoder(reader, keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := decoder.Decode(into); err != nil {
+		return nil, err
+	}
+	return decoder, nil
+}
+
+// }}}
+
 // }}}
 
 // UnpackFromParagraph {{{
@@ -336,7 +743,7 @@ func UnpackFromParagraph(para Paragraph, incoming interface{}) error {
 	if data.Type().Kind() != reflect.Ptr {
 		return fmt.Errorf("Can only Decode a pointer to a Struct")
 	}
-	return decodeStruct(para, data.Elem())
+	return decodeParagraph(para, data)
 }
 
 // }}}
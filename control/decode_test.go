@@ -1,6 +1,9 @@
 package control_test
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -133,3 +136,302 @@ Extra-Source-Only: yes
 `)))
 	assert(t, foo.ExtraSourceOnly)
 }
+
+func TestDecoderNext(t *testing.T) {
+	decoder, err := control.NewDecoder(strings.NewReader(`Value: foo
+ValueThree: a b
+
+Value: bar
+
+
+Value: baz
+ValueThree: c
+`), nil)
+	isok(t, err)
+
+	values := []string{}
+	foo := TestStruct{}
+	for {
+		err := decoder.Next(&foo)
+		if err == io.EOF {
+			break
+		}
+		isok(t, err)
+		values = append(values, foo.Value+":"+strings.Join(foo.ValueThree, ","))
+	}
+	assert(t, strings.Join(values, " ") == "foo:a,b bar: baz:c")
+
+	notok(t, decoder.Next(foo))
+	notok(t, decoder.Next(&values))
+}
+
+func TestDuplicateFieldUnmarshal(t *testing.T) {
+	input := `Source: hello
+Architecture: amd64
+Version: 1.0-1
+architecture: i386 armhf
+`
+	dsc := control.DSC{}
+	isok(t, control.Unmarshal(&dsc, strings.NewReader(input)))
+	assert(t, len(dsc.Architectures) == 2)
+	assert(t, dsc.Architectures[0].CPU == "i386")
+	assert(t, len(dsc.Order) == 3)
+	assert(t, dsc.Order[1] == "architecture")
+
+	decoder, err := control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+	decoder.RejectDuplicates()
+	err = decoder.Decode(&dsc)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "'architecture'"))
+
+	decoder, err = control.NewDecoder(strings.NewReader("Source: hello\nArchitecture: amd64\n"), nil)
+	isok(t, err)
+	decoder.RejectDuplicates()
+	isok(t, decoder.Decode(&dsc))
+}
+
+func TestDecoderLimits(t *testing.T) {
+	type pkg struct {
+		control.Paragraph
+		Package     string
+		Description string
+	}
+	input := "Package: foo\nDescription: short\n\nPackage: bar\nDescription: longer\n" +
+		strings.Repeat(" line\n", 100) + "\nPackage: baz\n"
+
+	decoder, err := control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+	decoder.MaxFieldBytes(300)
+	pkgs := []pkg{}
+	err = decoder.Decode(&pkgs)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "'Description' is longer than 300 bytes"))
+
+	/* A single line after the limit is never read into memory */
+	decoder, err = control.NewDecoder(strings.NewReader("Package: "+strings.Repeat("x", 10000)+"\n"), nil)
+	isok(t, err)
+	decoder.MaxFieldBytes(300)
+	pkgs = []pkg{}
+	err = decoder.Decode(&pkgs)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "line 1: Field is longer than 300 bytes"))
+
+	decoder, err = control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+	decoder.MaxParagraphs(2)
+	pkgs = []pkg{}
+	err = decoder.Decode(&pkgs)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "More than 2 Paragraphs"))
+
+	decoder, err = control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+	decoder.MaxFieldBytes(1000)
+	decoder.MaxParagraphs(3)
+	pkgs = []pkg{}
+	isok(t, decoder.Decode(&pkgs))
+	assert(t, len(pkgs) == 3)
+	assert(t, pkgs[2].Package == "baz")
+}
+
+type testColumnEntry struct {
+	Name    string `required:"true"`
+	Size    int
+	Tags    []string `delim:","`
+	Comment string   `control:"-"`
+}
+
+type testColumns struct {
+	control.Paragraph
+
+	Entries []testColumnEntry `control:"Entries" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+func TestColumnsUnmarshal(t *testing.T) {
+	input := `Entries:
+ foo 12 a,b
+ bar 3
+ baz
+`
+	el := testColumns{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(input)))
+	assert(t, len(el.Entries) == 3)
+	assert(t, el.Entries[0].Name == "foo")
+	assert(t, el.Entries[0].Size == 12)
+	assert(t, strings.Join(el.Entries[0].Tags, " ") == "a b")
+	assert(t, el.Entries[1].Size == 3)
+	assert(t, el.Entries[1].Tags == nil)
+	assert(t, el.Entries[2].Name == "baz")
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == `Entries:
+ foo 12 a,b
+ bar 3
+ baz 0
+`)
+
+	notok(t, control.Unmarshal(&el, strings.NewReader("Entries:\n foo 1 a b\n")))
+	notok(t, control.Unmarshal(&el, strings.NewReader("Entries:\n foo bar\n")))
+}
+
+func TestUnmarshalError(t *testing.T) {
+	input := `Package: foo
+Version: 1.0
+
+Package: bar
+Installed-Size: 12
+Version: 1.0
+
+# comment
+Package: baz
+Installed-Size: lots
+Version: 1.0
+
+Package: fnord
+Version: 2.0
+`
+	type pkg struct {
+		Package       string
+		InstalledSize int `control:"Installed-Size"`
+	}
+
+	decoder, err := control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+
+	names := []string{}
+	for {
+		el := pkg{}
+		err := decoder.Next(&el)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			uerr, ok := err.(*control.UnmarshalError)
+			assert(t, ok)
+			assert(t, uerr.Paragraph == 2)
+			assert(t, uerr.Line == 10)
+			assert(t, uerr.Field == "Installed-Size")
+			assert(t, strings.HasPrefix(err.Error(), "Paragraph 2, line 10, field 'Installed-Size': "))
+			continue
+		}
+		names = append(names, el.Package)
+	}
+	assert(t, strings.Join(names, " ") == "foo bar fnord")
+
+	err = control.Unmarshal(&[]pkg{}, strings.NewReader("Package: foo\n\nPackage bar\n"))
+	uerr, ok := err.(*control.UnmarshalError)
+	assert(t, ok)
+	assert(t, uerr.Paragraph == 1 && uerr.Line == 3 && uerr.Field == "")
+
+	type required struct {
+		Package string `required:"true"`
+	}
+	err = control.Unmarshal(&[]required{}, strings.NewReader("Package: foo\n\nVersion: 1.0\n"))
+	uerr, ok = err.(*control.UnmarshalError)
+	assert(t, ok)
+	assert(t, uerr.Paragraph == 1 && uerr.Line == 3 && uerr.Field == "Package")
+}
+
+func TestAliasedFieldUnmarshal(t *testing.T) {
+	type source struct {
+		control.Paragraph
+		Source     string
+		Maintainer string `control:"Maintainer,XBS-Maintainer"`
+	}
+
+	el := source{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(`Source: foo
+XBS-Maintainer: Jane Doe <jane@example.com>
+`)))
+	assert(t, el.Maintainer == "Jane Doe <jane@example.com>")
+
+	el = source{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(`Source: foo
+XBS-Maintainer: Jane Doe <jane@example.com>
+Maintainer: John Doe <john@example.com>
+`)))
+	assert(t, el.Maintainer == "John Doe <john@example.com>")
+
+	el = source{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(`Source: foo
+XBS-Maintainer: Jane Doe <jane@example.com>
+`)))
+	out := bytes.Buffer{}
+	isok(t, control.Marshal(&out, el))
+	assert(t, out.String() == "Source: foo\nMaintainer: Jane Doe <jane@example.com>\n")
+}
+
+type validatedSource struct {
+	Source  string
+	Version string
+
+	validated int
+}
+
+func (s *validatedSource) ValidateControl() error {
+	s.validated++
+	if s.Version == "" {
+		return fmt.Errorf("No Version for %s", s.Source)
+	}
+	return nil
+}
+
+func TestValidatableUnmarshal(t *testing.T) {
+	el := validatedSource{}
+	isok(t, control.Unmarshal(&el, strings.NewReader("Source: foo\nVersion: 1.0\n")))
+	assert(t, el.validated == 1)
+
+	els := []validatedSource{}
+	isok(t, control.Unmarshal(&els, strings.NewReader("Source: foo\nVersion: 1.0\n\nSource: bar\nVersion: 2.0\n")))
+	assert(t, len(els) == 2)
+	assert(t, els[0].validated == 1 && els[1].validated == 1)
+
+	err := control.Unmarshal(&els, strings.NewReader("Source: foo\nVersion: 1.0\n\nSource: bar\n"))
+	uerr, ok := err.(*control.UnmarshalError)
+	assert(t, ok)
+	assert(t, uerr.Paragraph == 1 && uerr.Line == 4)
+	assert(t, uerr.Err.Error() == "No Version for bar")
+
+	decoder, err := control.NewDecoder(strings.NewReader("Source: foo\nVersion: 1.0\n\nSource: bar\n\nSource: baz\nVersion: 3.0\n"), nil)
+	isok(t, err)
+	sources := []string{}
+	for {
+		err := decoder.Next(&el)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			assert(t, el.Source == "bar")
+			continue
+		}
+		assert(t, el.validated == 1)
+		sources = append(sources, el.Source)
+	}
+	assert(t, strings.Join(sources, " ") == "foo baz")
+}
+
+func TestPresentFieldUnmarshal(t *testing.T) {
+	type source struct {
+		Source    string
+		Uploaders *[]string `delim:"," strip:"\n\r\t "`
+		Homepage  *string
+	}
+
+	el := source{}
+	isok(t, control.Unmarshal(&el, strings.NewReader("Source: foo\nUploaders:\n")))
+	assert(t, el.Uploaders != nil && len(*el.Uploaders) == 0)
+	assert(t, el.Homepage == nil)
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == "Source: foo\nUploaders:\n")
+
+	el = source{}
+	isok(t, control.Unmarshal(&el, strings.NewReader("Source: foo\nHomepage: https://example.com\n")))
+	assert(t, el.Uploaders == nil)
+	assert(t, el.Homepage != nil && *el.Homepage == "https://example.com")
+
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == "Source: foo\nHomepage: https://example.com\n")
+}
@@ -22,17 +22,23 @@ package control
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/hashio"
 	"github.com/cinello/go-debian/internal"
 	"github.com/cinello/go-debian/version"
 
-	"pault.ag/go/topsort"
+	"golang.org/x/crypto/openpgp"
 )
 
 // A DSC is the encapsulation of a Debian .dsc control file. This contains
@@ -45,7 +51,7 @@ import (
 type DSC struct {
 	Paragraph
 
-	Filename string
+	Filename string `control:"-"`
 
 	Format           string
 	Source           string
@@ -54,35 +60,277 @@ type DSC struct {
 	Version          version.Version
 	Origin           string
 	Maintainer       string
-	Uploaders        []string
+	Uploaders        []string `delim:"," strip:"\n\r\t " quoted:"true"`
 	Homepage         string
 	StandardsVersion string `control:"Standards-Version"`
 
+	VcsBrowser string `control:"Vcs-Browser"`
+	VcsArch    string `control:"Vcs-Arch"`
+	VcsBzr     string `control:"Vcs-Bzr"`
+	VcsCvs     string `control:"Vcs-Cvs"`
+	VcsDarcs   string `control:"Vcs-Darcs"`
+	VcsGit     string `control:"Vcs-Git"`
+	VcsHg      string `control:"Vcs-Hg"`
+	VcsMtn     string `control:"Vcs-Mtn"`
+	VcsSvn     string `control:"Vcs-Svn"`
+
+	Testsuite         []string `control:"Testsuite" delim:"," strip:"\n\r\t "`
+	TestsuiteTriggers []string `control:"Testsuite-Triggers" delim:"," strip:"\n\r\t "`
+
+	Dgit string
+
 	BuildDepends      dependency.Dependency `control:"Build-Depends"`
 	BuildDependsArch  dependency.Dependency `control:"Build-Depends-Arch"`
 	BuildDependsIndep dependency.Dependency `control:"Build-Depends-Indep"`
 
-	ChecksumsSha1   []SHA1FileHash   `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha256 []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	Files           []MD5FileHash    `control:"Files" delim:"\n" strip:"\n\r\t "`
+	BuildConflicts      dependency.Dependency `control:"Build-Conflicts"`
+	BuildConflictsArch  dependency.Dependency `control:"Build-Conflicts-Arch"`
+	BuildConflictsIndep dependency.Dependency `control:"Build-Conflicts-Indep"`
 
-	/*
-		TODO:
-			Package-List
-	*/
+	ChecksumsSha1   []SHA1FileHash   `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha512 []SHA512FileHash `control:"Checksums-Sha512" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []MD5FileHash    `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
+
+	PackageList []PackageListEntry `control:"Package-List" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// The order dpkg-source writes the fields of a .dsc out in. Any fields
+// not in this list are written out after these, in the order they were
+// read in.
+var dscFieldOrder = []string{
+	"Format",
+	"Source",
+	"Binary",
+	"Architecture",
+	"Version",
+	"Origin",
+	"Maintainer",
+	"Uploaders",
+	"Homepage",
+	"Description",
+	"Standards-Version",
+	"Vcs-Browser",
+	"Vcs-Arch",
+	"Vcs-Bzr",
+	"Vcs-Cvs",
+	"Vcs-Darcs",
+	"Vcs-Git",
+	"Vcs-Hg",
+	"Vcs-Mtn",
+	"Vcs-Svn",
+	"Testsuite",
+	"Testsuite-Triggers",
+	"Dgit",
+	"Build-Depends",
+	"Build-Depends-Arch",
+	"Build-Depends-Indep",
+	"Build-Conflicts",
+	"Build-Conflicts-Arch",
+	"Build-Conflicts-Indep",
+	"Package-List",
+	"Checksums-Sha1",
+	"Checksums-Sha256",
+	"Checksums-Sha512",
+	"Files",
+}
+
+// {{{ Package-List entries
+
+// A PackageListEntry is a single line of the Package-List field of a .dsc,
+// describing one binary package the source produces, such as:
+//
+//   fbautostart deb misc optional arch=any profile=!nocheck
+//
+// Any key=value tokens after the Priority (such as arch, profile or
+// essential) are kept in the Extra map, keyed by the token name. Trailing
+// tokens without a value are kept too, mapped to an empty string.
+type PackageListEntry struct {
+	Name     string
+	Type     string
+	Section  string
+	Priority string
+	Extra    map[string]string
+}
+
+// Order in which well known Package-List keys are written out by
+// dpkg-source. Anything else is written after these, sorted by name.
+var packageListExtraOrder = []string{"arch", "profile", "essential", "protected"}
+
+func (p *PackageListEntry) UnmarshalControl(data string) error {
+	vals := strings.Fields(data)
+	if len(vals) < 4 {
+		return fmt.Errorf("Error: Unknown Package-List line: '%s'", data)
+	}
+
+	p.Name = vals[0]
+	p.Type = vals[1]
+	p.Section = vals[2]
+	p.Priority = vals[3]
+	p.Extra = map[string]string{}
+
+	for _, token := range vals[4:] {
+		els := strings.SplitN(token, "=", 2)
+		if len(els) == 2 {
+			p.Extra[els[0]] = els[1]
+		} else {
+			p.Extra[els[0]] = ""
+		}
+	}
+	return nil
+}
+
+func (p PackageListEntry) MarshalControl() (string, error) {
+	els := []string{p.Name, p.Type, p.Section, p.Priority}
+
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, key := range packageListExtraOrder {
+		if _, ok := p.Extra[key]; ok {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest := []string{}
+	for key := range p.Extra {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+
+	for _, key := range append(keys, rest...) {
+		if value := p.Extra[key]; value != "" {
+			els = append(els, key+"="+value)
+		} else {
+			els = append(els, key)
+		}
+	}
+	return strings.Join(els, " "), nil
+}
+
+// }}}
+
+// Sort the given DSC objects in place by Version, newest first. DSCs with
+// equal versions keep their order.
+func SortDSCByVersion(dscs []DSC) {
+	sort.Stable(dscsByVersion(dscs))
+}
+
+// dscsByVersion sorts DSCs newest first.
+type dscsByVersion []DSC
+
+func (a dscsByVersion) Len() int {
+	return len(a)
+}
+
+func (a dscsByVersion) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a dscsByVersion) Less(i, j int) bool {
+	return version.Compare(a[i].Version, a[j].Version) > 0
 }
 
 // Given a bunch of DSC objects, sort the packages topologically by
 // build order by looking at the relationship between the Build-Depends
 // field.
+//
+// When more than one source is ready to be built, they're ordered by
+// Source name, so the same set of sources always comes back in the same
+// order. BuildOrderOptions.Less can be used to break the ties some other
+// way.
+//
+// Once sorted, sources that Build-Conflict with a binary built by the
+// source right before them are moved further apart where that's possible
+// without breaking the build order, so that whatever the earlier source
+// left installed is less likely to be in the way.
 func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
+	return OrderDSCForBuildWithOptions(dscs, arch, BuildOrderOptions{})
+}
+
+// BuildOrderOptions controls which relationships OrderDSCForBuildWithOptions
+// and StageDSCForBuildWithOptions take into account.
+type BuildOrderOptions struct {
+	// ArchOnly orders the sources for building the architecture dependent
+	// packages only, so Build-Depends-Indep and Build-Conflicts-Indep are
+	// ignored, since the `all` packages are built separately.
+	ArchOnly bool
+
+	// Less decides which source goes first when more than one of them
+	// could be built next, returning true if a should be built before b.
+	// When nil, sources are ordered by Source name.
+	Less func(a, b DSC) bool
+}
+
+// OrderDSCForBuildWithOptions behaves like OrderDSCForBuild, but allows the
+// caller to leave the Build-Depends-Indep out of the build order.
+func OrderDSCForBuildWithOptions(dscs []DSC, arch dependency.Arch, options BuildOrderOptions) ([]DSC, error) {
+	ret, sourceMapping, buildDepends, err := sortDSCForBuild(dscs, arch, options)
+	if err != nil {
+		return nil, err
+	}
+	separateBuildConflicts(ret, buildDepends, sourceMapping, arch, options)
+	return ret, nil
+}
+
+// Given a bunch of DSC objects, group the packages into stages by looking
+// at the relationship between the Build-Depends field, so that everything
+// in a stage can be built at the same time. The 0th stage has the sources
+// that don't Build-Depend on any of the other sources, and each stage after
+// that only Build-Depends on sources in the stages before it.
+//
+// Within a stage, sources are in topological build order, the same as
+// OrderDSCForBuild before any Build-Conflicts are separated.
+func StageDSCForBuild(dscs []DSC, arch dependency.Arch) ([][]DSC, error) {
+	return StageDSCForBuildWithOptions(dscs, arch, BuildOrderOptions{})
+}
+
+// StageDSCForBuildWithOptions behaves like StageDSCForBuild, but allows the
+// caller to leave the Build-Depends-Indep out of the build order.
+func StageDSCForBuildWithOptions(dscs []DSC, arch dependency.Arch, options BuildOrderOptions) ([][]DSC, error) {
+	sorted, _, buildDepends, err := sortDSCForBuild(dscs, arch, options)
+	if err != nil {
+		return nil, err
+	}
+
+	/* Sources come after everything they Build-Depend on, so by the time
+	 * we get to a source, we know the stage of each of its Build-Depends. */
+	stages := map[string]int{}
+	ret := [][]DSC{}
+	for _, dsc := range sorted {
+		stage := 0
+		for dep := range buildDepends[dsc.Source] {
+			if stages[dep]+1 > stage {
+				stage = stages[dep] + 1
+			}
+		}
+		stages[dsc.Source] = stage
+		if stage == len(ret) {
+			ret = append(ret, []DSC{})
+		}
+		ret[stage] = append(ret[stage], dsc)
+	}
+	return ret, nil
+}
+
+// Topologically sort the sources by build order, returning the sorted
+// sources, along with the binary -> source mapping, and the sources each
+// source Build-Depends on.
+func sortDSCForBuild(dscs []DSC, arch dependency.Arch, options BuildOrderOptions) ([]DSC, map[string]string, map[string]map[string]bool, error) {
 	sourceMapping := map[string]string{}
-	network := topsort.NewNetwork()
+	buildDepends := map[string]map[string]bool{}
+	sources := map[string]DSC{}
+	names := []string{}
 	ret := []DSC{}
 
+	less := options.Less
+	if less == nil {
+		less = func(a, b DSC) bool { return a.Source < b.Source }
+	}
+
 	/*
 	 * - Create binary -> source mapping.
-	 * - Error if two sources provide the same binary
 	 * - Create a node for each source
 	 * - Create an edge from the source -> source
 	 * - return sorted list of dsc files
@@ -92,34 +340,284 @@ func OrderDSCForBuild(dscs []DSC, arch dependency.Arch) ([]DSC, error) {
 		for _, binary := range dsc.Binaries {
 			sourceMapping[binary] = dsc.Source
 		}
-		network.AddNode(dsc.Source, dsc)
+		if _, ok := sources[dsc.Source]; !ok {
+			names = append(names, dsc.Source)
+		}
+		sources[dsc.Source] = dsc
 	}
 
 	for _, dsc := range dscs {
 		concreteBuildDepends := []dependency.Possibility{}
 		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDepends.GetPossibilities(arch)...)
 		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsArch.GetPossibilities(arch)...)
-		concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsIndep.GetPossibilities(arch)...)
+		if !options.ArchOnly {
+			concreteBuildDepends = append(concreteBuildDepends, dsc.BuildDependsIndep.GetPossibilities(arch)...)
+		}
+		buildDepends[dsc.Source] = map[string]bool{}
 		for _, relation := range concreteBuildDepends {
-			if val, ok := sourceMapping[relation.Name]; ok {
-				err := network.AddEdge(val, dsc.Source)
-				if err != nil {
-					return nil, err
+			if val, ok := sourceMapping[relation.Name]; ok && val != dsc.Source {
+				buildDepends[dsc.Source][val] = true
+			}
+		}
+	}
+
+	/* Kahn's algorithm, always taking the first of the sources that are
+	 * ready to be built, so the order doesn't depend on map iteration. */
+	blockers := map[string]int{}
+	unblocks := map[string][]string{}
+	for _, name := range names {
+		blockers[name] = len(buildDepends[name])
+		for dep := range buildDepends[name] {
+			unblocks[dep] = append(unblocks[dep], name)
+		}
+	}
+
+	ready := []DSC{}
+	for _, name := range names {
+		if blockers[name] == 0 {
+			ready = append(ready, sources[name])
+		}
+	}
+
+	for len(ready) > 0 {
+		next := 0
+		for i := range ready {
+			if less(ready[i], ready[next]) {
+				next = i
+			}
+		}
+		dsc := ready[next]
+		ready = append(ready[:next], ready[next+1:]...)
+		ret = append(ret, dsc)
+
+		for _, name := range unblocks[dsc.Source] {
+			blockers[name]--
+			if blockers[name] == 0 {
+				ready = append(ready, sources[name])
+			}
+		}
+	}
+
+	if len(ret) != len(names) {
+		if cycle := findBuildDependsCycle(dscs, buildDepends); cycle != nil {
+			return nil, nil, nil, cycle
+		}
+		return nil, nil, nil, fmt.Errorf("Build-Depends cycle between sources")
+	}
+
+	return ret, sourceMapping, buildDepends, nil
+}
+
+// Return everything needed to build all of the given sources on the given
+// arch, with one Dependency: the Build-Depends, Build-Depends-Arch and
+// Build-Depends-Indep of each source, limited to the Possibilities that
+// apply to the arch, and then Normalized, so that a package several of the
+// sources need is only listed once, with the tightest version constraint.
+//
+// The architecture restrictions are dropped from the Possibilities that are
+// kept, since they've already been taken into account, and any Relation
+// without a Possibility for the arch is left out altogether. Substvars are
+// left out, too.
+func BuildDependsUnion(dscs []DSC, arch dependency.Arch) dependency.Dependency {
+	ret := dependency.Dependency{Relations: []dependency.Relation{}}
+	for _, dsc := range dscs {
+		for _, buildDepends := range []dependency.Dependency{
+			dsc.BuildDepends, dsc.BuildDependsArch, dsc.BuildDependsIndep,
+		} {
+			ret = ret.And(relationsForArch(buildDepends, arch))
+		}
+	}
+	return ret
+}
+
+// Split the Build-Depends, Build-Depends-Arch and Build-Depends-Indep of the
+// .dsc into the Relations the given installed packages satisfy, and those
+// they don't, when building on the given arch, so that the missing ones can
+// be reported. The installed packages are given as they are to
+// dependency.Dependency.SatisfiedBy.
+//
+// A Relation with alternatives is only unsatisfied if none of them is
+// installed. Alternatives restricted to other architectures are ignored,
+// as are substvars, and a Relation with nothing left after that is in
+// neither group.
+func (d *DSC) BuildDependsStatus(installed map[string]version.Version, arch dependency.Arch) (satisfied, unsatisfied []dependency.Relation) {
+	satisfied = []dependency.Relation{}
+	unsatisfied = []dependency.Relation{}
+
+	for _, buildDepends := range []dependency.Dependency{
+		d.BuildDepends, d.BuildDependsArch, d.BuildDependsIndep,
+	} {
+		for _, relation := range buildDepends.Relations {
+			single := dependency.Dependency{Relations: []dependency.Relation{relation}}
+			if len(relationsForArch(single, arch).Relations) == 0 {
+				continue
+			}
+			if ok, _ := single.SatisfiedBy(installed, arch); ok {
+				satisfied = append(satisfied, relation)
+			} else {
+				unsatisfied = append(unsatisfied, relation)
+			}
+		}
+	}
+	return satisfied, unsatisfied
+}
+
+// Return the Relations of the Dependency that apply on the given arch, with
+// only the Possibilities that do, and without their architecture
+// restrictions.
+func relationsForArch(dep dependency.Dependency, arch dependency.Arch) dependency.Dependency {
+	ret := dependency.Dependency{Relations: []dependency.Relation{}}
+	for _, relation := range dep.Relations {
+		possibilities := []dependency.Possibility{}
+		for _, possi := range relation.Possibilities {
+			if possi.Substvar || (possi.Architectures != nil && !possi.Architectures.Matches(&arch)) {
+				continue
+			}
+			possi.Architectures = &dependency.ArchSet{Architectures: []dependency.Arch{}}
+			possibilities = append(possibilities, possi)
+		}
+		if len(possibilities) > 0 {
+			ret.Relations = append(ret.Relations, dependency.Relation{Possibilities: possibilities})
+		}
+	}
+	return ret
+}
+
+// A CycleError is returned by OrderDSCForBuild and StageDSCForBuild when
+// the Build-Depends of the given sources form a loop, so there's no order
+// they can be built in.
+//
+// Sources contains the names of the sources in the loop, with each source
+// Build-Depending on a binary built by the next one, and the last source
+// Build-Depending on a binary built by the first one.
+type CycleError struct {
+	Sources []string
+}
+
+func (e CycleError) Error() string {
+	if len(e.Sources) == 0 {
+		return "Build-Depends cycle between sources"
+	}
+	return fmt.Sprintf(
+		"Build-Depends cycle between sources: %s -> %s",
+		strings.Join(e.Sources, " -> "),
+		e.Sources[0],
+	)
+}
+
+// Walk the source -> Build-Depends source mapping looking for a loop, and
+// return the first one found, or nil if there are no loops.
+func findBuildDependsCycle(dscs []DSC, buildDepends map[string]map[string]bool) *CycleError {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	stack := []string{}
+
+	var visit func(source string) *CycleError
+	visit = func(source string) *CycleError {
+		state[source] = visiting
+		stack = append(stack, source)
+
+		/* Iterate in the order the sources were given, so the same
+		 * set of sources always reports the same cycle. */
+		for _, dsc := range dscs {
+			dep := dsc.Source
+			if !buildDepends[source][dep] {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, el := range stack {
+					if el == dep {
+						return &CycleError{
+							Sources: append([]string{}, stack[i:]...),
+						}
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
 				}
 			}
 		}
+
+		stack = stack[:len(stack)-1]
+		state[source] = visited
+		return nil
 	}
 
-	nodes, err := network.Sort()
-	if err != nil {
-		return nil, err
+	for _, dsc := range dscs {
+		if state[dsc.Source] == unvisited {
+			if cycle := visit(dsc.Source); cycle != nil {
+				return cycle
+			}
+		}
 	}
+	return nil
+}
 
-	for _, node := range nodes {
-		ret = append(ret, node.Value.(DSC))
+// Check to see if either of the two sources Build-Conflicts with a binary
+// built by the other one.
+func buildConflicts(a, b DSC, sourceMapping map[string]string, arch dependency.Arch, options BuildOrderOptions) bool {
+	conflictsWith := func(dsc DSC, other string) bool {
+		conflicts := []dependency.Possibility{}
+		conflicts = append(conflicts, dsc.BuildConflicts.GetPossibilities(arch)...)
+		conflicts = append(conflicts, dsc.BuildConflictsArch.GetPossibilities(arch)...)
+		if !options.ArchOnly {
+			conflicts = append(conflicts, dsc.BuildConflictsIndep.GetPossibilities(arch)...)
+		}
+		for _, relation := range conflicts {
+			if sourceMapping[relation.Name] == other {
+				return true
+			}
+		}
+		return false
 	}
+	return conflictsWith(a, b.Source) || conflictsWith(b, a.Source)
+}
 
-	return ret, nil
+// Walk a topologically sorted list of sources, and when two neighbours
+// conflict, pull the closest later source in between them that doesn't
+// conflict either, and doesn't Build-Depend on anything it'd be moved
+// in front of. This keeps the list in a valid build order.
+func separateBuildConflicts(
+	dscs []DSC,
+	buildDepends map[string]map[string]bool,
+	sourceMapping map[string]string,
+	arch dependency.Arch,
+	options BuildOrderOptions,
+) {
+	for i := 0; i+1 < len(dscs); i++ {
+		if !buildConflicts(dscs[i], dscs[i+1], sourceMapping, arch, options) {
+			continue
+		}
+
+		for j := i + 2; j < len(dscs); j++ {
+			candidate := dscs[j]
+			if buildConflicts(dscs[i], candidate, sourceMapping, arch, options) ||
+				buildConflicts(candidate, dscs[i+1], sourceMapping, arch, options) {
+				continue
+			}
+
+			movable := true
+			for k := i + 1; k < j; k++ {
+				if buildDepends[candidate.Source][dscs[k].Source] {
+					movable = false
+					break
+				}
+			}
+			if !movable {
+				continue
+			}
+
+			copy(dscs[i+2:j+1], dscs[i+1:j])
+			dscs[i+1] = candidate
+			break
+		}
+	}
 }
 
 // Given a path on the filesystem, Parse the file off the disk and return
@@ -145,27 +643,276 @@ func ParseDscFile(path string) (ret *DSC, err error) {
 }
 
 // Given a bufio.Reader, consume the Reader, and return a DSC object
-// for use.
+// for use. Only the first Paragraph is read; anything after it is ignored
+// (see ParseDscWithOptions to reject it instead).
 func ParseDsc(reader *bufio.Reader, path string) (*DSC, error) {
+	return ParseDscWithOptions(reader, path, ParseOptions{})
+}
+
+// ParseOptions controls how strictly ParseDscWithOptions reads its input.
+type ParseOptions struct {
+	// Return an error if the first Paragraph is followed by anything
+	// other than blank lines, such as a second, stray Paragraph.
+	Strict bool
+}
+
+// ParseDscWithOptions behaves like ParseDsc, but allows the caller to
+// reject malformed input that ParseDsc would let through.
+func ParseDscWithOptions(reader *bufio.Reader, path string, options ParseOptions) (*DSC, error) {
 	ret := DSC{Filename: path}
-	err := Unmarshal(&ret, reader)
+	decoder, err := NewDecoder(reader, nil)
 	if err != nil {
 		return nil, err
 	}
+	if options.Strict {
+		decoder.RejectTrailingData()
+	}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
 	return &ret, nil
 }
 
+// Write the .dsc back out to the given io.Writer, with the fields in the
+// order dpkg-source would have written them in. Any changes made to the
+// members of the struct are written out, as are any fields that were
+// read in but aren't members of the struct (such as `X-*` fields).
+//
+// This will not write out an OpenPGP signature, even if the .dsc was
+// signed when it was read in.
+func (d *DSC) WriteTo(out io.Writer) (int64, error) {
+	para, err := ConvertToParagraph(d)
+	if err != nil {
+		return 0, err
+	}
+	ordered := para.orderedBy(dscFieldOrder)
+
+	writer := countingWriter{writer: out}
+	err = ordered.WriteTo(&writer)
+	return writer.count, err
+}
+
+// ErrNotSigned is returned by ParseDscSigned and ParseChangesSigned when the
+// document they were given isn't wrapped in an OpenPGP clearsignature at all.
+var ErrNotSigned = errors.New("Document is not OpenPGP clearsigned")
+
+// Given a bufio.Reader, consume the Reader, check the OpenPGP clearsignature
+// around the .dsc against the given keyring, and return the DSC object along
+// with the Entity that signed it.
+//
+// If the .dsc is not signed at all, ErrNotSigned is returned, so that
+// the caller may decide to fall back to ParseDsc if unsigned input is
+// acceptable. Any other problem with the signature (such as an unknown
+// signer, or a document that was modified after it was signed) is
+// returned as an error.
+func ParseDscSigned(reader *bufio.Reader, keyring openpgp.KeyRing, path string) (*DSC, *openpgp.Entity, error) {
+	ret, signer, _, err := ParseDscSignedData(reader, keyring, path)
+	return ret, signer, err
+}
+
+// ParseDscSignedData behaves like ParseDscSigned, but also returns the exact
+// bytes the signature covered, with the dash-escaping already undone. These
+// may be archived, or checked again later against another keyring.
+func ParseDscSignedData(reader *bufio.Reader, keyring openpgp.KeyRing, path string) (*DSC, *openpgp.Entity, []byte, error) {
+	ret := DSC{Filename: path}
+	signer, signed, err := decodeSigned(reader, keyring, &ret)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &ret, signer, signed, nil
+}
+
 // Check to see if this .dsc contains any arch:all binary packages along
 // with any arch dependent packages.
 func (d *DSC) HasArchAll() bool {
 	for _, arch := range d.Architectures {
-		if arch.CPU == "all" && arch.OS == "all" && arch.ABI == "all" {
+		if arch.IsAll() {
+			return true
+		}
+	}
+	return false
+}
+
+// A SourceFormat is the parsed form of the Format field of a .dsc, such as
+// `3.0 (quilt)`, which has a Major version of 3, a Minor version of 0 and
+// the "quilt" Variant. Formats without a variant, such as `1.0`, have an
+// empty Variant.
+type SourceFormat struct {
+	Major   int
+	Minor   int
+	Variant string
+}
+
+func (f SourceFormat) String() string {
+	if f.Variant == "" {
+		return fmt.Sprintf("%d.%d", f.Major, f.Minor)
+	}
+	return fmt.Sprintf("%d.%d (%s)", f.Major, f.Minor, f.Variant)
+}
+
+// Parse a source package format such as `3.0 (quilt)`. Extra whitespace
+// around the parts is ignored.
+func ParseSourceFormat(format string) (SourceFormat, error) {
+	ret := SourceFormat{}
+	format = strings.TrimSpace(format)
+
+	number := format
+	if i := strings.Index(format, "("); i >= 0 {
+		if !strings.HasSuffix(format, ")") {
+			return ret, fmt.Errorf("Malformed source format: '%s'", format)
+		}
+		number = strings.TrimSpace(format[:i])
+		ret.Variant = strings.TrimSpace(format[i+1 : len(format)-1])
+		if ret.Variant == "" {
+			return ret, fmt.Errorf("Malformed source format: '%s'", format)
+		}
+	}
+
+	if _, err := fmt.Sscanf(number, "%d.%d", &ret.Major, &ret.Minor); err != nil ||
+		fmt.Sprintf("%d.%d", ret.Major, ret.Minor) != number {
+		return SourceFormat{}, fmt.Errorf("Malformed source format: '%s'", format)
+	}
+	return ret, nil
+}
+
+// Parse the Format field of the .dsc. A .dsc without a Format field is
+// in the `1.0` format.
+func (d *DSC) SourceFormat() (SourceFormat, error) {
+	if strings.TrimSpace(d.Format) == "" {
+		return SourceFormat{Major: 1}, nil
+	}
+	return ParseSourceFormat(d.Format)
+}
+
+// Check to see if this is a native source package, which is to say the
+// `3.0 (native)` format, or the `1.0` format without a .diff.gz.
+func (d *DSC) IsNative() bool {
+	format, err := d.SourceFormat()
+	if err != nil {
+		return false
+	}
+	if format.Variant == "native" {
+		return true
+	}
+	if format.Major != 1 || format.Variant != "" {
+		return false
+	}
+	for _, file := range d.Files {
+		if strings.Contains(file.Filename, ".diff.") {
+			return false
+		}
+	}
+	return true
+}
+
+// Check to see if the .dsc can be built on the given architecture: that is,
+// if it's listed in the Architecture field, or matches one of the
+// wildcards (such as `any` or `linux-any`) there. The special `all` arch
+// is only supported if `all` is listed.
+func (d *DSC) SupportsArch(arch dependency.Arch) bool {
+	for _, el := range d.Architectures {
+		if el == arch || arch.Matches(el) {
 			return true
 		}
 	}
 	return false
 }
 
+// Reject a .dsc that lists the same architecture more than once. This is
+// called by Unmarshal once the .dsc has been read in.
+func (d *DSC) ValidateControl() error {
+	return checkDuplicateArchs(d.Architectures)
+}
+
+// Return an error naming the first architecture that's listed twice.
+func checkDuplicateArchs(archs []dependency.Arch) error {
+	for i, arch := range archs {
+		for _, other := range archs[:i] {
+			if arch.Equals(other) {
+				return fmt.Errorf("Architecture '%s' is listed more than once", arch)
+			}
+		}
+	}
+	return nil
+}
+
+// Check that the .dsc could be part of a source-only upload: it has to
+// build at least one binary package, list the architectures those are
+// built on (and not just `source`, which belongs in the Architecture of a
+// .changes, not a .dsc), and be in a source format the archive accepts
+// (`1.0`, `3.0 (native)` or `3.0 (quilt)`).
+func (d *DSC) SourceOnlyCompatible() bool {
+	hasBinary := false
+	for _, binary := range d.Binaries {
+		if strings.TrimSpace(binary) != "" {
+			hasBinary = true
+		}
+	}
+	if !hasBinary || len(d.Architectures) == 0 {
+		return false
+	}
+	for _, arch := range d.Architectures {
+		if arch.IsSource() {
+			return false
+		}
+	}
+
+	format, err := d.SourceFormat()
+	if err != nil {
+		return false
+	}
+	switch format.String() {
+	case "1.0", "3.0 (native)", "3.0 (quilt)":
+		return true
+	default:
+		return false
+	}
+}
+
+// Return the names of the binary packages from the Package-List that would
+// be built on the given architecture, honoring each entry's arch=
+// restriction. Entries without an arch= restriction fall back to the
+// Architecture field of the .dsc. arch:all packages are only returned
+// when arch is itself "all", the arch-all builder.
+func (d *DSC) BinariesForArch(arch dependency.Arch) []string {
+	ret := []string{}
+	for _, entry := range d.PackageList {
+		archs := d.Architectures
+		if value, ok := entry.Extra["arch"]; ok {
+			archs = []dependency.Arch{}
+			for _, name := range strings.Split(value, ",") {
+				pattern, err := dependency.ParseArch(strings.TrimSpace(name))
+				if err != nil {
+					continue
+				}
+				archs = append(archs, *pattern)
+			}
+		}
+		for _, pattern := range archs {
+			if arch.Matches(pattern) {
+				ret = append(ret, entry.Name)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// Parse the Vcs-Git field of the .dsc into the repository URL, and the
+// optional branch and path within that repository.
+func (d *DSC) GitLocation() (*GitLocation, error) {
+	if d.VcsGit == "" {
+		return nil, fmt.Errorf("No Vcs-Git field in %s", d.Filename)
+	}
+	return ParseGitLocation(d.VcsGit)
+}
+
+// Parse the Dgit field of the .dsc, as ParseDgit does. A .dsc without a
+// Dgit field gives the zero DgitInfo.
+func (d *DSC) ParsedDgit() (DgitInfo, error) {
+	return ParseDgit(d.Dgit)
+}
+
 // Return a list of all entities that are responsible for the package's
 // well being. The 0th element is always the package's Maintainer,
 // with any Uploaders following.
@@ -173,6 +920,151 @@ func (d *DSC) Maintainers() []string {
 	return append([]string{d.Maintainer}, d.Uploaders...)
 }
 
+// Return the Maintainers, parsed into a Name and Email by ParseMaintainer.
+// An error is returned if any of them isn't a well formed `Name <email>`.
+func (d *DSC) ParsedMaintainers() ([]Maintainer, error) {
+	return parseMaintainers(d.Maintainers())
+}
+
+// Parse the Standards-Version of the .dsc, so that it can be compared to
+// the current version of Debian policy using version.Version.Behind.
+func (d *DSC) StandardsVersionParsed() (version.Version, error) {
+	return version.ParseStandardsVersion(d.StandardsVersion)
+}
+
+// Return the directory the source package lives in within the archive,
+// relative to the root of the mirror, given the component it's in (such as
+// `main`). This follows the Debian pool layout: `pool/main/h/hello` for
+// most packages, but `pool/main/libf/libfoo` for packages whose name starts
+// with `lib`, since there are so many of them. As with the Directory of a
+// SourceIndex, there's no trailing slash.
+func (d *DSC) PoolDirectory(component string) string {
+	return path.Join("pool", component, poolPrefix(d.Source), d.Source)
+}
+
+// Return the stanza for the source package as it would be listed in a
+// Sources index, with the package living in the given directory of the
+// archive (such as the one PoolDirectory returns). The Source field
+// becomes Package, Directory is added, and the .dsc itself is hashed and
+// listed first in the Files field, and in each of the Checksums-* fields
+// the .dsc has, as it's one of the files making up the source package in
+// the archive, even though it can't list itself. Fields without a member
+// of their own on the SourceIndex (such as Testsuite or Package-List) are
+// carried over as they are.
+//
+// The .dsc is read from the Filename of the DSC, so an error is returned
+// if it isn't set or can't be read.
+func (d *DSC) ToSourceIndex(directory string) (SourceIndex, error) {
+	if d.Filename == "" {
+		return SourceIndex{}, fmt.Errorf("No Filename set for the .dsc of %s", d.Source)
+	}
+
+	hashes, err := HashFileAlgorithms(d.Filename, []string{"md5", "sha1", "sha256", "sha512"})
+	if err != nil {
+		return SourceIndex{}, err
+	}
+
+	para, err := ConvertToParagraph(d)
+	if err != nil {
+		return SourceIndex{}, err
+	}
+	if found, ok := para.lookup("Source"); ok {
+		para.rename(found, "Package")
+	}
+	if found, ok := para.lookup("Checksums-Sha512"); ok && len(d.ChecksumsSha512) > 0 {
+		line, err := SHA512FileHash{hashes[3]}.MarshalControl()
+		if err != nil {
+			return SourceIndex{}, err
+		}
+		para.Values[found] = "\n" + line + para.Values[found]
+	}
+
+	uploaders := []string{}
+	for _, uploader := range d.Uploaders {
+		uploaders = append(uploaders, strings.TrimSpace(uploader))
+	}
+
+	index := SourceIndex{
+		Paragraph: *para,
+
+		Package:  d.Source,
+		Binaries: d.Binaries,
+
+		Version:    d.Version,
+		Maintainer: d.Maintainer,
+		Uploaders:  strings.Join(uploaders, ", "),
+
+		Architecture: d.Architectures,
+
+		StandardsVersion: d.StandardsVersion,
+		Format:           d.Format,
+		VcsBrowser:       d.VcsBrowser,
+		VcsGit:           d.VcsGit,
+		VcsSvn:           d.VcsSvn,
+		VcsBzr:           d.VcsBzr,
+		Homepage:         d.Homepage,
+		Directory:        directory,
+
+		BuildDepends:      d.BuildDepends,
+		BuildDependsArch:  d.BuildDependsArch,
+		BuildDependsIndep: d.BuildDependsIndep,
+
+		Files: append([]MD5FileHash{{FileHash: hashes[0]}}, d.Files...),
+	}
+	if len(d.ChecksumsSha1) > 0 {
+		index.ChecksumsSha1 = append([]SHA1FileHash{{hashes[1]}}, d.ChecksumsSha1...)
+	}
+	if len(d.ChecksumsSha256) > 0 {
+		index.ChecksumsSha256 = append([]SHA256FileHash{{hashes[2]}}, d.ChecksumsSha256...)
+	}
+	return index, nil
+}
+
+// Return the directory under the component that the pool puts the source
+// package in.
+func poolPrefix(source string) string {
+	switch {
+	case source == "":
+		return ""
+	case source == "lib":
+		/* As with dak, which takes the first four letters */
+		return source
+	case strings.HasPrefix(source, "lib"):
+		return source[:4]
+	default:
+		return source[:1]
+	}
+}
+
+// Return the fields of the .dsc that derivative distributions add, and
+// which have no member of their own on the DSC struct: `Bugs`, and any
+// field with an `X-` style prefix (such as `X-Ubuntu-Original-Maintainer`
+// or `XS-Go-Import-Path`). The map is keyed on the field name as it was
+// read in.
+//
+// These fields are kept in the Paragraph member, so they're written back
+// out by WriteTo (and Marshal); changing the returned map doesn't change
+// the .dsc.
+func (d *DSC) Extras() map[string]string {
+	ret := map[string]string{}
+	for _, key := range d.Paragraph.Order {
+		if strings.EqualFold(key, "Bugs") || isExtensionField(key) {
+			ret[key] = d.Paragraph.Values[key]
+		}
+	}
+	return ret
+}
+
+// Check if the field name has an `X-` prefix, or one of the `X[BCS]+-`
+// prefixes dpkg uses to say which files a user defined field is copied to.
+func isExtensionField(key string) bool {
+	dash := strings.Index(key, "-")
+	if dash < 1 || (key[0] != 'X' && key[0] != 'x') {
+		return false
+	}
+	return strings.Trim(strings.ToUpper(key[1:dash]), "BCS") == ""
+}
+
 // Return a list of MD5FileHash entries from the `dsc.Files`
 // entry, with the exception that each `Filename` will be joined to the root
 // directory of the DSC file.
@@ -188,6 +1080,353 @@ func (d *DSC) AbsFiles() []MD5FileHash {
 	return ret
 }
 
+// Check that every file listed in the Files field of the .dsc exists next
+// to it, without reading any of them, and return the names (as listed) of
+// those that don't. This is a cheap check to make before Validate, which
+// hashes every file. An error is only returned if a file couldn't be
+// checked for some reason other than it not being there.
+func (d *DSC) FilesPresent() (missing []string, err error) {
+	missing = []string{}
+	for i, file := range d.AbsFiles() {
+		if _, err := os.Stat(file.Filename); os.IsNotExist(err) {
+			missing = append(missing, d.Files[i].Filename)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// Check that every file referenced by the .dsc exists next to it, and that
+// the size and the hashes listed in the Files, Checksums-Sha1,
+// Checksums-Sha256 and Checksums-Sha512 fields match what's on disk. A
+// file that is listed in one of those fields but not in another is also
+// treated as an error, since there would be no way to check it against the
+// missing hash.
+//
+// Fields that are entirely absent (as is the case for some older .dsc
+// files without Checksums-* fields) are skipped.
+func (d *DSC) Validate() error {
+	return d.ValidateContext(context.Background())
+}
+
+// ValidateContext behaves like Validate, but checks ctx between files and
+// while each one is being hashed, returning ctx.Err() promptly on
+// cancellation, so that a huge file can't keep it busy.
+func (d *DSC) ValidateContext(ctx context.Context) error {
+	return validateChecksums(ctx, d.Filename, d.checksumSections())
+}
+
+// Return the Files and Checksums-* fields of the .dsc, weakest first.
+func (d *DSC) checksumSections() []checksumSection {
+	return []checksumSection{
+		{"Files", "md5", checksumsOf(d.Files)},
+		{"Checksums-Sha1", "sha1", checksumsOf(d.ChecksumsSha1)},
+		{"Checksums-Sha256", "sha256", checksumsOf(d.ChecksumsSha256)},
+		{"Checksums-Sha512", "sha512", checksumsOf(d.ChecksumsSha512)},
+	}
+}
+
+// Return every entry of the Files and Checksums-* fields, in that order.
+func (d *DSC) Checksums() []Checksum {
+	ret := checksumsOf(d.Files)
+	ret = append(ret, checksumsOf(d.ChecksumsSha1)...)
+	ret = append(ret, checksumsOf(d.ChecksumsSha256)...)
+	return append(ret, checksumsOf(d.ChecksumsSha512)...)
+}
+
+// Return the Files and Checksums-* fields of the .dsc joined together by
+// filename, so that the size and every hash of a file can be looked at in
+// one go. See FileEntry for how files that aren't listed in every field
+// are flagged.
+func (d *DSC) FileSet() map[string]FileEntry {
+	return fileSet(d.checksumSections())
+}
+
+// Check the named file, which must be listed in the .dsc and exist next to
+// it, against the strongest hash listed for it, preferring SHA512 over
+// SHA256 over SHA1 over MD5. The weaker hashes that are listed are checked
+// too, and if they don't agree with the strongest one, that's an error,
+// since a file with conflicting hashes is either corrupt or tampered with.
+func (d *DSC) VerifyFile(name string) error {
+	/* The algorithm comes from the field, not the entry, since entries
+	 * put together by hand don't necessarily have one set. */
+	listed := []Checksum{}
+	algorithms := []string{}
+	sections := d.checksumSections()
+	for i := len(sections) - 1; i >= 0; i-- {
+		for _, checksum := range sections[i].hashes {
+			if checksum.Path() == name {
+				listed = append(listed, checksum)
+				algorithms = append(algorithms, sections[i].algorithm)
+			}
+		}
+	}
+	if len(listed) == 0 {
+		return fmt.Errorf("File '%s' is not listed in %s", name, d.Filename)
+	}
+	hashers, err := hashFile(context.Background(), path.Join(filepath.Dir(d.Filename), name), algorithms)
+	if err != nil {
+		return err
+	}
+
+	strongest := listed[0]
+	if hashers[0].Size() != strongest.FileSize() {
+		return fmt.Errorf(
+			"Size mismatch for '%s': expected %d, got %d",
+			name, strongest.FileSize(), hashers[0].Size(),
+		)
+	}
+	if got := fmt.Sprintf("%x", hashers[0].Sum(nil)); got != strongest.HashValue() {
+		return fmt.Errorf(
+			"Hash mismatch for '%s' (%s): expected %s, got %s",
+			name, algorithms[0], strongest.HashValue(), got,
+		)
+	}
+
+	for i, checksum := range listed[1:] {
+		hasher := hashers[i+1]
+		if checksum.FileSize() != strongest.FileSize() ||
+			fmt.Sprintf("%x", hasher.Sum(nil)) != checksum.HashValue() {
+			return fmt.Errorf(
+				"Conflicting hashes for '%s': the %s hash matches, but the %s hash doesn't",
+				name, algorithms[0], algorithms[i+1],
+			)
+		}
+	}
+	return nil
+}
+
+// checksumSection is one of the fields listing the files referenced by a
+// .dsc or .changes. All the entries of a field use the same algorithm,
+// which is fixed by the field rather than taken from the entries, as
+// entries put together in code may well have no Algorithm set.
+type checksumSection struct {
+	name      string
+	algorithm string
+	hashes    []Checksum
+}
+
+// A FileEntry is everything the Files and Checksums-* fields of a .dsc or
+// .changes list for a single file. A hash is left empty if no field with
+// that algorithm lists the file.
+type FileEntry struct {
+	Filename string
+	Size     int64
+
+	MD5    string
+	SHA1   string
+	SHA256 string
+	SHA512 string
+
+	// Missing has the names of the fields (such as "Checksums-Sha256")
+	// that list other files but not this one. Fields that aren't there
+	// at all don't count, as is the case for older files without any
+	// Checksums-* fields.
+	Missing []string
+
+	// SizeMismatch is set when the fields don't agree on the size of the
+	// file, in which case Size is the one listed in the first of them.
+	SizeMismatch bool
+}
+
+// Check if the file is listed in every field that's there, with the same
+// size in each.
+func (e FileEntry) Consistent() bool {
+	return len(e.Missing) == 0 && !e.SizeMismatch
+}
+
+// Join the entries of the given sections by filename. See FileEntry.
+func fileSet(sections []checksumSection) map[string]FileEntry {
+	ret := map[string]FileEntry{}
+	for _, section := range sections {
+		for _, hash := range section.hashes {
+			entry, ok := ret[hash.Path()]
+			if !ok {
+				entry = FileEntry{Filename: hash.Path(), Size: hash.FileSize()}
+			} else if entry.Size != hash.FileSize() {
+				entry.SizeMismatch = true
+			}
+			switch section.algorithm {
+			case "md5":
+				entry.MD5 = hash.HashValue()
+			case "sha1":
+				entry.SHA1 = hash.HashValue()
+			case "sha256":
+				entry.SHA256 = hash.HashValue()
+			case "sha512":
+				entry.SHA512 = hash.HashValue()
+			}
+			ret[hash.Path()] = entry
+		}
+	}
+
+	for _, section := range sections {
+		if len(section.hashes) == 0 {
+			continue
+		}
+		listed := map[string]bool{}
+		for _, hash := range section.hashes {
+			listed[hash.Path()] = true
+		}
+		for filename, entry := range ret {
+			if !listed[filename] {
+				entry.Missing = append(entry.Missing, section.name)
+				ret[filename] = entry
+			}
+		}
+	}
+	return ret
+}
+
+// Check the files listed in the given sections, relative to the directory
+// of the file at filename, against what's on disk. See DSC.Validate for
+// the rules.
+func validateChecksums(ctx context.Context, filename string, sections []checksumSection) error {
+	/* Fields that weren't given at all don't count */
+	given := []checksumSection{}
+	for _, section := range sections {
+		if len(section.hashes) > 0 {
+			given = append(given, section)
+		}
+	}
+	sections = given
+
+	if len(sections) == 0 {
+		return fmt.Errorf("No files listed in %s", filename)
+	}
+
+	/* Make sure every section lists the same set of files before we go
+	 * and hit the disk. */
+	listed := map[string]map[string]Checksum{}
+	for _, section := range sections {
+		listed[section.name] = map[string]Checksum{}
+		for _, hash := range section.hashes {
+			listed[section.name][hash.Path()] = hash
+		}
+	}
+	for _, section := range sections {
+		for _, other := range sections {
+			for filename := range listed[section.name] {
+				if _, ok := listed[other.name][filename]; !ok {
+					return fmt.Errorf(
+						"File '%s' is listed in %s but not in %s",
+						filename, section.name, other.name,
+					)
+				}
+			}
+		}
+	}
+
+	algorithms := []string{}
+	for _, section := range sections {
+		algorithms = append(algorithms, section.algorithm)
+	}
+
+	baseDir := filepath.Dir(filename)
+	for _, hash := range sections[0].hashes {
+		filename := hash.Path()
+		hashers, err := hashFile(ctx, path.Join(baseDir, filename), algorithms)
+		if err != nil {
+			return err
+		}
+
+		for i, section := range sections {
+			expected := listed[section.name][filename]
+			hasher := hashers[i]
+			if hasher.Size() != expected.FileSize() {
+				return fmt.Errorf(
+					"Size mismatch for '%s' in %s: expected %d, got %d",
+					filename, section.name, expected.FileSize(), hasher.Size(),
+				)
+			}
+			if got := fmt.Sprintf("%x", hasher.Sum(nil)); got != expected.HashValue() {
+				return fmt.Errorf(
+					"Hash mismatch for '%s' in %s: expected %s, got %s",
+					filename, section.name, expected.HashValue(), got,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// How much of a file hashFile reads in between checking its context.
+const hashChunkSize = 4 << 20
+
+// Read the file at the given path, and return a Hasher for each of the
+// requested algorithms, in the same order.
+func hashFile(ctx context.Context, path string, algorithms []string) ([]*hashio.Hasher, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Referenced file '%s' is missing", path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	writer, hashers, err := hashio.NewHasherWriters(algorithms, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, hashChunkSize)
+	if _, err := io.CopyBuffer(writer, internal.ContextReader(ctx, f), buf); err != nil {
+		return nil, err
+	}
+	return hashers, nil
+}
+
+// Return the total size, in bytes, of all the files referenced by the
+// .dsc, as listed in the Files field. This does not touch the disk, so it
+// can be used to find out how much there is to download before fetching
+// the source package. The size of the .dsc itself is not included.
+func (d *DSC) TotalSize() (int64, error) {
+	if len(d.Files) == 0 {
+		return 0, fmt.Errorf("No files listed in %s", d.Filename)
+	}
+
+	var total int64
+	for _, file := range d.Files {
+		if file.Size < 0 {
+			return 0, fmt.Errorf("Negative size listed for '%s'", file.Filename)
+		}
+		total += file.Size
+	}
+	return total, nil
+}
+
+// Return the total size, in bytes, of all the files referenced by the
+// .dsc, as found on disk next to the .dsc. This will error out if any of
+// the files are missing. If this doesn't match TotalSize, one of the files
+// is likely truncated.
+func (d *DSC) TotalSizeOnDisk() (int64, error) {
+	if len(d.Files) == 0 {
+		return 0, fmt.Errorf("No files listed in %s", d.Filename)
+	}
+
+	var total int64
+	for _, file := range d.AbsFiles() {
+		info, err := os.Stat(file.Filename)
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
+
+// CopyOptions controls how DSC.CopyWithOptions transfers files.
+type CopyOptions struct {
+	// PreserveTimes carries the modification time of each file over to
+	// the copy. Permission bits are always preserved.
+	PreserveTimes bool
+}
+
 // Copy the .dsc file and all referenced files to the directory
 // listed by the dest argument. This function will error out if the dest
 // argument is not a directory, or if there is an IO operation in transfer.
@@ -196,13 +1435,59 @@ func (d *DSC) AbsFiles() []MD5FileHash {
 // be used to move something into an incoming directory with an inotify
 // hook. This will also mutate DSC.Filename to match the new location.
 func (d *DSC) Copy(dest string) error {
+	return d.CopyWithOptions(dest, CopyOptions{})
+}
+
+// CopyWithOptions behaves like Copy, but allows the caller to control
+// whether file timestamps are preserved, which is useful when staging
+// source packages for reproducible workflows.
+func (d *DSC) CopyWithOptions(dest string, options CopyOptions) error {
+	return d.copyContext(context.Background(), dest, options)
+}
+
+// CopyContext behaves like Copy, but checks ctx between files and during
+// each transfer, returning ctx.Err() promptly on cancellation. A file that
+// was only partially written when the copy was cancelled is removed.
+func (d *DSC) CopyContext(ctx context.Context, dest string) error {
+	return d.copyContext(ctx, dest, CopyOptions{})
+}
+
+func (d *DSC) copyContext(ctx context.Context, dest string, options CopyOptions) error {
 	if file, err := os.Stat(dest); err == nil && !file.IsDir() {
 		return fmt.Errorf("Attempting to move .dsc to a non-directory")
 	}
 
 	for _, file := range d.AbsFiles() {
 		dirname := filepath.Base(file.Filename)
-		err := internal.Copy(file.Filename, dest+"/"+dirname)
+		err := internal.CopyContext(ctx, file.Filename, dest+"/"+dirname, options.PreserveTimes)
+		if err != nil {
+			return err
+		}
+	}
+
+	dirname := filepath.Base(d.Filename)
+	err := internal.CopyContext(ctx, d.Filename, dest+"/"+dirname, options.PreserveTimes)
+	d.Filename = dest + "/" + dirname
+	return err
+}
+
+// Link all files referenced by the .dsc into the directory listed by the
+// dest argument, and Copy the .dsc file itself. Files are hardlinked where
+// possible, and symlinked if dest is on another filesystem. This function
+// will error out if the dest argument is not a directory, or if there is an
+// IO operation in transfer.
+//
+// This function will always copy .dsc last, making it suitable to
+// be used to move something into an incoming directory with an inotify
+// hook. This will also mutate DSC.Filename to match the new location.
+func (d *DSC) Link(dest string) error {
+	if file, err := os.Stat(dest); err == nil && !file.IsDir() {
+		return fmt.Errorf("Attempting to link .dsc to a non-directory")
+	}
+
+	for _, file := range d.AbsFiles() {
+		dirname := filepath.Base(file.Filename)
+		err := internal.Link(file.Filename, dest+"/"+dirname)
 		if err != nil {
 			return err
 		}
@@ -217,25 +1502,33 @@ func (d *DSC) Copy(dest string) error {
 // Move the .dsc file and all referenced files to the directory
 // listed by the dest argument. This function will error out if the dest
 // argument is not a directory, or if there is an IO operation in transfer.
+// If dest is on another filesystem, files are copied (preserving mode and
+// modification time) and the originals removed.
 //
 // This function will always move .dsc last, making it suitable to
 // be used to move something into an incoming directory with an inotify
 // hook. This will also mutate DSC.Filename to match the new location.
 func (d *DSC) Move(dest string) error {
+	return d.MoveContext(context.Background(), dest)
+}
+
+// MoveContext behaves like Move, but checks ctx between files and during
+// any cross-filesystem copy, returning ctx.Err() promptly on cancellation.
+func (d *DSC) MoveContext(ctx context.Context, dest string) error {
 	if file, err := os.Stat(dest); err == nil && !file.IsDir() {
 		return fmt.Errorf("Attempting to move .dsc to a non-directory")
 	}
 
 	for _, file := range d.AbsFiles() {
 		dirname := filepath.Base(file.Filename)
-		err := os.Rename(file.Filename, dest+"/"+dirname)
+		err := internal.MoveContext(ctx, file.Filename, dest+"/"+dirname)
 		if err != nil {
 			return err
 		}
 	}
 
 	dirname := filepath.Base(d.Filename)
-	err := os.Rename(d.Filename, dest+"/"+dirname)
+	err := internal.MoveContext(ctx, d.Filename, dest+"/"+dirname)
 	d.Filename = dest + "/" + dirname
 	return err
 }
@@ -264,4 +1557,146 @@ func (d *DSC) DebianSource() (string, error) {
 	return "", fmt.Errorf("Could not find the Debian source")
 }
 
+// DiffDSC {{{
+
+// A FieldChange is a field whose value differs between two DSCs.
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// A DSCDiff describes how the DSC `b` differs from the DSC `a`, as
+// returned by DiffDSC.
+type DSCDiff struct {
+	OldVersion version.Version
+	NewVersion version.Version
+
+	// The result of version.Compare(NewVersion, OldVersion), so this is
+	// greater than 0 if `b` is newer than `a`.
+	VersionDelta int
+
+	AddedFields   []string
+	RemovedFields []string
+
+	// Fields with a different value in `b`, other than Build-Depends,
+	// Files and the Checksums-* fields, which are broken down below.
+	ChangedFields []FieldChange
+
+	AddedBuildDepends   []dependency.Relation
+	RemovedBuildDepends []dependency.Relation
+
+	// Files are compared by Filename and MD5 hash, so a file that changed
+	// contents is both removed and added.
+	AddedFiles   []MD5FileHash
+	RemovedFiles []MD5FileHash
+}
+
+// Return true if the two DSCs have no differences at all.
+func (d DSCDiff) Empty() bool {
+	return d.VersionDelta == 0 &&
+		len(d.AddedFields) == 0 && len(d.RemovedFields) == 0 &&
+		len(d.ChangedFields) == 0 &&
+		len(d.AddedBuildDepends) == 0 && len(d.RemovedBuildDepends) == 0 &&
+		len(d.AddedFiles) == 0 && len(d.RemovedFiles) == 0
+}
+
+// Fields that DiffDSC reports on by their contents, rather than as a
+// FieldChange.
+var dscDiffSpecialFields = map[string]bool{
+	"build-depends":    true,
+	"files":            true,
+	"checksums-sha1":   true,
+	"checksums-sha256": true,
+	"checksums-sha512": true,
+}
+
+// Compare two DSCs, such as two versions of the same source package, and
+// return the changes from `a` to `b`. Fields are compared the way they'd
+// be written out by Marshal, without regard to the case of field names.
+func DiffDSC(a, b DSC) DSCDiff {
+	ret := DSCDiff{
+		OldVersion:   a.Version,
+		NewVersion:   b.Version,
+		VersionDelta: version.Compare(b.Version, a.Version),
+	}
+
+	before := dscDiffParagraph(&a)
+	after := dscDiffParagraph(&b)
+
+	for _, key := range before.Order {
+		if dscDiffSpecialFields[strings.ToLower(key)] {
+			continue
+		}
+		value, found := after.Get(key)
+		if !found {
+			ret.RemovedFields = append(ret.RemovedFields, key)
+		} else if value != before.Values[key] {
+			ret.ChangedFields = append(ret.ChangedFields, FieldChange{
+				Field: key,
+				Old:   before.Values[key],
+				New:   value,
+			})
+		}
+	}
+	for _, key := range after.Order {
+		if dscDiffSpecialFields[strings.ToLower(key)] {
+			continue
+		}
+		if _, found := before.Get(key); !found {
+			ret.AddedFields = append(ret.AddedFields, key)
+		}
+	}
+
+	ret.AddedBuildDepends = relationsMissingFrom(b.BuildDepends, a.BuildDepends)
+	ret.RemovedBuildDepends = relationsMissingFrom(a.BuildDepends, b.BuildDepends)
+
+	ret.AddedFiles = filesMissingFrom(b.Files, a.Files)
+	ret.RemovedFiles = filesMissingFrom(a.Files, b.Files)
+
+	return ret
+}
+
+// Return the DSC as a Paragraph, the way it'd be written out. If it can't
+// be converted, fall back to the Paragraph it was parsed from.
+func dscDiffParagraph(dsc *DSC) Paragraph {
+	para, err := ConvertToParagraph(dsc)
+	if err != nil {
+		return dsc.Paragraph
+	}
+	return *para
+}
+
+// Return the Relations in `dep` that aren't in `other`.
+func relationsMissingFrom(dep, other dependency.Dependency) []dependency.Relation {
+	seen := map[string]bool{}
+	for _, relation := range other.Relations {
+		seen[relation.String()] = true
+	}
+	ret := []dependency.Relation{}
+	for _, relation := range dep.Relations {
+		if !seen[relation.String()] {
+			ret = append(ret, relation)
+		}
+	}
+	return ret
+}
+
+// Return the files in `files` that aren't in `other`, by Filename and hash.
+func filesMissingFrom(files, other []MD5FileHash) []MD5FileHash {
+	seen := map[string]bool{}
+	for _, file := range other {
+		seen[file.Filename+" "+file.Hash] = true
+	}
+	ret := []MD5FileHash{}
+	for _, file := range files {
+		if !seen[file.Filename+" "+file.Hash] {
+			ret = append(ret, file)
+		}
+	}
+	return ret
+}
+
+// }}}
+
 // vim: foldmethod=marker
@@ -22,10 +22,26 @@ package control_test
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cinello/go-debian/control"
+	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/version"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
 )
 
 /*
@@ -79,6 +95,272 @@ Files:
 	assert(t, debianSource == "fbautostart_2.718281828-1.debian.tar.xz")
 }
 
+func TestDSCParseBOM(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("\xef\xbb\xbf" + `Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+ f58c0e0bf4d56461e776232484c07301 2356 fbautostart_2.718281828-1.debian.tar.xz
+`))
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, c.Format == "3.0 (quilt)")
+	assert(t, c.Source == "fbautostart")
+	assert(t, len(c.Files) == 2)
+
+	_, found := c.Paragraph.Get("Format")
+	assert(t, found)
+}
+
+func TestDSCParseTrailingData(t *testing.T) {
+	dsc := `Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+`
+	strict := control.ParseOptions{Strict: true}
+
+	c, err := control.ParseDscWithOptions(bufio.NewReader(strings.NewReader(dsc+"\n  \n\t\n")), "", strict)
+	isok(t, err)
+	assert(t, c.Source == "fbautostart")
+
+	trailer := dsc + "\nSource: stray\n"
+	c, err = control.ParseDsc(bufio.NewReader(strings.NewReader(trailer)), "")
+	isok(t, err)
+	assert(t, c.Source == "fbautostart")
+
+	_, err = control.ParseDscWithOptions(bufio.NewReader(strings.NewReader(trailer)), "", strict)
+	notok(t, err)
+	uerr, ok := err.(*control.UnmarshalError)
+	assert(t, ok)
+	assert(t, uerr.Paragraph == 1 && uerr.Line == 6)
+}
+
+func TestDSCExtras(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1ubuntu1
+Origin: Ubuntu
+Maintainer: Ubuntu Developers <ubuntu-devel-discuss@lists.ubuntu.com>
+XSBC-Original-Maintainer: Paul Tagliamonte <paultag@debian.org>
+X-Ubuntu-Use-Langpack: yes
+Bugs: https://bugs.launchpad.net/ubuntu/+filebug
+Xtra-Field: no
+`))
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, c.Origin == "Ubuntu")
+
+	extras := c.Extras()
+	assert(t, len(extras) == 3)
+	assert(t, extras["Bugs"] == "https://bugs.launchpad.net/ubuntu/+filebug")
+	assert(t, extras["XSBC-Original-Maintainer"] == "Paul Tagliamonte <paultag@debian.org>")
+	assert(t, extras["X-Ubuntu-Use-Langpack"] == "yes")
+
+	out := bytes.Buffer{}
+	_, err = c.WriteTo(&out)
+	isok(t, err)
+	d, err := control.ParseDsc(bufio.NewReader(&out), "")
+	isok(t, err)
+	assert(t, len(d.Extras()) == 3)
+	for key, value := range extras {
+		assert(t, d.Extras()[key] == value)
+	}
+}
+
+func TestDSCPoolDirectory(t *testing.T) {
+	for source, expected := range map[string]string{
+		"hello":  "pool/main/h/hello",
+		"libfoo": "pool/main/libf/libfoo",
+		"lib":    "pool/main/lib/lib",
+		"0ad":    "pool/main/0/0ad",
+	} {
+		dsc := control.DSC{Source: source}
+		assert(t, dsc.PoolDirectory("main") == expected)
+	}
+	dsc := control.DSC{Source: "libc6"}
+	assert(t, dsc.PoolDirectory("non-free/contrib") == "pool/non-free/contrib/libc/libc6")
+}
+
+func TestDSCSourceOnlyCompatible(t *testing.T) {
+	parse := func(fields string) *control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Version: 2.718281828-1
+`+fields)), "")
+		isok(t, err)
+		return c
+	}
+
+	assert(t, parse("Format: 3.0 (quilt)\nBinary: fbautostart\nArchitecture: any\n").SourceOnlyCompatible())
+	assert(t, parse("Binary: fbautostart\nArchitecture: all\n").SourceOnlyCompatible())
+	assert(t, !parse("Format: 3.0 (quilt)\nArchitecture: any\n").SourceOnlyCompatible())
+	assert(t, !parse("Format: 3.0 (quilt)\nBinary: fbautostart\n").SourceOnlyCompatible())
+	assert(t, !parse("Format: 3.0 (quilt)\nBinary: fbautostart\nArchitecture: source\n").SourceOnlyCompatible())
+	assert(t, !parse("Format: 3.0 (git)\nBinary: fbautostart\nArchitecture: any\n").SourceOnlyCompatible())
+	assert(t, !parse("Format: 3.0 quilt\nBinary: fbautostart\nArchitecture: any\n").SourceOnlyCompatible())
+}
+
+func TestDSCSupportsArch(t *testing.T) {
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Architecture: linux-any kfreebsd-i386 all
+`)), "")
+	isok(t, err)
+	assert(t, len(c.Architectures) == 3)
+	assert(t, c.Architectures[0].String() == "linux-any")
+	assert(t, c.Architectures[2].String() == "all")
+
+	for arch, supported := range map[string]bool{
+		"amd64":          true,
+		"all":            true,
+		"linux-any":      true,
+		"kfreebsd-i386":  true,
+		"kfreebsd-amd64": false,
+		"any":            false,
+		"source":         false,
+	} {
+		parsed, err := dependency.ParseArch(arch)
+		isok(t, err)
+		assert(t, c.SupportsArch(*parsed) == supported)
+	}
+
+	_, err = control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Architecture: amd64 i386 amd64
+`)), "")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "'amd64' is listed more than once"))
+}
+
+func TestDSCStandardsVersionParsed(t *testing.T) {
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Standards-Version: 3.9.5
+`)), "")
+	isok(t, err)
+
+	standards, err := c.StandardsVersionParsed()
+	isok(t, err)
+	current, err := version.ParseStandardsVersion("4.6.2.0")
+	isok(t, err)
+	assert(t, standards.Behind(current) == 3)
+	assert(t, current.Behind(standards) == 0)
+
+	c.StandardsVersion = "latest"
+	_, err = c.StandardsVersionParsed()
+	notok(t, err)
+}
+
+func TestDSCBuildDependsStatus(t *testing.T) {
+	// Test DSC {{{
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Build-Depends: debhelper (>= 9), libfoo-dev | libbar-dev, libwin32-dev [mingw32-any], ${misc:Depends}
+Build-Depends-Arch: libbaz-dev (>= 2.0)
+Build-Depends-Indep: python3-sphinx
+`)), "")
+	// }}}
+	isok(t, err)
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	installed := map[string]version.Version{
+		"debhelper":  {Version: "13"},
+		"libbar-dev": {Version: "1.0"},
+		"libbaz-dev": {Version: "1.9"},
+	}
+	satisfied, unsatisfied := c.BuildDependsStatus(installed, *arch)
+
+	names := func(relations []dependency.Relation) []string {
+		ret := []string{}
+		for _, relation := range relations {
+			ret = append(ret, relation.Possibilities[0].Name)
+		}
+		return ret
+	}
+	assert(t, strings.Join(names(satisfied), " ") == "debhelper libfoo-dev")
+	assert(t, strings.Join(names(unsatisfied), " ") == "libbaz-dev python3-sphinx")
+
+	installed["libbaz-dev"] = version.Version{Version: "2.1"}
+	installed["python3-sphinx"] = version.Version{Version: "5.3.0", Revision: "4"}
+	satisfied, unsatisfied = c.BuildDependsStatus(installed, *arch)
+	assert(t, len(satisfied) == 4)
+	assert(t, len(unsatisfied) == 0)
+}
+
+func TestDSCUppercaseArchitecture(t *testing.T) {
+	// Test DSC {{{
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: AMD64 Linux-Any ALL
+Version: 2.718281828-1
+`)), "")
+	// }}}
+	isok(t, err)
+	assert(t, c.HasArchAll())
+	assert(t, c.Architectures[0].String() == "AMD64")
+
+	for _, arch := range []string{"amd64", "i386"} {
+		parsed, err := dependency.ParseArch(arch)
+		isok(t, err)
+		assert(t, c.SupportsArch(*parsed))
+	}
+
+	_, err = control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+Architecture: amd64 AMD64
+`)), "")
+	notok(t, err)
+}
+
+func TestBuildDependsUnion(t *testing.T) {
+	parse := func(fields string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(fields)), "")
+		isok(t, err)
+		return *c
+	}
+	dscs := []control.DSC{
+		parse(`Source: foo
+Build-Depends: debhelper (>= 9), libc6-dev [amd64] | libc-dev [!amd64], ${misc:Depends}
+Build-Depends-Indep: python3-sphinx
+`),
+		parse(`Source: bar
+Build-Depends: debhelper (>= 12), libfoo-dev [i386]
+Build-Depends-Arch: pkg-config
+`),
+	}
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	union := control.BuildDependsUnion(dscs, *amd64)
+	assert(t, union.String() == "debhelper (>= 12), libc6-dev, pkg-config, python3-sphinx")
+
+	i386, err := dependency.ParseArch("i386")
+	isok(t, err)
+	union = control.BuildDependsUnion(dscs, *i386)
+	assert(t, union.String() == "debhelper (>= 12), libc-dev, libfoo-dev, pkg-config, python3-sphinx")
+}
+
+func TestDSCUploadersParse(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Uploaders: "Smith, John" <john@example.org>, John Doe <jdoe@example.com>
+`))
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, len(c.Maintainers()) == 3)
+	assert(t, c.Uploaders[0] == `"Smith, John" <john@example.org>`)
+	assert(t, c.Uploaders[1] == "John Doe <jdoe@example.com>")
+
+	buf := bytes.Buffer{}
+	isok(t, control.Marshal(&buf, c))
+	assert(t, strings.Contains(buf.String(),
+		`Uploaders: "Smith, John" <john@example.org>, John Doe <jdoe@example.com>`+"\n"))
+}
+
 func TestOpenPGPDSCParse(t *testing.T) {
 	// Test OpenPGP DSC {{{
 	reader := bufio.NewReader(strings.NewReader(`-----BEGIN PGP SIGNED MESSAGE-----
@@ -203,4 +485,1064 @@ Files:
 	assert(t, c.HasArchAll())
 }
 
+func TestDSCPackageListParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart, fbautostart-udeb
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Package-List:
+ fbautostart deb misc optional arch=any profile=!nocheck
+ fbautostart-udeb udeb debian-installer extra arch=amd64,i386 foo
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, len(c.PackageList) == 2)
+
+	entry := c.PackageList[0]
+	assert(t, entry.Name == "fbautostart")
+	assert(t, entry.Type == "deb")
+	assert(t, entry.Section == "misc")
+	assert(t, entry.Priority == "optional")
+	assert(t, entry.Extra["arch"] == "any")
+	assert(t, entry.Extra["profile"] == "!nocheck")
+
+	entry = c.PackageList[1]
+	assert(t, entry.Type == "udeb")
+	assert(t, entry.Extra["arch"] == "amd64,i386")
+	value, ok := entry.Extra["foo"]
+	assert(t, ok && value == "")
+
+	line, err := entry.MarshalControl()
+	isok(t, err)
+	assert(t, line == "fbautostart-udeb udeb debian-installer extra arch=amd64,i386 foo")
+}
+
+func TestParseSourceFormat(t *testing.T) {
+	format, err := control.ParseSourceFormat(" 3.0  ( quilt ) ")
+	isok(t, err)
+	assert(t, format.Major == 3 && format.Minor == 0 && format.Variant == "quilt")
+	assert(t, format.String() == "3.0 (quilt)")
+
+	format, err = control.ParseSourceFormat("1.0")
+	isok(t, err)
+	assert(t, format.Major == 1 && format.Variant == "")
+	assert(t, format.String() == "1.0")
+
+	for _, bad := range []string{"3", "3.0 (quilt", "3.0 ()", "three.0", "3.0.1", "3.0x (quilt)"} {
+		_, err := control.ParseSourceFormat(bad)
+		notok(t, err)
+	}
+}
+
+func TestDSCIsNative(t *testing.T) {
+	for input, native := range map[string]bool{
+		"Format: 3.0 (native)\n":                        true,
+		"Format: 3.0 (quilt)\n":                         false,
+		"Format: 1.0\nFiles:\n 00 1 hello_1.0.tar.gz\n": true,
+		"Format: 1.0\nFiles:\n 00 1 hello_1.0.orig.tar.gz\n 00 1 hello_1.0-1.diff.gz\n": false,
+		"Source: hello\n": true,
+	} {
+		dsc, err := control.ParseDsc(bufio.NewReader(strings.NewReader(input)), "")
+		isok(t, err)
+		assert(t, dsc.IsNative() == native)
+	}
+
+	dsc, err := control.ParseDsc(bufio.NewReader(strings.NewReader("Format: what\n")), "")
+	isok(t, err)
+	_, err = dsc.SourceFormat()
+	notok(t, err)
+	assert(t, !dsc.IsNative())
+}
+
+func TestDSCBinariesForArch(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart, fbautostart-doc, fbautostart-udeb
+Architecture: any all
+Version: 2.718281828-1
+Package-List:
+ fbautostart deb misc optional arch=any
+ fbautostart-doc deb doc optional arch=all
+ fbautostart-udeb udeb debian-installer extra arch=amd64,linux-i386
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	binaries := func(name string) string {
+		arch, err := dependency.ParseArch(name)
+		isok(t, err)
+		return strings.Join(c.BinariesForArch(*arch), " ")
+	}
+
+	assert(t, binaries("amd64") == "fbautostart fbautostart-udeb")
+	assert(t, binaries("i386") == "fbautostart fbautostart-udeb")
+	assert(t, binaries("armhf") == "fbautostart")
+	assert(t, binaries("all") == "fbautostart-doc")
+
+	// Test DSC {{{
+	reader = bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart-data
+Architecture: all
+Version: 1.0-1
+Package-List:
+ fbautostart-data deb misc optional
+`))
+	// }}}
+	c, err = control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, binaries("amd64") == "")
+	assert(t, binaries("all") == "fbautostart-data")
+}
+
+func TestDSCEmptyPackageListParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Package-List:
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, c.PackageList == nil)
+}
+
+func writeValidateDSC(t *testing.T, dir string, files map[string]string, extra string) *control.DSC {
+	md5s, sha1s, sha256s := "", "", ""
+	for name, content := range files {
+		isok(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		md5s += fmt.Sprintf(" %x %d %s\n", md5.Sum([]byte(content)), len(content), name)
+		sha1s += fmt.Sprintf(" %x %d %s\n", sha1.Sum([]byte(content)), len(content), name)
+		sha256s += fmt.Sprintf(" %x %d %s\n", sha256.Sum256([]byte(content)), len(content), name)
+	}
+	dscPath := filepath.Join(dir, "hello_1.0-1.dsc")
+	isok(t, ioutil.WriteFile(dscPath, []byte(`Format: 3.0 (quilt)
+Source: hello
+Version: 1.0-1
+Checksums-Sha1:
+`+sha1s+`Checksums-Sha256:
+`+sha256s+extra+`Files:
+`+md5s), 0644))
+	dsc, err := control.ParseDscFile(dscPath)
+	isok(t, err)
+	return dsc
+}
+
+// Like writeValidateDSC, but into a new temporary directory, which is
+// returned so that it can be removed once the test is done.
+func tempValidateDSC(t *testing.T, files map[string]string, extra string) (*control.DSC, string) {
+	dir, err := ioutil.TempDir("", "go-debian-dsc")
+	isok(t, err)
+	return writeValidateDSC(t, dir, files, extra), dir
+}
+
+func TestDSCFilesPresent(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz":     "upstream",
+		"hello_1.0-1.debian.tar.xz": "packaging",
+	}, "")
+	defer os.RemoveAll(dir)
+	missing, err := dsc.FilesPresent()
+	isok(t, err)
+	assert(t, len(missing) == 0)
+
+	isok(t, os.Remove(filepath.Join(dir, "hello_1.0.orig.tar.gz")))
+	missing, err = dsc.FilesPresent()
+	isok(t, err)
+	assert(t, len(missing) == 1)
+	assert(t, missing[0] == "hello_1.0.orig.tar.gz")
+}
+
+func TestDSCFileSet(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: hello
+Version: 1.0-1
+Checksums-Sha1:
+ aaaa 10 hello_1.0.orig.tar.gz
+ bbbb 20 hello_1.0-1.debian.tar.xz
+Checksums-Sha256:
+ cccc 10 hello_1.0.orig.tar.gz
+Files:
+ dddd 10 hello_1.0.orig.tar.gz
+ eeee 21 hello_1.0-1.debian.tar.xz
+`))
+	// }}}
+	dsc, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	files := dsc.FileSet()
+	assert(t, len(files) == 2)
+
+	orig := files["hello_1.0.orig.tar.gz"]
+	assert(t, orig.Consistent())
+	assert(t, orig.Size == 10)
+	assert(t, orig.MD5 == "dddd")
+	assert(t, orig.SHA1 == "aaaa")
+	assert(t, orig.SHA256 == "cccc")
+	assert(t, orig.SHA512 == "")
+
+	debian := files["hello_1.0-1.debian.tar.xz"]
+	assert(t, !debian.Consistent())
+	assert(t, debian.SizeMismatch)
+	assert(t, len(debian.Missing) == 1)
+	assert(t, debian.Missing[0] == "Checksums-Sha256")
+	assert(t, debian.SHA256 == "")
+}
+
+func TestDSCToSourceIndex(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, fmt.Sprintf(
+		"Checksums-Sha512:\n %x 8 hello_1.0.orig.tar.gz\nTestsuite: autopkgtest\n",
+		sha512.Sum512([]byte("upstream")),
+	))
+	defer os.RemoveAll(dir)
+	dscData, err := ioutil.ReadFile(dsc.Filename)
+	isok(t, err)
+
+	index, err := dsc.ToSourceIndex("pool/main/h/hello")
+	isok(t, err)
+	assert(t, index.Package == "hello")
+	assert(t, index.Directory == "pool/main/h/hello")
+	assert(t, len(index.Files) == 2)
+	assert(t, index.Files[0].Filename == "hello_1.0-1.dsc")
+	assert(t, index.Files[0].Size == int64(len(dscData)))
+	assert(t, index.Files[0].Hash == fmt.Sprintf("%x", md5.Sum(dscData)))
+	assert(t, index.ChecksumsSha256[0].Hash == fmt.Sprintf("%x", sha256.Sum256(dscData)))
+
+	buf := bytes.Buffer{}
+	isok(t, control.Marshal(&buf, index))
+	assert(t, !strings.Contains(buf.String(), "Source:"))
+
+	indices, err := control.ParseSourceIndex(bufio.NewReader(&buf))
+	isok(t, err)
+	assert(t, len(indices) == 1)
+	parsed := indices[0]
+	assert(t, parsed.Package == "hello")
+	assert(t, parsed.Directory == "pool/main/h/hello")
+	assert(t, len(parsed.ChecksumsSha1) == 2)
+	assert(t, parsed.ChecksumsSha1[0].Hash == fmt.Sprintf("%x", sha1.Sum(dscData)))
+	assert(t, len(parsed.PoolFiles()) == 2)
+	assert(t, parsed.PoolFiles()[0].Filename == "pool/main/h/hello/hello_1.0-1.dsc")
+
+	testsuite, _ := parsed.Get("Testsuite")
+	assert(t, testsuite == "autopkgtest")
+	sha512s, _ := parsed.Get("Checksums-Sha512")
+	assert(t, strings.Contains(sha512s, fmt.Sprintf("%x", sha512.Sum512(dscData))+" "))
+	assert(t, strings.Contains(sha512s, "hello_1.0.orig.tar.gz"))
+
+	_, err = (&control.DSC{Source: "hello"}).ToSourceIndex("pool/main/h/hello")
+	notok(t, err)
+}
+
+func TestDSCValidate(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz":     "upstream",
+		"hello_1.0-1.debian.tar.xz": "packaging",
+	}, "")
+	defer os.RemoveAll(dir)
+	isok(t, dsc.Validate())
+
+	/* Same size, different content */
+	isok(t, ioutil.WriteFile(filepath.Join(dir, "hello_1.0.orig.tar.gz"), []byte("UPSTREAM"), 0644))
+	err := dsc.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "hello_1.0.orig.tar.gz"))
+	assert(t, strings.Contains(err.Error(), "Hash mismatch"))
+
+	/* Different size */
+	isok(t, ioutil.WriteFile(filepath.Join(dir, "hello_1.0.orig.tar.gz"), []byte("upstream!"), 0644))
+	err = dsc.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Size mismatch"))
+
+	/* Missing */
+	isok(t, os.Remove(filepath.Join(dir, "hello_1.0.orig.tar.gz")))
+	err = dsc.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "missing"))
+}
+
+func TestDSCVerifyFile(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+	isok(t, dsc.VerifyFile("hello_1.0.orig.tar.gz"))
+
+	err := dsc.VerifyFile("hello_1.0-1.debian.tar.xz")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "not listed"))
+
+	/* The SHA256 hash still matches, but the MD5 one was changed */
+	dsc.Files[0].Hash = "00000000000000000000000000000000"
+	err = dsc.VerifyFile("hello_1.0.orig.tar.gz")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Conflicting hashes"))
+	assert(t, strings.Contains(err.Error(), "md5"))
+
+	/* Only the MD5 is left, and it's the one that's wrong */
+	dsc.ChecksumsSha1 = nil
+	dsc.ChecksumsSha256 = nil
+	err = dsc.VerifyFile("hello_1.0.orig.tar.gz")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Hash mismatch"))
+
+	/* Same size, different content */
+	dsc = writeValidateDSC(t, dir, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	isok(t, ioutil.WriteFile(filepath.Join(dir, "hello_1.0.orig.tar.gz"), []byte("UPSTREAM"), 0644))
+	err = dsc.VerifyFile("hello_1.0.orig.tar.gz")
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "(sha256)"))
+}
+
+func TestDSCValidateInconsistent(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, " 0000000000000000000000000000000000000000000000000000000000000000 5 hello_1.0-1.debian.tar.xz\n")
+	defer os.RemoveAll(dir)
+	err := dsc.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "hello_1.0-1.debian.tar.xz"))
+	assert(t, strings.Contains(err.Error(), "Checksums-Sha256"))
+}
+
+func TestDSCValidateSha512(t *testing.T) {
+	content := "upstream"
+	sha512s := fmt.Sprintf(" %x %d hello_1.0.orig.tar.gz\n", sha512.Sum512([]byte(content)), len(content))
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": content,
+	}, "Checksums-Sha512:\n"+sha512s)
+	defer os.RemoveAll(dir)
+	assert(t, len(dsc.ChecksumsSha512) == 1)
+	assert(t, dsc.ChecksumsSha512[0].Algorithm == "sha512")
+	isok(t, dsc.Validate())
+
+	dsc.ChecksumsSha512[0].Hash = strings.Repeat("0", 128)
+	err := dsc.Validate()
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Checksums-Sha512"))
+}
+
+func TestDSCValidateWithoutAlgorithm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-dsc")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	/* Put together in code, so none of the entries have an Algorithm */
+	content := "upstream"
+	name := "hello_1.0.orig.tar.gz"
+	isok(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	size := int64(len(content))
+	dsc := control.DSC{
+		Filename: filepath.Join(dir, "hello_1.0-1.dsc"),
+		Files: []control.MD5FileHash{{FileHash: control.FileHash{
+			Filename: name, Size: size, Hash: fmt.Sprintf("%x", md5.Sum([]byte(content))),
+		}}},
+		ChecksumsSha256: []control.SHA256FileHash{{FileHash: control.FileHash{
+			Filename: name, Size: size, Hash: fmt.Sprintf("%x", sha256.Sum256([]byte(content))),
+		}}},
+	}
+	isok(t, dsc.Validate())
+	isok(t, dsc.VerifyFile(name))
+
+	entry := dsc.FileSet()[name]
+	assert(t, entry.MD5 == dsc.Files[0].Hash)
+	assert(t, entry.SHA256 == dsc.ChecksumsSha256[0].Hash)
+
+	dsc.ChecksumsSha256[0].Hash = strings.Repeat("0", 64)
+	err = dsc.VerifyFile(name)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "(sha256)"))
+}
+
+func TestDSCWriteTo(t *testing.T) {
+	// Test DSC {{{
+	input := `Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Homepage: https://launchpad.net/fbautostart
+Standards-Version: 3.9.3
+Vcs-Browser: http://git.debian.org/?p=collab-maint/fbautostart.git
+Vcs-Git: git://git.debian.org/collab-maint/fbautostart.git
+Build-Depends: debhelper (>= 9)
+Package-List:
+ fbautostart deb misc optional arch=any
+Checksums-Sha1:
+ bc36310c15edc9acf48f0a1daf548bcc6f861372 92748 fbautostart_2.718281828.orig.tar.gz
+ eaed7f053dce48d4ad4e442bbb0da73ea1181a26 2356 fbautostart_2.718281828-1.debian.tar.xz
+Checksums-Sha256:
+ bb2fdfd4a38505905222ee02d8236a594bdf6eaefca23462294cacda631745c1 92748 fbautostart_2.718281828.orig.tar.gz
+ f7186d1bebde403527b5b3fd80406decaaf295366206667d5b402da962f0b772 2356 fbautostart_2.718281828-1.debian.tar.xz
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+ f58c0e0bf4d56461e776232484c07301 2356 fbautostart_2.718281828-1.debian.tar.xz
+`
+	// }}}
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(input)), "")
+	isok(t, err)
+
+	writer := bytes.Buffer{}
+	n, err := c.WriteTo(&writer)
+	isok(t, err)
+	assert(t, writer.String() == input)
+	assert(t, n == int64(len(input)))
+
+	c.StandardsVersion = "4.1.3"
+	writer = bytes.Buffer{}
+	_, err = c.WriteTo(&writer)
+	isok(t, err)
+	assert(t, writer.String() == strings.Replace(input, "3.9.3", "4.1.3", 1))
+}
+
+func TestDSCWriteToOrder(t *testing.T) {
+	// Test DSC {{{
+	c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(`Source: fbautostart
+X-Foo: bar
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+Version: 2.718281828-1
+Format: 3.0 (quilt)
+`)), "")
+	// }}}
+	isok(t, err)
+
+	writer := bytes.Buffer{}
+	_, err = c.WriteTo(&writer)
+	isok(t, err)
+	assert(t, writer.String() == `Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+X-Foo: bar
+`)
+}
+
+func TestDSCParseSigned(t *testing.T) {
+	// Test DSC {{{
+	input := `Format: 3.0 (quilt)
+Source: fbautostart
+Binary: fbautostart
+Architecture: any
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+`
+	// }}}
+	signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	isok(t, err)
+	stranger, err := openpgp.NewEntity("Stranger", "", "stranger@example.com", nil)
+	isok(t, err)
+
+	signed := bytes.Buffer{}
+	w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+	isok(t, err)
+	_, err = w.Write([]byte(input))
+	isok(t, err)
+	isok(t, w.Close())
+
+	c, entity, err := control.ParseDscSigned(
+		bufio.NewReader(bytes.NewReader(signed.Bytes())),
+		openpgp.EntityList{signer}, "",
+	)
+	isok(t, err)
+	assert(t, c.Source == "fbautostart")
+	assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+
+	_, _, err = control.ParseDscSigned(
+		bufio.NewReader(bytes.NewReader(signed.Bytes())),
+		openpgp.EntityList{stranger}, "",
+	)
+	notok(t, err)
+	assert(t, err != control.ErrNotSigned)
+
+	_, _, err = control.ParseDscSigned(
+		bufio.NewReader(strings.NewReader(input)),
+		openpgp.EntityList{signer}, "",
+	)
+	assert(t, err == control.ErrNotSigned)
+}
+
+func TestDSCParseSignedData(t *testing.T) {
+	// Test DSC {{{
+	input := `Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Description: hello
+ world
+`
+	// }}}
+	signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	isok(t, err)
+	other, err := openpgp.NewEntity("Other Signer", "", "other@example.com", nil)
+	isok(t, err)
+
+	signed := bytes.Buffer{}
+	w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+	isok(t, err)
+	_, err = w.Write([]byte(input))
+	isok(t, err)
+	isok(t, w.Close())
+
+	c, entity, data, err := control.ParseDscSignedData(
+		bufio.NewReader(bytes.NewReader(signed.Bytes())),
+		openpgp.EntityList{other, signer}, "",
+	)
+	isok(t, err)
+	assert(t, c.Source == "fbautostart")
+	assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+	assert(t, strings.Contains(string(data), "Source: fbautostart"))
+
+	block, _ := clearsign.Decode(signed.Bytes())
+	assert(t, block != nil)
+	_, err = openpgp.CheckDetachedSignature(
+		openpgp.EntityList{signer},
+		bytes.NewReader(data),
+		block.ArmoredSignature.Body,
+	)
+	isok(t, err)
+}
+
+func TestDSCBuildConflictsParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Build-Depends: debhelper (>= 9)
+Build-Conflicts: autoconf2.13, automake1.4
+Build-Conflicts-Arch: libfoo-dev [amd64]
+Build-Conflicts-Indep: python-sphinx (<< 1.0)
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	assert(t, len(c.BuildConflicts.Relations) == 2)
+	assert(t, c.BuildConflicts.Relations[1].Possibilities[0].Name == "automake1.4")
+	assert(t, c.BuildConflictsArch.Relations[0].Possibilities[0].Name == "libfoo-dev")
+	assert(t, c.BuildConflictsIndep.Relations[0].Possibilities[0].Version.Operator == "<<")
+}
+
+func TestOrderDSCForBuildConflicts(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	dscs := []control.DSC{
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\n"),
+		parse("Source: bar\nBinary: bar\nVersion: 1.0\nBuild-Conflicts: libfoo-dev\n"),
+		parse("Source: baz\nBinary: baz\nVersion: 1.0\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	sorted, err := control.OrderDSCForBuild(dscs, *arch)
+	isok(t, err)
+	assert(t, len(sorted) == 3)
+
+	for i := 0; i+1 < len(sorted); i++ {
+		pair := map[string]bool{sorted[i].Source: true, sorted[i+1].Source: true}
+		assert(t, !(pair["foo"] && pair["bar"]))
+	}
+}
+
+func TestOrderDSCForBuildTieBreak(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	dscs := []control.DSC{
+		parse("Source: zed\nBinary: zed\nVersion: 1.0\nBuild-Depends: libfoo-dev\n"),
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\n"),
+		parse("Source: mid\nBinary: mid\nVersion: 1.0\n"),
+		parse("Source: bar\nBinary: bar\nVersion: 1.0\nBuild-Depends: libfoo-dev\n"),
+		parse("Source: abc\nBinary: abc\nVersion: 1.0\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	names := func(dscs []control.DSC) string {
+		ret := []string{}
+		for _, dsc := range dscs {
+			ret = append(ret, dsc.Source)
+		}
+		return strings.Join(ret, " ")
+	}
+
+	for i := 0; i < 20; i++ {
+		sorted, err := control.OrderDSCForBuild(dscs, *arch)
+		isok(t, err)
+		assert(t, names(sorted) == "abc foo bar mid zed")
+	}
+
+	sorted, err := control.OrderDSCForBuildWithOptions(dscs, *arch, control.BuildOrderOptions{
+		Less: func(a, b control.DSC) bool { return a.Source > b.Source },
+	})
+	isok(t, err)
+	assert(t, names(sorted) == "mid foo zed bar abc")
+}
+
+func TestOrderDSCForBuildSelfBuildDepends(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	dscs := []control.DSC{
+		parse("Source: rustc\nBinary: rustc, libstd-rust-dev\nVersion: 1.0\nBuild-Depends: rustc, libfoo-dev\n"),
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	sorted, err := control.OrderDSCForBuild(dscs, *arch)
+	isok(t, err)
+	assert(t, len(sorted) == 2)
+	assert(t, sorted[0].Source == "foo")
+	assert(t, sorted[1].Source == "rustc")
+
+	stages, err := control.StageDSCForBuild(dscs, *arch)
+	isok(t, err)
+	assert(t, len(stages) == 2)
+	assert(t, stages[1][0].Source == "rustc")
+}
+
+func TestDSCTestsuiteParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Testsuite: autopkgtest, autopkgtest-pkg-go
+Testsuite-Triggers: golang-any,  dh-golang
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	assert(t, len(c.Testsuite) == 2)
+	assert(t, c.Testsuite[0] == "autopkgtest")
+	assert(t, c.Testsuite[1] == "autopkgtest-pkg-go")
+	assert(t, len(c.TestsuiteTriggers) == 2)
+	assert(t, c.TestsuiteTriggers[1] == "dh-golang")
+
+	writer := bytes.Buffer{}
+	_, err = c.WriteTo(&writer)
+	isok(t, err)
+	assert(t, strings.Contains(writer.String(), "Testsuite: autopkgtest, autopkgtest-pkg-go\n"))
+	assert(t, strings.Contains(writer.String(), "Testsuite-Triggers: golang-any, dh-golang\n"))
+
+	reader = bufio.NewReader(strings.NewReader(`Source: fbautostart
+Version: 2.718281828-1
+Testsuite: autopkgtest
+`))
+	c, err = control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, len(c.Testsuite) == 1)
+	assert(t, c.Testsuite[0] == "autopkgtest")
+	assert(t, len(c.TestsuiteTriggers) == 0)
+}
+
+func TestDSCTotalSize(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz":     "upstream",
+		"hello_1.0-1.debian.tar.xz": "packaging",
+	}, "")
+	defer os.RemoveAll(dir)
+
+	size, err := dsc.TotalSize()
+	isok(t, err)
+	assert(t, size == int64(len("upstream")+len("packaging")))
+
+	onDisk, err := dsc.TotalSizeOnDisk()
+	isok(t, err)
+	assert(t, onDisk == size)
+
+	/* Truncated download */
+	isok(t, ioutil.WriteFile(filepath.Join(dir, "hello_1.0.orig.tar.gz"), []byte("up"), 0644))
+	onDisk, err = dsc.TotalSizeOnDisk()
+	isok(t, err)
+	assert(t, onDisk != size)
+
+	isok(t, os.Remove(filepath.Join(dir, "hello_1.0.orig.tar.gz")))
+	_, err = dsc.TotalSizeOnDisk()
+	notok(t, err)
+
+	_, err = (&control.DSC{}).TotalSize()
+	notok(t, err)
+}
+
+func TestDSCLink(t *testing.T) {
+	dest, err := ioutil.TempDir("", "go-debian-dsc-dest")
+	isok(t, err)
+	defer os.RemoveAll(dest)
+
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+
+	isok(t, dsc.Link(dest))
+	assert(t, dsc.Filename == dest+"/hello_1.0-1.dsc")
+	isok(t, dsc.Validate())
+
+	orig, err := os.Stat(filepath.Join(dir, "hello_1.0.orig.tar.gz"))
+	isok(t, err)
+	linked, err := os.Stat(filepath.Join(dest, "hello_1.0.orig.tar.gz"))
+	isok(t, err)
+	assert(t, os.SameFile(orig, linked))
+
+	notok(t, dsc.Link(filepath.Join(dest, "hello_1.0-1.dsc")))
+}
+
+func TestDSCCopyWithOptions(t *testing.T) {
+	dest, err := ioutil.TempDir("", "go-debian-dsc-dest")
+	isok(t, err)
+	defer os.RemoveAll(dest)
+
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+	orig := filepath.Join(dir, "hello_1.0.orig.tar.gz")
+	isok(t, os.Chmod(orig, 0600))
+	then := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	isok(t, os.Chtimes(orig, then, then))
+
+	isok(t, dsc.CopyWithOptions(dest, control.CopyOptions{PreserveTimes: true}))
+	assert(t, dsc.Filename == dest+"/hello_1.0-1.dsc")
+	isok(t, dsc.Validate())
+
+	copied, err := os.Stat(filepath.Join(dest, "hello_1.0.orig.tar.gz"))
+	isok(t, err)
+	assert(t, copied.Mode().Perm() == 0600)
+	assert(t, copied.ModTime().Equal(then))
+}
+
+func TestDSCCopyKeepsMode(t *testing.T) {
+	dest, err := ioutil.TempDir("", "go-debian-dsc-dest")
+	isok(t, err)
+	defer os.RemoveAll(dest)
+
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+	orig := filepath.Join(dir, "hello_1.0.orig.tar.gz")
+	isok(t, os.Chmod(orig, 0640))
+	then := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	isok(t, os.Chtimes(orig, then, then))
+
+	isok(t, dsc.Copy(dest))
+	copied, err := os.Stat(filepath.Join(dest, "hello_1.0.orig.tar.gz"))
+	isok(t, err)
+	assert(t, copied.Mode().Perm() == 0640)
+	assert(t, !copied.ModTime().Equal(then))
+}
+
+func TestDSCMove(t *testing.T) {
+	dest, err := ioutil.TempDir("", "go-debian-dsc-dest")
+	isok(t, err)
+	defer os.RemoveAll(dest)
+
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+
+	notok(t, dsc.Move(dsc.Filename))
+
+	isok(t, dsc.Move(dest))
+	assert(t, dsc.Filename == dest+"/hello_1.0-1.dsc")
+	isok(t, dsc.Validate())
+
+	_, err = os.Stat(filepath.Join(dir, "hello_1.0.orig.tar.gz"))
+	assert(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "hello_1.0-1.dsc"))
+	assert(t, os.IsNotExist(err))
+}
+
+// A context that's cancelled once Err has been checked a given number of
+// times, to cancel a Validate part of the way through a file.
+type cancelAfterContext struct {
+	context.Context
+	checks int
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.checks <= 0 {
+		return context.Canceled
+	}
+	c.checks--
+	return nil
+}
+
+func TestDSCValidateContextCancelled(t *testing.T) {
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": strings.Repeat("upstream", 2<<20),
+	}, "")
+	defer os.RemoveAll(dir)
+	isok(t, dsc.ValidateContext(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert(t, dsc.ValidateContext(ctx) == context.Canceled)
+
+	/* Once before opening the file, and then once per chunk read */
+	assert(t, dsc.ValidateContext(&cancelAfterContext{context.Background(), 3}) == context.Canceled)
+}
+
+func TestDSCCopyContextCancelled(t *testing.T) {
+	dest, err := ioutil.TempDir("", "go-debian-dsc-dest")
+	isok(t, err)
+	defer os.RemoveAll(dest)
+
+	dsc, dir := tempValidateDSC(t, map[string]string{
+		"hello_1.0.orig.tar.gz": "upstream",
+	}, "")
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert(t, dsc.CopyContext(ctx, dest) == context.Canceled)
+	assert(t, dsc.MoveContext(ctx, dest) == context.Canceled)
+
+	entries, err := ioutil.ReadDir(dest)
+	isok(t, err)
+	assert(t, len(entries) == 0)
+	assert(t, dsc.Filename == dir+"/hello_1.0-1.dsc")
+
+	isok(t, dsc.CopyContext(context.Background(), dest))
+	isok(t, dsc.Validate())
+}
+
+func TestOrderDSCForBuildCycle(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	dscs := []control.DSC{
+		parse("Source: leaf\nBinary: leaf\nVersion: 1.0\n"),
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\nBuild-Depends: libbar-dev, leaf\n"),
+		parse("Source: bar\nBinary: libbar-dev\nVersion: 1.0\nBuild-Depends: libbaz-dev\n"),
+		parse("Source: baz\nBinary: libbaz-dev\nVersion: 1.0\nBuild-Depends: libfoo-dev\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	_, err = control.OrderDSCForBuild(dscs, *arch)
+	notok(t, err)
+
+	cycle, ok := err.(*control.CycleError)
+	assert(t, ok)
+	assert(t, strings.Join(cycle.Sources, " ") == "foo bar baz")
+	assert(t, cycle.Error() == "Build-Depends cycle between sources: foo -> bar -> baz -> foo")
+
+	/* Shouldn't panic without any sources */
+	assert(t, control.CycleError{}.Error() == "Build-Depends cycle between sources")
+}
+
+func TestStageDSCForBuild(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	dscs := []control.DSC{
+		parse("Source: app\nBinary: app\nVersion: 1.0\nBuild-Depends: libfoo-dev, libbar-dev\n"),
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\nBuild-Depends: libbar-dev, debhelper\n"),
+		parse("Source: bar\nBinary: libbar-dev\nVersion: 1.0\n"),
+		parse("Source: baz\nBinary: baz\nVersion: 1.0\nBuild-Depends: debhelper\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	stages, err := control.StageDSCForBuild(dscs, *arch)
+	isok(t, err)
+	assert(t, len(stages) == 3)
+
+	names := func(stage []control.DSC) map[string]bool {
+		ret := map[string]bool{}
+		for _, dsc := range stage {
+			ret[dsc.Source] = true
+		}
+		return ret
+	}
+	assert(t, len(stages[0]) == 2)
+	assert(t, names(stages[0])["bar"] && names(stages[0])["baz"])
+	assert(t, len(stages[1]) == 1 && stages[1][0].Source == "foo")
+	assert(t, len(stages[2]) == 1 && stages[2][0].Source == "app")
+
+	dscs = append(dscs, parse("Source: qux\nBinary: qux\nVersion: 1.0\nBuild-Depends: app\n"))
+	dscs[2] = parse("Source: bar\nBinary: libbar-dev\nVersion: 1.0\nBuild-Depends: qux\n")
+	_, err = control.StageDSCForBuild(dscs, *arch)
+	notok(t, err)
+	_, ok := err.(*control.CycleError)
+	assert(t, ok)
+}
+
+func TestOrderDSCForBuildArchOnly(t *testing.T) {
+	parse := func(data string) control.DSC {
+		c, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *c
+	}
+
+	/* The docs for foo need bar, which needs libfoo-dev to build */
+	dscs := []control.DSC{
+		parse("Source: foo\nBinary: libfoo-dev\nVersion: 1.0\nBuild-Depends-Indep: bar\n"),
+		parse("Source: bar\nBinary: bar\nVersion: 1.0\nBuild-Depends: libfoo-dev\n"),
+	}
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	_, err = control.OrderDSCForBuild(dscs, *arch)
+	notok(t, err)
+
+	options := control.BuildOrderOptions{ArchOnly: true}
+	sorted, err := control.OrderDSCForBuildWithOptions(dscs, *arch, options)
+	isok(t, err)
+	assert(t, len(sorted) == 2)
+	assert(t, sorted[0].Source == "foo")
+	assert(t, sorted[1].Source == "bar")
+
+	stages, err := control.StageDSCForBuildWithOptions(dscs, *arch, options)
+	isok(t, err)
+	assert(t, len(stages) == 2)
+}
+
+func TestDSCCaseInsensitiveParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`format: 3.0 (quilt)
+SOURCE: fbautostart
+version: 2.718281828-1
+build-depends: debhelper (>= 9)
+Standards-version: 3.9.3
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	assert(t, c.Source == "fbautostart")
+	assert(t, c.Version.Version == "2.718281828")
+	assert(t, c.StandardsVersion == "3.9.3")
+	assert(t, c.BuildDepends.Relations[0].Possibilities[0].Name == "debhelper")
+
+	writer := bytes.Buffer{}
+	_, err = c.WriteTo(&writer)
+	isok(t, err)
+	assert(t, writer.String() == `Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Standards-Version: 3.9.3
+Build-Depends: debhelper (>= 9)
+`)
+}
+
+func TestSortDSCByVersion(t *testing.T) {
+	dscs := []control.DSC{}
+	for i, el := range []string{"1.0-1", "2.0-1", "1.0-1", "1:0.5-1"} {
+		ver, err := version.Parse(el)
+		isok(t, err)
+		dscs = append(dscs, control.DSC{
+			Source:  fmt.Sprintf("foo%d", i),
+			Version: ver,
+		})
+	}
+
+	control.SortDSCByVersion(dscs)
+	assert(t, dscs[0].Source == "foo3")
+	assert(t, dscs[1].Source == "foo1")
+	assert(t, dscs[2].Source == "foo0")
+	assert(t, dscs[3].Source == "foo2")
+}
+
+func TestDiffDSC(t *testing.T) {
+	parse := func(data string) control.DSC {
+		dsc, err := control.ParseDsc(bufio.NewReader(strings.NewReader(data)), "")
+		isok(t, err)
+		return *dsc
+	}
+
+	a := parse(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Maintainer: Paul Tagliamonte <paultag@ubuntu.com>
+Homepage: https://launchpad.net/fbautostart
+Build-Depends: debhelper (>= 9), libfoo-dev
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+ f58c0e0bf4d56461e776232484c07301 2356 fbautostart_2.718281828-1.debian.tar.xz
+`)
+	b := parse(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-2
+Maintainer: Tianon Gravi <tianon@debian.org>
+Vcs-Git: https://salsa.debian.org/foo/fbautostart.git
+Build-Depends: debhelper-compat (= 13), libfoo-dev
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 fbautostart_2.718281828.orig.tar.gz
+ aaed7f053dce48d4ad4e442bbb0da73e 2400 fbautostart_2.718281828-2.debian.tar.xz
+`)
+
+	diff := control.DiffDSC(a, b)
+	assert(t, !diff.Empty())
+	assert(t, diff.VersionDelta > 0)
+	assert(t, diff.OldVersion.String() == "2.718281828-1")
+	assert(t, diff.NewVersion.String() == "2.718281828-2")
+
+	assert(t, len(diff.AddedFields) == 1 && diff.AddedFields[0] == "Vcs-Git")
+	assert(t, len(diff.RemovedFields) == 1 && diff.RemovedFields[0] == "Homepage")
+
+	changed := map[string]control.FieldChange{}
+	for _, change := range diff.ChangedFields {
+		changed[change.Field] = change
+	}
+	assert(t, len(changed) == 2)
+	assert(t, changed["Version"].New == "2.718281828-2")
+	assert(t, changed["Maintainer"].Old == "Paul Tagliamonte <paultag@ubuntu.com>")
+
+	assert(t, len(diff.AddedBuildDepends) == 1)
+	assert(t, diff.AddedBuildDepends[0].String() == "debhelper-compat (= 13)")
+	assert(t, len(diff.RemovedBuildDepends) == 1)
+	assert(t, diff.RemovedBuildDepends[0].String() == "debhelper (>= 9)")
+
+	assert(t, len(diff.AddedFiles) == 1)
+	assert(t, diff.AddedFiles[0].Filename == "fbautostart_2.718281828-2.debian.tar.xz")
+	assert(t, len(diff.RemovedFiles) == 1)
+	assert(t, diff.RemovedFiles[0].Filename == "fbautostart_2.718281828-1.debian.tar.xz")
+
+	assert(t, control.DiffDSC(a, a).Empty())
+	assert(t, control.DiffDSC(b, a).VersionDelta < 0)
+}
+
 // vim: foldmethod=marker
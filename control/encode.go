@@ -21,11 +21,15 @@
 package control
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"reflect"
 	"strconv"
 	"strings"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
 )
 
 // Marshallable {{{
@@ -36,6 +40,13 @@ type Marshallable interface {
 	MarshalControl() (string, error)
 }
 
+// Marshaler is the same interface as Marshallable, following the naming used
+// by the encoding packages of the standard library. Anything that implements
+// one implements the other.
+type Marshaler interface {
+	Marshallable
+}
+
 // }}}
 
 // ConvertToParagraph {{{
@@ -60,6 +71,8 @@ func ConvertToParagraph(incoming interface{}) (*Paragraph, error) {
 func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 	order := []string{}
 	values := map[string]string{}
+	/* Lowercased keys the struct has fields for, and if they were written */
+	managed := map[string]bool{}
 
 	if data.Type().Kind() != reflect.Struct {
 		return nil, fmt.Errorf("Can only Decode a Struct")
@@ -79,23 +92,31 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 			continue
 		}
 
-		paragraphKey := fieldType.Name
-		if it := fieldType.Tag.Get("control"); it != "" {
-			paragraphKey = it
-		}
+		paragraphKeys := controlKeys(fieldType)
+		paragraphKey := paragraphKeys[0]
 
 		if paragraphKey == "-" {
 			/* If the key is "-", lets go ahead and skip it */
 			continue
 		}
 
+		/* The field is only ever written under its first key, so don't
+		 * carry any of the others over from the Paragraph either. */
+		for _, key := range paragraphKeys {
+			managed[strings.ToLower(key)] = false
+		}
+
 		data, err := marshalStructValue(field, fieldType)
 		if err != nil {
 			return nil, err
 		}
 
+		/* Empty values are left out, unless the field has to be there,
+		 * or is a pointer that was set, which is how a field that's
+		 * present but empty is told apart from one that's missing. */
 		required := fieldType.Tag.Get("required") == "true"
-		if data == "" && !required {
+		set := field.Kind() == reflect.Ptr && !field.IsNil()
+		if data == "" && !required && !set {
 			continue
 		}
 
@@ -103,10 +124,27 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 			data = "\n" + data
 		}
 
+		managed[strings.ToLower(paragraphKey)] = true
 		order = append(order, paragraphKey)
 		values[paragraphKey] = data
 	}
-	para := foundParagraph.Update(Paragraph{Order: order, Values: values})
+
+	/* Fields the struct knows about are written from the struct, so if
+	 * one was emptied out, don't fall back to what was parsed. Everything
+	 * else in the Paragraph is carried over where it was. */
+	carried := Paragraph{
+		Order:    []string{},
+		Values:   map[string]string{},
+		Comments: foundParagraph.Comments,
+	}
+	for _, key := range foundParagraph.Order {
+		if written, ok := managed[strings.ToLower(key)]; written || !ok {
+			carried.Order = append(carried.Order, key)
+			carried.Values[key] = foundParagraph.Values[key]
+		}
+	}
+
+	para := carried.Update(Paragraph{Order: order, Values: values})
 	return &para, nil
 }
 
@@ -115,6 +153,15 @@ func convertToParagraph(data reflect.Value) (*Paragraph, error) {
 // convert a struct value {{{
 
 func marshalStructValue(field reflect.Value, fieldType reflect.StructField) (string, error) {
+	/* Types that know how to write themselves out get first dibs, no
+	 * matter what kind of type they are underneath. */
+	if marshal, ok := field.Interface().(Marshallable); ok {
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			return "", nil
+		}
+		return marshal.MarshalControl()
+	}
+
 	switch field.Type().Kind() {
 	case reflect.String:
 		return field.String(), nil
@@ -123,6 +170,9 @@ func marshalStructValue(field reflect.Value, fieldType reflect.StructField) (str
 	case reflect.Int:
 		return strconv.Itoa(int(field.Int())), nil
 	case reflect.Ptr:
+		if field.IsNil() {
+			return "", nil
+		}
 		return marshalStructValue(field.Elem(), fieldType)
 	case reflect.Slice:
 		return marshalStructValueSlice(field, fieldType)
@@ -163,10 +213,27 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 	if it := fieldType.Tag.Get("delim"); it != "" {
 		delim = it
 	}
+
+	/* If the Unmarshaler was stripping spaces off each element, go
+	 * ahead and put one back after the delim, so `delim:","` comes
+	 * back out as "foo, bar" */
+	if strings.Contains(fieldType.Tag.Get("strip"), " ") &&
+		strings.TrimSpace(delim) != "" && !strings.HasSuffix(delim, " ") {
+		delim = delim + " "
+	}
+
 	data := []string{}
 
 	for i := 0; i < field.Len(); i++ {
 		elem := field.Index(i)
+		if _, ok := elem.Interface().(Marshallable); !ok && isColumnStruct(elem.Type()) {
+			stringification, err := marshalColumns(elem)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, stringification)
+			continue
+		}
 		if stringification, err := marshalStructValue(elem, fieldType); err != nil {
 			return "", err
 		} else {
@@ -181,6 +248,45 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 
 // }}}
 
+// convert a slice element of type struct, column by column {{{
+
+// Internal method to write out each column of a struct that doesn't
+// implement Marshallable, separated by spaces, as read in by decodeColumns.
+// Empty trailing columns are left off.
+func marshalColumns(elem reflect.Value) (string, error) {
+	values := []string{}
+	for _, column := range columnFields(elem) {
+		value, err := marshalStructValue(column.value, column.field)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	return strings.Join(values, " "), nil
+}
+
+// }}}
+
+// countingWriter {{{
+
+// Wrapper around an io.Writer that keeps track of how many bytes have been
+// written through it, for use by io.WriterTo implementations.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// }}}
+
 // Marshal {{{
 
 // Marshal is a one-off interface to serialize a single object to a writer.
@@ -201,10 +307,19 @@ func marshalStructValueSlice(field reflect.Value, fieldType reflect.StructField)
 //
 // This code will attempt to unpack it into the struct based on the
 // literal name of the key, This can be overridden by the struct tag
-// `control:""`.
+// `control:""`. If the tag lists more than one key, the field is written
+// out under the first one.
 //
 // If you're dehydrating a list of strings, you have the option of defining
-// a string to join the tokens with (`delim:", "`).
+// a string to join the tokens with (`delim:", "`). If the field also strips
+// spaces off each token (`strip:" "`), a space is written after the delim.
+//
+// Slices of structs that don't implement Marshallable are written one
+// element per delim, with the fields of each element separated by spaces,
+// as read in by Unmarshal.
+//
+// Fields with an empty value are left out, with the exception of pointer
+// fields, which are written out (empty, if need be) unless they're nil.
 //
 // In order to Marshal a custom Struct, you are required to implement the
 // Marshallable interface. It's highly encouraged to put this interface on
@@ -220,11 +335,59 @@ func Marshal(writer io.Writer, data interface{}) error {
 
 // }}}
 
+// WriteSigned {{{
+
+// WriteSigned serializes a single object to a Paragraph, just like Marshal,
+// and writes it to the writer wrapped in an OpenPGP clearsignature made with
+// the private key of the given signer. This is how .dsc, .changes and
+// InRelease files are signed.
+//
+// The private key must already be decrypted.
+func WriteSigned(writer io.Writer, data interface{}, signer *openpgp.Entity) error {
+	if signer == nil || signer.PrivateKey == nil {
+		return fmt.Errorf("No private key to sign with")
+	}
+	if signer.PrivateKey.Encrypted {
+		return fmt.Errorf("Private key must be decrypted before signing")
+	}
+
+	paragraph := bytes.Buffer{}
+	if err := Marshal(&paragraph, data); err != nil {
+		return err
+	}
+
+	/* clearsign takes care of the dash-escaping and the canonical line
+	 * endings the signature is computed over, which is what gpg does. */
+	plaintext, err := clearsign.Encode(writer, signer.PrivateKey, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := plaintext.Write(paragraph.Bytes()); err != nil {
+		return err
+	}
+	return plaintext.Close()
+}
+
+// }}}
+
 // Encoder {{{
 
 // Encoder is a struct that allows for the streaming Encoding of data
 // back out to an `io.Writer`. Most notably, this will separate
-// subsequent `Encode` calls of a Struct with a newline.
+// subsequent `Encode` calls of a Struct with a newline. Exactly one blank
+// line is written between each Paragraph, and none after the last one, so
+// a Packages file may be written out one stanza at a time:
+//
+//     encoder, _ := control.NewEncoder(writer)
+//     for _, index := range indexes {
+//         if err := encoder.Encode(index); err != nil {
+//             return err
+//         }
+//     }
+//     return encoder.Flush()
+//
+// Structs without any fields to write out are skipped, rather than being
+// written as an empty Paragraph.
 //
 // It's also worth noting that this *will* also write out elements that
 // were Unmarshaled into a Struct without a member of that name if (and only
@@ -238,10 +401,16 @@ func Marshal(writer io.Writer, data interface{}) error {
 //
 // This code will attempt to unpack it into the struct based on the
 // literal name of the key, This can be overridden by the struct tag
-// `control:""`.
+// `control:""`. If the tag lists more than one key, the field is written
+// out under the first one.
 //
 // If you're dehydrating a list of strings, you have the option of defining
-// a string to join the tokens with (`delim:", "`).
+// a string to join the tokens with (`delim:", "`). If the field also strips
+// spaces off each token (`strip:" "`), a space is written after the delim.
+//
+// Slices of structs that don't implement Marshallable are written one
+// element per delim, with the fields of each element separated by spaces,
+// as read in by Unmarshal.
 //
 // In order to Marshal a custom Struct, you are required to implement the
 // Marshallable interface. It's highly encouraged to put this interface on
@@ -264,6 +433,19 @@ func NewEncoder(writer io.Writer) (*Encoder, error) {
 
 // }}}
 
+// Flush {{{
+
+// Flush the io.Writer the Encoder was configured with, if it's buffered
+// (such as a bufio.Writer). Writers that aren't buffered are left alone.
+func (e *Encoder) Flush() error {
+	if flusher, ok := e.writer.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+	return nil
+}
+
+// }}}
+
 // Encode {{{
 
 // Take a Struct, Encode it into a Paragraph, and write that out to the
@@ -307,16 +489,21 @@ func (e *Encoder) encodeSlice(data reflect.Value) error {
 // Encode a Struct {{{
 
 func (e *Encoder) encodeStruct(data reflect.Value) error {
+	paragraph, err := convertToParagraph(data)
+	if err != nil {
+		return err
+	}
+	if len(paragraph.Order) == 0 && len(paragraph.Comments) == 0 {
+		/* Nothing to write; and writing the separator anyway would leave
+		 * two blank lines in a row. */
+		return nil
+	}
 	if e.alreadyWritten {
 		_, err := e.writer.Write([]byte("\n"))
 		if err != nil {
 			return err
 		}
 	}
-	paragraph, err := convertToParagraph(data)
-	if err != nil {
-		return err
-	}
 	e.alreadyWritten = true
 	return paragraph.WriteTo(e.writer)
 }
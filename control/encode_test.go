@@ -1,13 +1,18 @@
 package control_test
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/cinello/go-debian/control"
 	"github.com/cinello/go-debian/dependency"
 	"github.com/cinello/go-debian/version"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
 )
 
 type TestMarshalStruct struct {
@@ -42,6 +47,32 @@ X-A-Test: Foo
 `)
 }
 
+func TestExtraMarshalPosition(t *testing.T) {
+	el := TestParaMarshalStruct{}
+
+	isok(t, control.Unmarshal(&el, strings.NewReader(`X-Before: 1
+foo: test
+X-After: 2
+`)))
+	el.Foo = "changed"
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == `X-Before: 1
+Foo: changed
+X-After: 2
+`)
+
+	/* Emptying a known field drops it, rather than bringing back what
+	 * was parsed. */
+	el.Foo = ""
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == `X-Before: 1
+X-After: 2
+`)
+}
+
 func TestBasicMarshal(t *testing.T) {
 	testStruct := TestMarshalStruct{Foo: "Hello"}
 
@@ -73,6 +104,27 @@ Foo: Hello
 `)
 }
 
+func TestEncoderStream(t *testing.T) {
+	out := bytes.Buffer{}
+	writer := bufio.NewWriter(&out)
+	encoder, err := control.NewEncoder(writer)
+	isok(t, err)
+
+	for _, foo := range []string{"Hello", "", "World"} {
+		isok(t, encoder.Encode(TestMarshalStruct{Foo: foo}))
+	}
+	isok(t, encoder.Encode([]TestMarshalStruct{{Foo: "Again"}}))
+	assert(t, out.Len() == 0)
+
+	isok(t, encoder.Flush())
+	assert(t, out.String() == `Foo: Hello
+
+Foo: World
+
+Foo: Again
+`)
+}
+
 func TestExternalMarshal(t *testing.T) {
 	testStruct := SomeComplexStruct{}
 	isok(t, control.Unmarshal(&testStruct, strings.NewReader(`Version: 1.0-1
@@ -93,6 +145,63 @@ X-Foo: bar
 `)
 }
 
+// A non-struct type with its own control representation.
+type urgency int
+
+func (u *urgency) UnmarshalControl(data string) error {
+	for i, el := range []string{"low", "medium", "high"} {
+		if el == data {
+			*u = urgency(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown urgency: %s", data)
+}
+
+func (u urgency) MarshalControl() (string, error) {
+	return []string{"low", "medium", "high"}[u], nil
+}
+
+type TestMarshalerStruct struct {
+	Urgency    urgency
+	Version    *version.Version
+	Dependency dependency.Dependency
+	Arch       dependency.Arch
+}
+
+func TestMarshalerMarshal(t *testing.T) {
+	var _ control.Marshaler = urgency(0)
+	var _ control.Unmarshaler = new(urgency)
+
+	input := `Urgency: medium
+Version: 1:2.0-1
+Dependency: foo:any (>= 1.0) [linux-any] <!nocheck>, bar | baz
+Arch: kfreebsd-amd64
+`
+	testStruct := TestMarshalerStruct{}
+	isok(t, control.Unmarshal(&testStruct, strings.NewReader(input)))
+	assert(t, testStruct.Urgency == 1)
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, testStruct))
+	assert(t, writer.String() == input)
+
+	notok(t, control.Unmarshal(&testStruct, strings.NewReader("Urgency: whenever\n")))
+}
+
+func TestChangesMarshal(t *testing.T) {
+	input := `Source: hello
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c 1131 devel optional hello_1.0-1.dsc
+`
+	changes := control.Changes{}
+	isok(t, control.Unmarshal(&changes, strings.NewReader(input)))
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, changes))
+	assert(t, writer.String() == input)
+}
+
 func TestMultilineMarshal(t *testing.T) {
 	testStruct := TestMarshalStruct{Foo: `Hello
 This
@@ -136,4 +245,76 @@ func TestBoolMarshal(t *testing.T) {
 `)
 }
 
+func TestCommentMarshal(t *testing.T) {
+	input := `# Leading comment
+Foo: test
+# Needed by some dh helper
+X-A-Test: Foo
+ bar
+# Trailing comment
+`
+	el := TestParaMarshalStruct{}
+
+	decoder, err := control.NewDecoder(strings.NewReader(input), nil)
+	isok(t, err)
+	decoder.PreserveComments()
+	isok(t, decoder.Decode(&el))
+
+	assert(t, len(el.Comments) == 3)
+	assert(t, el.Comments[0].Text == "# Leading comment")
+	assert(t, el.Comments[0].Line == 0)
+	assert(t, el.Comments[0].Field == "Foo")
+	assert(t, el.Comments[1].Line == 2)
+	assert(t, el.Comments[1].Field == "X-A-Test")
+	assert(t, el.Comments[2].Field == "")
+
+	el.Foo = "changed"
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == strings.Replace(input, "Foo: test", "Foo: changed", 1))
+
+	/* And by default, they're gone */
+	el = TestParaMarshalStruct{}
+	isok(t, control.Unmarshal(&el, strings.NewReader(input)))
+	assert(t, len(el.Comments) == 0)
+	writer = bytes.Buffer{}
+	isok(t, control.Marshal(&writer, el))
+	assert(t, writer.String() == `Foo: test
+X-A-Test: Foo
+ bar
+`)
+}
+
+func TestWriteSigned(t *testing.T) {
+	signer, err := openpgp.NewEntity("Test Signer", "", "signer@example.com", nil)
+	isok(t, err)
+
+	ver, err := version.Parse("1.0-1")
+	isok(t, err)
+	dsc := control.DSC{
+		Format:  "3.0 (quilt)",
+		Source:  "hello",
+		Version: ver,
+	}
+	dsc.Paragraph.Set("X-Comment", "- dashes need escaping")
+
+	signed := bytes.Buffer{}
+	isok(t, control.WriteSigned(&signed, &dsc, signer))
+
+	block, _ := clearsign.Decode(signed.Bytes())
+	assert(t, block != nil)
+	assert(t, strings.Contains(string(block.Plaintext), "Format: 3.0 (quilt)\n"))
+	assert(t, strings.Contains(string(block.Plaintext), "X-Comment: - dashes need escaping\n"))
+
+	parsed, entity, err := control.ParseDscSigned(
+		bufio.NewReader(bytes.NewReader(signed.Bytes())),
+		openpgp.EntityList{signer}, "",
+	)
+	isok(t, err)
+	assert(t, parsed.Source == "hello")
+	assert(t, entity.PrimaryKey.KeyId == signer.PrimaryKey.KeyId)
+
+	notok(t, control.WriteSigned(&signed, &dsc, nil))
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,432 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// {{{ Tarball extraction
+
+// Open the tarball at the given path, decompressing it based on the file
+// extension, as dpkg-source does.
+func openTarball(path string) (*tar.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader io.Reader
+	switch filepath.Ext(path) {
+	case ".gz", ".xz":
+		reader, err = NewDecompressingReader(f)
+	case ".bz2":
+		reader = bzip2.NewReader(bufio.NewReader(f))
+	case ".tar":
+		reader = f
+	default:
+		err = fmt.Errorf("Unknown tarball compression: '%s'", path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return tar.NewReader(reader), f, nil
+}
+
+// Check if every member of the tarball at the given path is within one
+// top-level directory (such as `hello-1.0/`), which is what dpkg-source
+// checks before it strips one.
+func singleTopLevelDir(path string) (bool, error) {
+	archive, closer, err := openTarball(path)
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+
+	top := ""
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return top != "", nil
+		} else if err != nil {
+			return false, err
+		}
+
+		name := filepath.Clean("/" + header.Name)[1:]
+		if name == "" {
+			continue
+		}
+		els := strings.SplitN(name, "/", 2)
+		if len(els) != 2 && header.Typeflag != tar.TypeDir {
+			return false, nil
+		}
+		if top != "" && top != els[0] {
+			return false, nil
+		}
+		top = els[0]
+	}
+}
+
+// Unpack the tarball at the given path into dest. If strip is set, and the
+// tarball has a single top-level directory (such as `hello-1.0/`), as orig
+// tarballs are expected to, that directory is dropped. A tarball without
+// one is unpacked as it is, as dpkg-source does. Members that would end up
+// outside of dest are an error.
+func extractTarball(path, dest string, strip bool) error {
+	if strip {
+		var err error
+		if strip, err = singleTopLevelDir(path); err != nil {
+			return err
+		}
+	}
+
+	archive, closer, err := openTarball(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	resolve := func(name string) (string, bool) {
+		name = filepath.Clean("/" + name)[1:]
+		if strip {
+			els := strings.SplitN(name, "/", 2)
+			if len(els) != 2 {
+				return "", false
+			}
+			name = els[1]
+		}
+		if name == "" {
+			return "", false
+		}
+		return filepath.Join(dest, name), true
+	}
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target, ok := resolve(header.Name)
+		if !ok {
+			continue
+		}
+
+		/* A symlink earlier in the tarball could otherwise be used to
+		 * write outside of dest */
+		if err := checkNoSymlinks(dest, filepath.Dir(target)); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		/* Nor can a symlink that's already there be followed by
+		 * whatever replaces it */
+		if err := removeSymlink(target); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode).Perm()|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeTarballMember(archive, target, os.FileMode(header.Mode).Perm()); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if !symlinkWithin(dest, target, header.Linkname) {
+				return fmt.Errorf("Bad symlink in %s: '%s' -> '%s'", path, header.Name, header.Linkname)
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, ok := resolve(header.Linkname)
+			if !ok {
+				return fmt.Errorf("Bad hardlink in %s: '%s'", path, header.Linkname)
+			}
+			if err := checkNoSymlinks(dest, filepath.Dir(source)); err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Check that none of the directories between dest and dir are symlinks.
+// Directories that don't exist yet are fine.
+func checkNoSymlinks(dest, dir string) error {
+	rel, err := filepath.Rel(dest, dir)
+	if err != nil {
+		return err
+	}
+	current := dest
+	for _, el := range strings.Split(rel, string(filepath.Separator)) {
+		if el == "." {
+			continue
+		}
+		current = filepath.Join(current, el)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Refusing to extract through symlink %s", current)
+		}
+	}
+	return nil
+}
+
+// Remove whatever is at target if it's a symlink, so that it's replaced,
+// rather than followed.
+func removeSymlink(target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return os.Remove(target)
+	}
+	return nil
+}
+
+// Check that a symlink at target, pointing at linkname, stays within dest.
+// Absolute links are refused, and so are links with a `..` anywhere but at
+// the start (such as `foo/../..`), since the `foo` may itself be a symlink,
+// which would make the `..` go somewhere other than it seems to. That
+// leaves links that go up a few directories, and then down into real ones,
+// which can be checked without looking at the disk.
+func symlinkWithin(dest, target, linkname string) bool {
+	if linkname == "" || filepath.IsAbs(linkname) {
+		return false
+	}
+	down := false
+	for _, el := range strings.Split(linkname, "/") {
+		switch el {
+		case "", ".":
+		case "..":
+			if down {
+				return false
+			}
+		default:
+			down = true
+		}
+	}
+	rel, err := filepath.Rel(dest, filepath.Join(filepath.Dir(target), linkname))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writeTarballMember(reader io.Reader, target string, mode os.FileMode) error {
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, reader)
+	cerr := out.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// }}}
+
+// {{{ quilt patches
+
+// Apply the patches listed in debian/patches/series of the unpacked source
+// tree at dest, in order, by way of patch(1), the same way dpkg-source does.
+// A missing series file means there's nothing to apply.
+func applyQuiltSeries(dest string) error {
+	patches := filepath.Join(dest, "debian", "patches")
+	series, err := os.Open(filepath.Join(patches, "series"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer series.Close()
+
+	scanner := bufio.NewScanner(series)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		els := strings.Fields(line)
+		if len(els) == 0 {
+			continue
+		}
+
+		name := filepath.Clean(els[0])
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Bad patch in series: '%s'", els[0])
+		}
+		if err := checkNoSymlinks(patches, filepath.Join(patches, name)); err != nil {
+			return err
+		}
+
+		/* A patch may be followed by the options to apply it with, such
+		 * as `-p0`; the default is -p1. Nothing else is passed on, as
+		 * options such as `-o` would write outside of the tree. */
+		args := []string{"-p1"}
+		if len(els) > 1 {
+			args = []string{}
+			for _, option := range els[1:] {
+				if !seriesOption(option) {
+					return fmt.Errorf("Unsupported option for patch '%s' in series: '%s'", els[0], option)
+				}
+				args = append(args, option)
+			}
+		}
+		args = append(args, "--quiet", "--forward", "--no-backup-if-mismatch",
+			"-i", filepath.Join(patches, name))
+
+		cmd := exec.Command("patch", args...)
+		cmd.Dir = dest
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("Applying patch '%s' failed: %s: %s", els[0], err, output)
+		}
+	}
+	return scanner.Err()
+}
+
+// Check if the option may follow a patch in the series file: the strip
+// level (`-pN`), or `-R` to reverse it.
+func seriesOption(option string) bool {
+	if option == "-R" {
+		return true
+	}
+	if !strings.HasPrefix(option, "-p") || len(option) == 2 {
+		return false
+	}
+	for _, r := range option[2:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// }}}
+
+// Unpack the source package described by the .dsc into destDir, which must
+// not exist yet. All the files the .dsc references are expected to be next
+// to it.
+//
+// The `3.0 (native)` and `3.0 (quilt)` formats are unpacked natively: the
+// orig tarball (and any orig-component tarballs, into a directory named
+// after the component) and the debian tarball are extracted, and the
+// patches in debian/patches/series are applied with patch(1). Any other
+// format, such as `1.0`, is handed off to `dpkg-source -x`.
+func (d *DSC) Extract(destDir string) error {
+	if _, err := os.Stat(destDir); err == nil {
+		return fmt.Errorf("Refusing to extract into existing directory %s", destDir)
+	}
+
+	parsed, err := d.SourceFormat()
+	if err != nil {
+		return err
+	}
+	format := parsed.String()
+	if format != "3.0 (native)" && format != "3.0 (quilt)" {
+		cmd := exec.Command("dpkg-source", "--no-check", "-x", d.Filename, destDir)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("dpkg-source failed: %s: %s", err, output)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	var debian string
+	for _, file := range d.AbsFiles() {
+		name := filepath.Base(file.Filename)
+		switch {
+		case strings.HasSuffix(name, ".asc"):
+			continue
+		case strings.Contains(name, ".debian.tar."):
+			debian = file.Filename
+			continue
+		case format == "3.0 (native)" && strings.Contains(name, ".tar"):
+			if err := extractTarball(file.Filename, destDir, true); err != nil {
+				return err
+			}
+		case strings.Contains(name, ".orig.tar."):
+			if err := extractTarball(file.Filename, destDir, true); err != nil {
+				return err
+			}
+		case strings.Contains(name, ".orig-"):
+			component := name[strings.Index(name, ".orig-")+len(".orig-"):]
+			if i := strings.Index(component, ".tar"); i > 0 {
+				component = component[:i]
+			} else {
+				return fmt.Errorf("Unknown orig tarball name: '%s'", name)
+			}
+			if err := extractTarball(file.Filename, filepath.Join(destDir, component), true); err != nil {
+				return err
+			}
+		}
+	}
+
+	if format == "3.0 (native)" {
+		return nil
+	}
+	if debian == "" {
+		return fmt.Errorf("No debian tarball listed in %s", d.Filename)
+	}
+
+	/* The debian tarball replaces whatever debian/ came with upstream */
+	if err := os.RemoveAll(filepath.Join(destDir, "debian")); err != nil {
+		return err
+	}
+	if err := extractTarball(debian, destDir, false); err != nil {
+		return err
+	}
+	return applyQuiltSeries(destDir)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,301 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+func writeTestTarball(t *testing.T, path string, files map[string]string) {
+	members := []testTarMember{}
+	for name, content := range files {
+		members = append(members, testTarMember{Name: name, Content: content})
+	}
+	writeTestTarballMembers(t, path, members)
+}
+
+// A member of a test tarball: a regular file with the given Content, or a
+// symlink if Linkname is set.
+type testTarMember struct {
+	Name     string
+	Content  string
+	Linkname string
+}
+
+func writeTestTarballMembers(t *testing.T, path string, members []testTarMember) {
+	out := bytes.Buffer{}
+	compressed := gzip.NewWriter(&out)
+	archive := tar.NewWriter(compressed)
+	for _, member := range members {
+		header := &tar.Header{
+			Name:     member.Name,
+			Mode:     0644,
+			Size:     int64(len(member.Content)),
+			Typeflag: tar.TypeReg,
+		}
+		if member.Linkname != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = member.Linkname
+			header.Size = 0
+		}
+		isok(t, archive.WriteHeader(header))
+		_, err := archive.Write([]byte(member.Content))
+		isok(t, err)
+	}
+	isok(t, archive.Close())
+	isok(t, compressed.Close())
+	isok(t, ioutil.WriteFile(path, out.Bytes(), 0644))
+}
+
+func writeTestSource(t *testing.T, dir, format string, tarballs map[string]map[string]string) *control.DSC {
+	files := ""
+	for name, members := range tarballs {
+		path := filepath.Join(dir, name)
+		writeTestTarball(t, path, members)
+		info, err := os.Stat(path)
+		isok(t, err)
+		files += fmt.Sprintf(" 00000000000000000000000000000000 %d %s\n", info.Size(), name)
+	}
+	dscPath := filepath.Join(dir, "hello_1.0-1.dsc")
+	isok(t, ioutil.WriteFile(dscPath, []byte("Format: "+format+`
+Source: hello
+Version: 1.0-1
+Files:
+`+files), 0644))
+	dsc, err := control.ParseDscFile(dscPath)
+	isok(t, err)
+	return dsc
+}
+
+func readTestFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	isok(t, err)
+	return string(data)
+}
+
+func TestDSCExtractQuilt(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch(1) is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	dsc := writeTestSource(t, dir, "3.0  (quilt)", map[string]map[string]string{
+		"hello_1.0.orig.tar.gz": {
+			"hello-1.0/hello.c":        "hello\n",
+			"hello-1.0/debian/control": "upstream packaging\n",
+		},
+		"hello_1.0.orig-docs.tar.gz": {
+			"docs/README": "read me\n",
+		},
+		"hello_1.0-1.debian.tar.gz": {
+			"debian/changelog":      "hello (1.0-1) unstable; urgency=medium\n",
+			"debian/patches/series": "# comment\nfix-greeting.patch\n",
+			"debian/patches/fix-greeting.patch": `--- a/hello.c
++++ b/hello.c
+@@ -1 +1 @@
+-hello
++hello, world
+`,
+		},
+	})
+
+	dest := filepath.Join(dir, "hello-1.0")
+	isok(t, dsc.Extract(dest))
+	assert(t, readTestFile(t, filepath.Join(dest, "hello.c")) == "hello, world\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "docs", "README")) == "read me\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "debian", "changelog")) != "")
+	_, err = os.Stat(filepath.Join(dest, "debian", "control"))
+	assert(t, os.IsNotExist(err))
+
+	notok(t, dsc.Extract(dest))
+}
+
+func TestDSCExtractNative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	dsc := writeTestSource(t, dir, "3.0 (native)", map[string]map[string]string{
+		"hello_1.0.tar.gz": {
+			"hello-1.0/hello.c":          "hello\n",
+			"hello-1.0/debian/changelog": "hello (1.0) unstable; urgency=medium\n",
+		},
+	})
+
+	dest := filepath.Join(dir, "out", "hello-1.0")
+	isok(t, dsc.Extract(dest))
+	assert(t, readTestFile(t, filepath.Join(dest, "hello.c")) == "hello\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "debian", "changelog")) != "")
+}
+
+func TestDSCExtractNoTopLevelDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	dsc := writeTestSource(t, dir, "3.0 (native)", map[string]map[string]string{
+		"hello_1.0.tar.gz": {
+			"hello.c":          "hello\n",
+			"src/main.c":       "main\n",
+			"debian/changelog": "hello (1.0) unstable; urgency=medium\n",
+			"../../escape":     "nope\n",
+		},
+	})
+
+	dest := filepath.Join(dir, "out", "hello-1.0")
+	isok(t, dsc.Extract(dest))
+	assert(t, readTestFile(t, filepath.Join(dest, "hello.c")) == "hello\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "src", "main.c")) == "main\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "debian", "changelog")) != "")
+	_, err = os.Stat(filepath.Join(dir, "escape"))
+	assert(t, os.IsNotExist(err))
+}
+
+func TestDSCExtractSymlinkOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	victim := filepath.Join(dir, "victim")
+	isok(t, ioutil.WriteFile(victim, []byte("original\n"), 0644))
+
+	dsc := writeTestSource(t, dir, "3.0 (native)", map[string]map[string]string{
+		"hello_1.0.tar.gz": {},
+	})
+	tarball := filepath.Join(dir, "hello_1.0.tar.gz")
+
+	/* A symlink out of the tree, followed by a file of the same name */
+	writeTestTarballMembers(t, tarball, []testTarMember{
+		{Name: "hello-1.0/x", Linkname: victim},
+		{Name: "hello-1.0/x", Content: "pwned\n"},
+	})
+	notok(t, dsc.Extract(filepath.Join(dir, "absolute")))
+	assert(t, readTestFile(t, victim) == "original\n")
+
+	for i, linkname := range []string{"../../victim", "sub/../../..", "sub/../.."} {
+		writeTestTarballMembers(t, tarball, []testTarMember{
+			{Name: "hello-1.0/sub/file", Content: "sub\n"},
+			{Name: "hello-1.0/x", Linkname: linkname},
+			{Name: "hello-1.0/x", Content: "pwned\n"},
+		})
+		notok(t, dsc.Extract(filepath.Join(dir, fmt.Sprintf("relative-%d", i))))
+		assert(t, readTestFile(t, victim) == "original\n")
+	}
+
+	/* Links that stay inside are fine, and are replaced rather than
+	 * followed by a later member of the same name */
+	writeTestTarballMembers(t, tarball, []testTarMember{
+		{Name: "hello-1.0/y", Content: "y\n"},
+		{Name: "hello-1.0/sub/up", Linkname: "../y"},
+		{Name: "hello-1.0/x", Linkname: "y"},
+		{Name: "hello-1.0/x", Content: "x\n"},
+	})
+	dest := filepath.Join(dir, "inside")
+	isok(t, dsc.Extract(dest))
+	assert(t, readTestFile(t, filepath.Join(dest, "y")) == "y\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "x")) == "x\n")
+	assert(t, readTestFile(t, filepath.Join(dest, "sub", "up")) == "y\n")
+	info, err := os.Lstat(filepath.Join(dest, "x"))
+	isok(t, err)
+	assert(t, info.Mode().IsRegular())
+}
+
+func TestDSCExtractBadSeries(t *testing.T) {
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch(1) is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	for i, series := range []string{
+		"../../../evil.patch\n",
+		"/tmp/evil.patch\n",
+		"good.patch -o ../../evil\n",
+	} {
+		dsc := writeTestSource(t, dir, "3.0 (quilt)", map[string]map[string]string{
+			"hello_1.0.orig.tar.gz": {
+				"hello-1.0/hello.c": "hello\n",
+			},
+			"hello_1.0-1.debian.tar.gz": {
+				"debian/patches/series": series,
+				"debian/patches/good.patch": `--- a/hello.c
++++ b/hello.c
+@@ -1 +1 @@
+-hello
++hello, world
+`,
+			},
+		})
+		err := dsc.Extract(filepath.Join(dir, fmt.Sprintf("hello-%d", i)))
+		notok(t, err)
+		assert(t, strings.Contains(err.Error(), "series"))
+	}
+}
+
+func TestDSCExtractDpkgSource(t *testing.T) {
+	if _, err := exec.LookPath("dpkg-source"); err != nil {
+		t.Skip("dpkg-source is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "go-debian-extract")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	/* 1.0 isn't unpacked natively, so this goes by way of dpkg-source */
+	dsc := writeTestSource(t, dir, "1.0", map[string]map[string]string{
+		"hello_1.0.orig.tar.gz": {
+			"hello-1.0/hello.c":          "hello\n",
+			"hello-1.0/debian/changelog": "hello (1.0-1) unstable; urgency=medium\n",
+		},
+	})
+
+	dest := filepath.Join(dir, "hello-1.0")
+	isok(t, dsc.Extract(dest))
+	assert(t, readTestFile(t, filepath.Join(dest, "hello.c")) == "hello\n")
+
+	/* dpkg-source's own complaints are passed along */
+	isok(t, os.Remove(filepath.Join(dir, "hello_1.0.orig.tar.gz")))
+	err = dsc.Extract(filepath.Join(dir, "missing"))
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "dpkg-source failed"))
+}
+
+// vim: foldmethod=marker
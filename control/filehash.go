@@ -22,6 +22,7 @@ package control
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
@@ -30,6 +31,7 @@ import (
 	"io"
 	"log"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -58,6 +60,81 @@ func FileHashFromHasher(path string, hasher hashio.Hasher) FileHash {
 
 type FileHashes []FileHash
 
+// A Checksum is an entry of one of the Files or Checksums-* fields, no
+// matter the algorithm. FileHash implements it, and so does every type
+// that embeds a FileHash, such as MD5FileHash, SHA1FileHash, SHA256FileHash
+// and SHA512FileHash, which allows for code that doesn't care which of
+// the fields an entry came from.
+type Checksum interface {
+	// The name of the file, as listed.
+	Path() string
+
+	// The size of the file, in bytes.
+	FileSize() int64
+
+	// The hex encoded hash of the file.
+	HashValue() string
+
+	// The name of the algorithm used, such as "md5" or "sha256".
+	HashAlgorithm() string
+}
+
+func (c FileHash) Path() string {
+	return c.Filename
+}
+
+func (c FileHash) FileSize() int64 {
+	return c.Size
+}
+
+func (c FileHash) HashValue() string {
+	return c.Hash
+}
+
+func (c FileHash) HashAlgorithm() string {
+	return c.Algorithm
+}
+
+// Return the entries of a slice of any of the FileHash types (such as a
+// []SHA256FileHash) as a []Checksum.
+func checksumsOf(entries interface{}) []Checksum {
+	value := reflect.ValueOf(entries)
+	ret := make([]Checksum, value.Len())
+	for i := range ret {
+		ret[i] = value.Index(i).Interface().(Checksum)
+	}
+	return ret
+}
+
+// Read the file at the given path once, and return its MD5, SHA1 and SHA256
+// FileHash entries, as listed in the Files, Checksums-Sha1 and
+// Checksums-Sha256 fields of a .dsc or .changes. The Filename of each
+// entry is the base name of the path.
+func HashFile(path string) (MD5FileHash, SHA1FileHash, SHA256FileHash, error) {
+	hashes, err := HashFileAlgorithms(path, []string{"md5", "sha1", "sha256"})
+	if err != nil {
+		return MD5FileHash{}, SHA1FileHash{}, SHA256FileHash{}, err
+	}
+	return MD5FileHash{FileHash: hashes[0]}, SHA1FileHash{hashes[1]}, SHA256FileHash{hashes[2]}, nil
+}
+
+// Read the file at the given path once, and return a FileHash for each of
+// the given algorithms (such as "sha512"), in the same order. The Filename
+// of each entry is the base name of the path.
+func HashFileAlgorithms(path string, algorithms []string) ([]FileHash, error) {
+	hashers, err := hashFile(context.Background(), path, algorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := filepath.Base(path)
+	ret := []FileHash{}
+	for _, hasher := range hashers {
+		ret = append(ret, FileHashFromHasher(filename, *hasher))
+	}
+	return ret, nil
+}
+
 type verifier struct {
 	h      hash.Hash
 	want   []byte
@@ -109,6 +186,23 @@ func (c *FileHash) Verifier() (io.WriteCloser, error) {
 	return &verifier{h: h, want: sum}, nil
 }
 
+// VerifyReader returns an io.Reader which reads from the given Reader,
+// checking the data against the size and hash of the FileHash as it goes.
+// Rather than io.EOF, the final Read returns an error if they don't match,
+// so a file can be verified while it's being downloaded.
+//
+// Example:
+//     reader, err := fh.VerifyReader(resp.Body)
+//     if err != nil {
+//         return err
+//     }
+//     if _, err := io.Copy(f, reader); err != nil {
+//         return err
+//     }
+func (c *FileHash) VerifyReader(reader io.Reader) (io.Reader, error) {
+	return hashio.NewVerifyReader(reader, c.Algorithm, c.Hash, c.Size)
+}
+
 // {{{ Hash File implementations
 
 // ByHashPath returns the corresponding /by-hash/<algorithm>/<hash> path.
@@ -121,11 +215,14 @@ func (c *FileHash) marshalControl() (string, error) {
 	return fmt.Sprintf("%s %d %s", c.Hash, c.Size, c.Filename), nil
 }
 
+// Read a `hash size name` line. The columns may be separated by any run of
+// whitespace, as some hand-edited files have them, but there have to be
+// exactly three of them.
 func (c *FileHash) unmarshalControl(algorithm, data string) error {
 	var err error
 	c.Algorithm = algorithm
 	vals := strings.Fields(data)
-	if len(vals) < 3 {
+	if len(vals) != 3 {
 		return fmt.Errorf("Error: Unknown Debian Hash line: '%s'", data)
 	}
 
@@ -146,14 +243,40 @@ func (c *FileHash) unmarshalControl(algorithm, data string) error {
 
 // {{{ MD5 FileHash
 
-type MD5FileHash struct{ FileHash }
+// An MD5FileHash is an entry of a Files field. In a .dsc, that's the hash,
+// size and name of the file, while in a .changes the Section and Priority
+// of the file come before the name, such as:
+//
+//   c0b2fca5b6b5482bd1f1ed848e4d8c39 1024 devel optional hello_1.0-1_amd64.deb
+//
+// Section and Priority are left empty when they aren't given. They're
+// written out together, so setting only one of them is an error.
+type MD5FileHash struct {
+	FileHash
+
+	Section  string
+	Priority string
+}
 
 func (c *MD5FileHash) UnmarshalControl(data string) error {
-	return c.unmarshalControl("md5", data)
+	vals := strings.Fields(data)
+	if len(vals) != 5 {
+		c.Section, c.Priority = "", ""
+		return c.unmarshalControl("md5", data)
+	}
+	c.Section = vals[2]
+	c.Priority = vals[3]
+	return c.unmarshalControl("md5", strings.Join([]string{vals[0], vals[1], vals[4]}, " "))
 }
 
 func (c MD5FileHash) MarshalControl() (string, error) {
-	return c.marshalControl()
+	if c.Section == "" && c.Priority == "" {
+		return c.marshalControl()
+	}
+	if c.Section == "" || c.Priority == "" {
+		return "", fmt.Errorf("Both a Section and a Priority are needed for '%s'", c.Filename)
+	}
+	return fmt.Sprintf("%s %d %s %s %s", c.Hash, c.Size, c.Section, c.Priority, c.Filename), nil
 }
 
 // }}}
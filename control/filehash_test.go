@@ -22,6 +22,16 @@ package control_test
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -46,3 +56,175 @@ SHA256:
 		t.Errorf("control.Unmarshal unexpectedly succeeded on struct without delim")
 	}
 }
+
+func TestMD5FileHashColumns(t *testing.T) {
+	hash := control.MD5FileHash{}
+	isok(t, hash.UnmarshalControl("c0b2fca5b6b5482bd1f1ed848e4d8c39 1024 hello_1.0.orig.tar.gz"))
+	assert(t, hash.Filename == "hello_1.0.orig.tar.gz")
+	assert(t, hash.Section == "" && hash.Priority == "")
+	line, err := hash.MarshalControl()
+	isok(t, err)
+	assert(t, line == "c0b2fca5b6b5482bd1f1ed848e4d8c39 1024 hello_1.0.orig.tar.gz")
+
+	isok(t, hash.UnmarshalControl("c0b2fca5b6b5482bd1f1ed848e4d8c39 1024 devel optional hello_1.0-1_amd64.deb"))
+	assert(t, hash.Algorithm == "md5")
+	assert(t, hash.Size == 1024)
+	assert(t, hash.Section == "devel")
+	assert(t, hash.Priority == "optional")
+	assert(t, hash.Filename == "hello_1.0-1_amd64.deb")
+	line, err = hash.MarshalControl()
+	isok(t, err)
+	assert(t, line == "c0b2fca5b6b5482bd1f1ed848e4d8c39 1024 devel optional hello_1.0-1_amd64.deb")
+
+	notok(t, hash.UnmarshalControl("c0b2fca5b6b5482bd1f1ed848e4d8c39 1024"))
+
+	/* Either one on its own would leave a gap in the columns */
+	hash.Section, hash.Priority = "devel", ""
+	_, err = hash.MarshalControl()
+	notok(t, err)
+	hash.Section, hash.Priority = "", "optional"
+	_, err = hash.MarshalControl()
+	notok(t, err)
+}
+
+func TestFileHashVerifyReader(t *testing.T) {
+	data := "Package: hello\n"
+	fh := control.FileHash{
+		Algorithm: "sha256",
+		Hash:      fmt.Sprintf("%x", sha256.Sum256([]byte(data))),
+		Size:      int64(len(data)),
+		Filename:  "Packages",
+	}
+
+	reader, err := fh.VerifyReader(strings.NewReader(data))
+	isok(t, err)
+	out := bytes.Buffer{}
+	_, err = io.Copy(&out, reader)
+	isok(t, err)
+	assert(t, out.String() == data)
+
+	reader, err = fh.VerifyReader(strings.NewReader("Package: HELLO\n"))
+	isok(t, err)
+	_, err = ioutil.ReadAll(reader)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "sha256 mismatch"))
+
+	reader, err = fh.VerifyReader(strings.NewReader(data + "Version: 1.0\n"))
+	isok(t, err)
+	_, err = ioutil.ReadAll(reader)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "Size mismatch"))
+
+	reader, err = fh.VerifyReader(strings.NewReader("Pack"))
+	isok(t, err)
+	_, err = ioutil.ReadAll(reader)
+	notok(t, err)
+}
+
+func TestHashFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-debian-filehash")
+	isok(t, err)
+	defer os.RemoveAll(dir)
+
+	data := []byte("upstream tarball")
+	path := filepath.Join(dir, "hello_1.0.orig.tar.gz")
+	isok(t, ioutil.WriteFile(path, data, 0644))
+
+	md5sum, sha1sum, sha256sum, err := control.HashFile(path)
+	isok(t, err)
+	for _, fh := range []control.FileHash{md5sum.FileHash, sha1sum.FileHash, sha256sum.FileHash} {
+		assert(t, fh.Filename == "hello_1.0.orig.tar.gz")
+		assert(t, fh.Size == int64(len(data)))
+	}
+	assert(t, md5sum.Algorithm == "md5")
+	assert(t, md5sum.Hash == fmt.Sprintf("%x", md5.Sum(data)))
+	assert(t, sha1sum.Hash == fmt.Sprintf("%x", sha1.Sum(data)))
+	assert(t, sha256sum.Hash == fmt.Sprintf("%x", sha256.Sum256(data)))
+
+	_, _, _, err = control.HashFile(filepath.Join(dir, "missing"))
+	notok(t, err)
+
+	hashes, err := control.HashFileAlgorithms(path, []string{"sha512"})
+	isok(t, err)
+	assert(t, len(hashes) == 1)
+	assert(t, hashes[0].Algorithm == "sha512")
+	assert(t, hashes[0].Hash == fmt.Sprintf("%x", sha512.Sum512(data)))
+
+	_, err = control.HashFileAlgorithms(path, []string{"crc32"})
+	notok(t, err)
+}
+
+func TestChecksumInterface(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: hello
+Version: 1.0-1
+Checksums-Sha1:
+ bc36310c15edc9acf48f0a1daf548bcc6f861372 92748 hello_1.0.orig.tar.gz
+Checksums-Sha256:
+ bb2fdfd4a38505905222ee02d8236a594bdf6eaefca23462294cacda631745c1 92748 hello_1.0.orig.tar.gz
+Files:
+ 06495f9b23b1c9b1bf35c2346cb48f63 92748 hello_1.0.orig.tar.gz
+`))
+	dsc, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	checksums := dsc.Checksums()
+	assert(t, len(checksums) == 3)
+
+	algorithms := []string{}
+	for _, checksum := range checksums {
+		assert(t, checksum.Path() == "hello_1.0.orig.tar.gz")
+		assert(t, checksum.FileSize() == 92748)
+		algorithms = append(algorithms, checksum.HashAlgorithm())
+	}
+	assert(t, strings.Join(algorithms, " ") == "md5 sha1 sha256")
+	assert(t, checksums[0].HashValue() == "06495f9b23b1c9b1bf35c2346cb48f63")
+
+	var _ control.Checksum = control.FileListChangesFileHash{}
+	var _ control.Checksum = control.SHA512FileHash{}
+}
+
+func TestMessyChecksumsParse(t *testing.T) {
+	/* As found in hand-edited .dsc files: runs of spaces and tabs between
+	 * the columns, trailing whitespace, and stray blank lines. */
+	reader := bufio.NewReader(strings.NewReader("Source: fbautostart\n" +
+		"Checksums-Sha256:\n" +
+		"   bb2fdfd4a38505905222ee02d8236a594bdf6eaefca23462294cacda631745c1   92748  fbautostart_2.718281828.orig.tar.gz  \n" +
+		" \n" +
+		" f7186d1bebde403527b5b3fd80406decaaf295366206667d5b402da962f0b772\t2356\tfbautostart_2.718281828-1.debian.tar.xz\n" +
+		"Files:\n" +
+		" 06495f9b23b1c9b1bf35c2346cb48f63  92748 fbautostart_2.718281828.orig.tar.gz\n" +
+		" .\n" +
+		" f58c0e0bf4d56461e776232484c07301 2356   fbautostart_2.718281828-1.debian.tar.xz\n"))
+	dsc, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	assert(t, len(dsc.ChecksumsSha256) == 2)
+	assert(t, dsc.ChecksumsSha256[0].Size == 92748)
+	assert(t, dsc.ChecksumsSha256[0].Filename == "fbautostart_2.718281828.orig.tar.gz")
+	assert(t, dsc.ChecksumsSha256[1].Filename == "fbautostart_2.718281828-1.debian.tar.xz")
+	assert(t, len(dsc.Files) == 2)
+	assert(t, dsc.Files[1].Hash == "f58c0e0bf4d56461e776232484c07301")
+
+	changes, err := control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c  1131 devel  optional	hello_1.0-1.dsc
+`)), "")
+	isok(t, err)
+	assert(t, len(changes.Files) == 1)
+	assert(t, changes.Files[0].Priority == "optional")
+	assert(t, changes.Files[0].Filename == "hello_1.0-1.dsc")
+
+	for _, line := range []string{
+		"06495f9b23b1c9b1bf35c2346cb48f63 92748",
+		"06495f9b23b1c9b1bf35c2346cb48f63 92748 foo.tar.gz extra",
+		"06495f9b23b1c9b1bf35c2346cb48f63 big foo.tar.gz",
+	} {
+		_, err := control.ParseDsc(bufio.NewReader(strings.NewReader("Source: foo\nChecksums-Sha1:\n "+line+"\n")), "")
+		notok(t, err)
+	}
+	_, err = control.ParseChanges(bufio.NewReader(strings.NewReader(`Source: hello
+Files:
+ a74c9e3e9fe05d480d24cd43b225ee0c 1131 devel hello_1.0-1.dsc
+`)), "")
+	notok(t, err)
+}
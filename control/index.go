@@ -22,6 +22,7 @@ package control
 
 import (
 	"bufio"
+	"path"
 	"strings"
 
 	"github.com/cinello/go-debian/dependency"
@@ -45,12 +46,16 @@ type BinaryIndex struct {
 	Maintainer     string
 	Architecture   dependency.Arch
 	MultiArch      string `control:"Multi-Arch"`
+	Depends        dependency.Dependency
+	Recommends     dependency.Dependency
+	Suggests       dependency.Dependency
+	Provides       dependency.Dependency
 	Description    string
 	Homepage       string
 	DescriptionMD5 string   `control:"Description-md5"`
 	Tags           []string `delim:", "`
-	Section        string
-	Priority       string
+	Section        Section
+	Priority       Priority
 	Filename       string
 	Size           string
 	MD5sum         string
@@ -58,6 +63,23 @@ type BinaryIndex struct {
 	SHA256         string
 
 	DebugBuildIds []string `control:"Build-Ids" delim:" "`
+
+	/* Read from the control.tar by ParseDebControl */
+	conffiles []string          `control:"-"`
+	md5sums   map[string]string `control:"-"`
+}
+
+// Return the paths of the files the package marks as conffiles, if it was
+// read out of a .deb by ParseDebControl, or nil otherwise.
+func (index *BinaryIndex) Conffiles() []string {
+	return index.conffiles
+}
+
+// Return the md5 hash of each file in the package, by path (relative to the
+// root of the filesystem, without a leading `/`, as listed in the md5sums
+// file), if it was read out of a .deb by ParseDebControl, or nil otherwise.
+func (index *BinaryIndex) Md5sums() map[string]string {
+	return index.md5sums
 }
 
 // Parse the Depends Dependency relation on this package.
@@ -70,6 +92,11 @@ func (index *BinaryIndex) GetSuggests() dependency.Dependency {
 	return index.getOptionalDependencyField("Suggests")
 }
 
+// Parse the Provides relation on this package.
+func (index *BinaryIndex) GetProvides() dependency.Dependency {
+	return index.getOptionalDependencyField("Provides")
+}
+
 // Parse the Depends Breaks relation on this package.
 func (index *BinaryIndex) GetBreaks() dependency.Dependency {
 	return index.getOptionalDependencyField("Breaks")
@@ -112,7 +139,7 @@ func (index *BinaryIndex) SourcePackage() string {
 // process but most not be used directly. Use the Checksums() accessor instead.
 type BestChecksums struct {
 	ChecksumsSha256 []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t "`
-	ChecksumsSha512 []SHA256FileHash `control:"Checksums-Sha512" delim:"\n" strip:"\n\r\t "`
+	ChecksumsSha512 []SHA512FileHash `control:"Checksums-Sha512" delim:"\n" strip:"\n\r\t "`
 }
 
 // Checksums returns FileHashes of a cryptographically secure kind.
@@ -155,17 +182,39 @@ type SourceIndex struct {
 
 	Architecture []dependency.Arch
 
-	StandardsVersion string
+	StandardsVersion string `control:"Standards-Version"`
 	Format           string
-	Files            []string `delim:"\n"`
-	VcsBrowser       string   `control:"Vcs-Browser"`
-	VcsGit           string   `control:"Vcs-Git"`
-	VcsSvn           string   `control:"Vcs-Svn"`
-	VcsBzr           string   `control:"Vcs-Bzr"`
+	VcsBrowser       string `control:"Vcs-Browser"`
+	VcsGit           string `control:"Vcs-Git"`
+	VcsSvn           string `control:"Vcs-Svn"`
+	VcsBzr           string `control:"Vcs-Bzr"`
 	Homepage         string
 	Directory        string
-	Priority         string
-	Section          string
+	Priority         Priority
+	Section          Section
+
+	BuildDepends      dependency.Dependency `control:"Build-Depends"`
+	BuildDependsArch  dependency.Dependency `control:"Build-Depends-Arch"`
+	BuildDependsIndep dependency.Dependency `control:"Build-Depends-Indep"`
+
+	ChecksumsSha1   []SHA1FileHash   `control:"Checksums-Sha1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	ChecksumsSha256 []SHA256FileHash `control:"Checksums-Sha256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	Files           []MD5FileHash    `control:"Files" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// Return a list of MD5FileHash entries from the `Files` entry, with the
+// exception that each `Filename` will be joined to the `Directory` of
+// the source package, giving the path to each file relative to the root
+// of the archive mirror, such as `pool/main/h/hello/hello_2.10-1.dsc`.
+func (index *SourceIndex) PoolFiles() []MD5FileHash {
+	ret := []MD5FileHash{}
+
+	for _, hash := range index.Files {
+		hash.Filename = path.Join(index.Directory, hash.Filename)
+		ret = append(ret, hash)
+	}
+
+	return ret
 }
 
 // Parse the Depends Build-Depends relation on this package.
@@ -197,4 +246,40 @@ func ParseSourceIndex(reader *bufio.Reader) (ret []SourceIndex, err error) {
 	return ret, err
 }
 
+// Given a path on the filesystem, parse out a list of BinaryIndex structs.
+// The file may be compressed with gzip or xz (such as Packages.gz), in which
+// case it will be decompressed as it's read.
+func ParseBinaryIndexFile(path string) (ret []BinaryIndex, err error) {
+	err = parseMaybeCompressedFile(path, func(reader *bufio.Reader) error {
+		ret, err = ParseBinaryIndex(reader)
+		return err
+	})
+	return ret, err
+}
+
+// Given the path to an APT Packages file (which may be compressed), parse
+// out a list of BinaryIndex structs. This is the same as calling
+// ParseBinaryIndexFile.
+func ParsePackagesFile(path string) ([]BinaryIndex, error) {
+	return ParseBinaryIndexFile(path)
+}
+
+// Given a path on the filesystem, parse out a list of SourceIndex structs.
+// The file may be compressed with gzip or xz (such as Sources.xz), in which
+// case it will be decompressed as it's read.
+func ParseSourceIndexFile(path string) (ret []SourceIndex, err error) {
+	err = parseMaybeCompressedFile(path, func(reader *bufio.Reader) error {
+		ret, err = ParseSourceIndex(reader)
+		return err
+	})
+	return ret, err
+}
+
+// Given the path to an APT Sources file (which may be compressed), parse
+// out a list of SourceIndex structs. This is the same as calling
+// ParseSourceIndexFile.
+func ParseSourcesFile(path string) ([]SourceIndex, error) {
+	return ParseSourceIndexFile(path)
+}
+
 // vim: foldmethod=marker
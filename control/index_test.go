@@ -94,6 +94,19 @@ Section: misc
 	fbautostart := sources[1]
 	assert(t, fbautostart.Maintainer == "Paul Tagliamonte <paultag@ubuntu.com>")
 	assert(t, fbautostart.VcsGit == "git://git.debian.org/collab-maint/fbautostart.git")
+	assert(t, fbautostart.StandardsVersion == "3.9.3")
+	assert(t, fbautostart.BuildDepends.Relations[0].Possibilities[0].Name == "debhelper")
+
+	assert(t, len(fbautostart.Files) == 3)
+	assert(t, len(fbautostart.ChecksumsSha1) == 3)
+	assert(t, len(fbautostart.ChecksumsSha256) == 3)
+	assert(t, fbautostart.Files[1].Hash == "06495f9b23b1c9b1bf35c2346cb48f63")
+
+	poolFiles := fbautostart.PoolFiles()
+	assert(t, len(poolFiles) == 3)
+	assert(t, poolFiles[0].Filename == "pool/main/f/fbautostart/fbautostart_2.718281828-1.dsc")
+	assert(t, poolFiles[0].Size == 1899)
+	assert(t, fbautostart.Files[0].Filename == "fbautostart_2.718281828-1.dsc")
 }
 
 func TestBinaryIndexParse(t *testing.T) {
@@ -189,6 +202,34 @@ SHA256: fa53e4f50349c5c9b564b8dc1da86c503b0baf56ab95a4ef6e204b6f77bfe70c
 	ddms := sources[0]
 	ddmsDepends := ddms.GetDepends()
 	assert(t, ddmsDepends.GetAllPossibilities()[0].Version.Number == "22.2+git20130830~92d25d6-1")
+
+	assert(t, len(ddms.Depends.Relations) == 5)
+	assert(t, ddms.Depends.Relations[4].Possibilities[0].Name == "eclipse-rcp")
+	assert(t, len(ddms.Recommends.Relations) == 0)
+}
+
+func TestBinaryIndexRecommendsParse(t *testing.T) {
+	// Test Binary Index {{{
+	reader := bufio.NewReader(strings.NewReader(`Package: hello
+Version: 2.10-1
+Architecture: amd64
+Depends: libc6 (>= 2.14)
+Recommends: hello-doc
+Suggests: hello-traditional | hello-debhelper
+Filename: pool/main/h/hello/hello_2.10-1_amd64.deb
+Size: 56132
+`))
+	// }}}
+	index, err := control.ParseBinaryIndex(reader)
+	isok(t, err)
+	assert(t, len(index) == 1)
+
+	hello := index[0]
+	assert(t, hello.Architecture.CPU == "amd64")
+	assert(t, hello.Depends.Relations[0].Possibilities[0].Version.Operator == ">=")
+	assert(t, hello.Recommends.Relations[0].Possibilities[0].Name == "hello-doc")
+	assert(t, len(hello.Suggests.Relations[0].Possibilities) == 2)
+	assert(t, hello.Size == "56132")
 }
 
 // vim: foldmethod=marker
@@ -0,0 +1,99 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Maintainer is the parsed form of a Maintainer field, or one entry of
+// an Uploaders field, which looks something like:
+//
+//   Paul Tagliamonte <paultag@debian.org>
+//   "Smith, John" <john@example.org>
+type Maintainer struct {
+	Name  string
+	Email string
+}
+
+// Parse a `Name <email>` address, as used in the Maintainer, Uploaders and
+// Changed-By fields. The Name may be wrapped in double quotes (which is
+// required by RFC5322 if it contains a comma), in which case the quotes are
+// removed. An address without the angle brackets, or without a Name, is an
+// error.
+func ParseMaintainer(s string) (name, email string, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasSuffix(s, ">") {
+		return "", "", fmt.Errorf("Maintainer '%s' has no <email>", s)
+	}
+	start := strings.LastIndex(s, "<")
+	if start < 0 {
+		return "", "", fmt.Errorf("Maintainer '%s' has no <email>", s)
+	}
+
+	email = s[start+1 : len(s)-1]
+	at := strings.Index(email, "@")
+	if at <= 0 || at == len(email)-1 || strings.Count(email, "@") != 1 ||
+		strings.ContainsAny(email, " \t<>,") {
+		return "", "", fmt.Errorf("Maintainer '%s' has a malformed email '%s'", s, email)
+	}
+
+	name = strings.TrimSpace(s[:start])
+	if strings.HasPrefix(name, `"`) {
+		if len(name) < 2 || !strings.HasSuffix(name, `"`) {
+			return "", "", fmt.Errorf("Maintainer '%s' has an unterminated quoted name", s)
+		}
+		name = strings.Replace(name[1:len(name)-1], `\"`, `"`, -1)
+	} else if strings.ContainsAny(name, `"<>`) {
+		return "", "", fmt.Errorf("Maintainer '%s' has a malformed name", s)
+	}
+	if name == "" {
+		return "", "", fmt.Errorf("Maintainer '%s' has no name", s)
+	}
+
+	return name, email, nil
+}
+
+// Parse each of the given addresses with ParseMaintainer.
+func parseMaintainers(addresses []string) ([]Maintainer, error) {
+	ret := []Maintainer{}
+	for _, address := range addresses {
+		name, email, err := ParseMaintainer(address)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Maintainer{Name: name, Email: email})
+	}
+	return ret, nil
+}
+
+// Return the address in `Name <email>` form, quoting the Name if it has a
+// comma in it.
+func (m Maintainer) String() string {
+	name := m.Name
+	if strings.ContainsAny(name, `,"`) {
+		name = `"` + strings.Replace(name, `"`, `\"`, -1) + `"`
+	}
+	return fmt.Sprintf("%s <%s>", name, m.Email)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,87 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+func TestParseMaintainer(t *testing.T) {
+	name, email, err := control.ParseMaintainer("Paul Tagliamonte <paultag@debian.org>")
+	isok(t, err)
+	assert(t, name == "Paul Tagliamonte")
+	assert(t, email == "paultag@debian.org")
+
+	name, email, err = control.ParseMaintainer(` "Smith, John" <john@example.org> `)
+	isok(t, err)
+	assert(t, name == "Smith, John")
+	assert(t, email == "john@example.org")
+
+	for _, bad := range []string{
+		"paultag@debian.org",
+		"Paul Tagliamonte paultag@debian.org",
+		"Paul Tagliamonte <paultag>",
+		"Paul Tagliamonte <paul tag@debian.org>",
+		"<paultag@debian.org>",
+		`"Smith, John <john@example.org>`,
+		"",
+	} {
+		_, _, err := control.ParseMaintainer(bad)
+		notok(t, err)
+	}
+}
+
+func TestMaintainerString(t *testing.T) {
+	m := control.Maintainer{Name: "Paul Tagliamonte", Email: "paultag@debian.org"}
+	assert(t, m.String() == "Paul Tagliamonte <paultag@debian.org>")
+
+	m = control.Maintainer{Name: "Smith, John", Email: "john@example.org"}
+	assert(t, m.String() == `"Smith, John" <john@example.org>`)
+
+	name, email, err := control.ParseMaintainer(m.String())
+	isok(t, err)
+	assert(t, name == m.Name)
+	assert(t, email == m.Email)
+}
+
+func TestDSCParsedMaintainers(t *testing.T) {
+	dsc := control.DSC{
+		Maintainer: "Paul Tagliamonte <paultag@debian.org>",
+		Uploaders:  []string{"Tianon Gravi <tianon@debian.org>"},
+	}
+	maintainers, err := dsc.ParsedMaintainers()
+	isok(t, err)
+	assert(t, len(maintainers) == 2)
+	assert(t, maintainers[0].Name == "Paul Tagliamonte")
+	assert(t, maintainers[1].Email == "tianon@debian.org")
+
+	dsc.Uploaders = append(dsc.Uploaders, "tianon@debian.org")
+	_, err = dsc.ParsedMaintainers()
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
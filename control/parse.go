@@ -23,29 +23,89 @@ package control
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 // A Paragraph is a block of RFC2822-like key value pairs. This struct contains
 // two methods to fetch values, a Map called Values, and a Slice called
 // Order, which maintains the ordering as defined in the RFC2822-like block
+//
+// If the ParagraphReader was asked to PreserveComments, any comment lines
+// found in the block are kept in Comments, and written back out by WriteTo.
 type Paragraph struct {
-	Values map[string]string
-	Order  []string
+	Values   map[string]string
+	Order    []string
+	Comments []Comment
+
+	/* Where the Paragraph was read from, for UnmarshalError: the index of
+	 * the Paragraph in the stream, and the line each field started on. */
+	index int
+	lines map[string]int
+}
+
+// A Comment is a single `#` comment line from a Paragraph.
+type Comment struct {
+	// The comment line itself, including the leading `#`, but without
+	// the trailing newline.
+	Text string
+
+	// The line offset of the comment from the start of the Paragraph.
+	Line int
+
+	// The name of the field the comment was found right before, which is
+	// where it will be written back out. If the comment was at the end of
+	// the Paragraph, this is empty. Comments found in between the
+	// continuation lines of a field are written out before the next field.
+	Field string
 }
 
 // Paragraph Helpers {{{
 
-func (p *Paragraph) Set(key, value string) {
+// Find the key as it's stored in the Paragraph. Field names are case
+// insensitive, so this will match "build-depends" when asked for
+// "Build-Depends".
+func (p *Paragraph) lookup(key string) (string, bool) {
 	if _, found := p.Values[key]; found {
+		return key, true
+	}
+	for _, el := range p.Order {
+		if strings.EqualFold(el, key) {
+			return el, true
+		}
+	}
+	return "", false
+}
+
+// Get the value of the given field, comparing field names without regard
+// to case, as Debian policy requires.
+func (p *Paragraph) Get(key string) (string, bool) {
+	if found, ok := p.lookup(key); ok {
+		return p.Values[found], true
+	}
+	return "", false
+}
+
+// Set the value of the given field. If the field is already present
+// (compared without regard to case) its value is replaced, and the
+// field takes on the casing of `key`.
+func (p *Paragraph) Set(key, value string) {
+	if p.Values == nil {
+		p.Values = map[string]string{}
+	}
+	if found, ok := p.lookup(key); ok {
 		/* We've got the key */
+		p.rename(found, key)
 		p.Values[key] = value
 		return
 	}
@@ -55,42 +115,115 @@ func (p *Paragraph) Set(key, value string) {
 	p.Values[key] = value
 }
 
+// Return the line the Paragraph started on in the input it was read from,
+// or 0 if it wasn't read by a ParagraphReader.
+func (p *Paragraph) firstLine() int {
+	ret := 0
+	for _, line := range p.lines {
+		if ret == 0 || line < ret {
+			ret = line
+		}
+	}
+	return ret
+}
+
+// Change the casing of a field name, keeping its place in the Order.
+func (p *Paragraph) rename(from, to string) {
+	if from == to {
+		return
+	}
+	for i, el := range p.Order {
+		if el == from {
+			p.Order[i] = to
+		}
+	}
+	p.Values[to] = p.Values[from]
+	delete(p.Values, from)
+}
+
 func (p *Paragraph) WriteTo(out io.Writer) error {
+	writeComments := func(key string) error {
+		for _, comment := range p.Comments {
+			if !strings.EqualFold(comment.Field, key) {
+				continue
+			}
+			if _, err := out.Write([]byte(comment.Text + "\n")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	for _, key := range p.Order {
-		value := p.Values[key]
+		if err := writeComments(key); err != nil {
+			return err
+		}
+
+		value := strings.TrimRight(p.Values[key], "\n")
 
 		value = strings.Replace(value, "\n", "\n ", -1)
 		value = strings.Replace(value, "\n \n", "\n .\n", -1)
 
+		/* Values that start on the line after the key (such as the
+		 * Checksums fields) don't get a trailing space after the ':' */
+		format := "%s: %s\n"
+		if strings.HasPrefix(value, "\n") || value == "" {
+			format = "%s:%s\n"
+		}
+
 		if _, err := out.Write(
-			[]byte(fmt.Sprintf("%s: %s\n", key, value)),
+			[]byte(fmt.Sprintf(format, key, value)),
 		); err != nil {
 			return err
 		}
 	}
-	return nil
+	return writeComments("")
 }
 
-func (p *Paragraph) Update(other Paragraph) Paragraph {
+// Return a copy of the Paragraph with the keys named in `order` moved to
+// the front, in that order, and with the casing used in `order`. Any keys
+// not in `order` follow, in the order they were in to begin with.
+func (p *Paragraph) orderedBy(order []string) Paragraph {
 	ret := Paragraph{
-		Order:  []string{},
-		Values: map[string]string{},
+		Order:    []string{},
+		Values:   map[string]string{},
+		Comments: p.Comments,
 	}
 
 	seen := map[string]bool{}
 
+	for _, el := range order {
+		if found, ok := p.lookup(el); ok {
+			ret.Order = append(ret.Order, el)
+			ret.Values[el] = p.Values[found]
+			seen[found] = true
+		}
+	}
+
+	for _, el := range p.Order {
+		if !seen[el] {
+			ret.Order = append(ret.Order, el)
+			ret.Values[el] = p.Values[el]
+		}
+	}
+
+	return ret
+}
+
+func (p *Paragraph) Update(other Paragraph) Paragraph {
+	ret := Paragraph{
+		Order:    []string{},
+		Values:   map[string]string{},
+		Comments: append(append([]Comment{}, p.Comments...), other.Comments...),
+	}
+
 	for _, el := range p.Order {
 		ret.Order = append(ret.Order, el)
 		ret.Values[el] = p.Values[el]
-		seen[el] = true
 	}
 
 	for _, el := range other.Order {
-		if _, ok := seen[el]; !ok {
-			ret.Order = append(ret.Order, el)
-			seen[el] = true
-		}
-		ret.Values[el] = other.Values[el]
+		ret.Set(el, other.Values[el])
 	}
 
 	return ret
@@ -107,8 +240,22 @@ func (p *Paragraph) Update(other Paragraph) Paragraph {
 // unread Paragraph can be returned by calling the `.Next` method on this
 // struct.
 type ParagraphReader struct {
-	reader *bufio.Reader
-	signer *openpgp.Entity
+	reader    *bufio.Reader
+	signer    *openpgp.Entity
+	signed    []byte
+	signature *signatureInfo
+
+	preserveComments bool
+	rejectDuplicates bool
+	transcodeLatin1  bool
+
+	/* Limits on the input, or 0 for none */
+	maxFieldBytes int
+	maxParagraphs int
+
+	/* The number of lines and Paragraphs read so far */
+	line  int
+	index int
 }
 
 // {{{ NewParagraphReader
@@ -120,12 +267,27 @@ type ParagraphReader struct {
 // Also keep in mind, `reader` may be consumed 100% in memory due to
 // the underlying OpenPGP API being hella fiddly.
 func NewParagraphReader(reader io.Reader, keyring *openpgp.EntityList) (*ParagraphReader, error) {
+	/* Careful to not hand a typed nil over as a non-nil KeyRing */
+	if keyring == nil {
+		return newParagraphReader(reader, nil)
+	}
+	return newParagraphReader(reader, keyring)
+}
+
+func newParagraphReader(reader io.Reader, keyring openpgp.KeyRing) (*ParagraphReader, error) {
 	bufioReader := bufio.NewReader(reader)
 	ret := ParagraphReader{
 		reader: bufioReader,
 		signer: nil,
 	}
 
+	/* A UTF-8 byte order mark is never part of a control file, but some
+	 * editors like to put one at the start anyway. Drop it, so that it
+	 * doesn't end up as part of the first key. */
+	if bom, _ := bufioReader.Peek(len(utf8BOM)); string(bom) == utf8BOM {
+		bufioReader.Discard(len(utf8BOM))
+	}
+
 	// OK. We have a document. Now, let's peek ahead and see if we've got an
 	// OpenPGP Clearsigned set of Paragraphs. If we do, we're going to go ahead
 	// and do the decode dance.
@@ -151,6 +313,76 @@ func (p *ParagraphReader) Signer() *openpgp.Entity {
 
 // }}}
 
+// SignedData {{{
+
+// Return the exact bytes the OpenPGP clearsignature covered (after the
+// dash-escaping has been undone, with canonical line endings), or nil if
+// the Paragraphs weren't checked against a keyring.
+func (p *ParagraphReader) SignedData() []byte {
+	return p.signed
+}
+
+// }}}
+
+// PreserveComments {{{
+
+// Keep any `#` comment lines in the Comments member of each Paragraph read
+// from here on, rather than dropping them.
+func (p *ParagraphReader) PreserveComments() {
+	p.preserveComments = true
+}
+
+// }}}
+
+// RejectDuplicates {{{
+
+// Return an error from Next when a field is repeated within a Paragraph
+// (comparing field names without regard to case), as Debian policy doesn't
+// allow that. By default, a repeated field replaces the earlier value,
+// keeping its place in the Order.
+func (p *ParagraphReader) RejectDuplicates() {
+	p.rejectDuplicates = true
+}
+
+// }}}
+
+// TranscodeLatin1 {{{
+
+// Treat any line that isn't valid UTF-8 as ISO-8859-1 (Latin-1), and
+// convert it to UTF-8, as found in some legacy files (often in the
+// Maintainer field). By default, lines are passed through as-is.
+func (p *ParagraphReader) TranscodeLatin1() {
+	p.transcodeLatin1 = true
+}
+
+// }}}
+
+// MaxFieldBytes {{{
+
+// Return an error from Next when a field (as written, counting the field
+// name and all of its continuation lines) is longer than the given number
+// of bytes, rather than reading it into memory, no matter how long it is.
+// This is meant for reading untrusted input. A limit of 0 (the default)
+// means there is none.
+//
+// Note that clearsigned input is read all at once to check the signature,
+// so the limit only applies once that's been done.
+func (p *ParagraphReader) MaxFieldBytes(n int) {
+	p.maxFieldBytes = n
+}
+
+// }}}
+
+// MaxParagraphs {{{
+
+// Return an error from Next rather than reading any more than the given
+// number of Paragraphs. A limit of 0 (the default) means there is none.
+func (p *ParagraphReader) MaxParagraphs(n int) {
+	p.maxParagraphs = n
+}
+
+// }}}
+
 // All {{{
 
 func (p *ParagraphReader) All() ([]Paragraph, error) {
@@ -176,11 +408,27 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 	paragraph := Paragraph{
 		Order:  []string{},
 		Values: map[string]string{},
+		index:  p.index,
+		lines:  map[string]int{},
 	}
 	var lastKey string
+	lineNumber := -1
+	pending := []Comment{}
+	fieldBytes := 0
 
 	for {
-		line, err := p.reader.ReadString('\n')
+		line, err := p.readLine()
+		lineNumber++
+		if line != "" {
+			p.line++
+		}
+		if err == errLineTooLong {
+			p.line++
+			return nil, p.errorf("Field is longer than %d bytes", p.maxFieldBytes)
+		}
+		if p.transcodeLatin1 && !utf8.ValidString(line) {
+			line = latin1ToUTF8(line)
+		}
 		if err == io.EOF && line != "" {
 			err = nil
 			line = line + "\n"
@@ -189,6 +437,8 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		if err == io.EOF {
 			/* Let's return the parsed paragraph if we have it */
 			if len(paragraph.Order) > 0 {
+				paragraph.Comments = append(paragraph.Comments, pending...)
+				p.index++
 				return &paragraph, nil
 			}
 			/* Else, let's go ahead and drop the EOF out raw */
@@ -197,13 +447,33 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 			return nil, err
 		}
 
+		if len(paragraph.Order) == 0 && strings.TrimSpace(line) == "" {
+			/* More than one blank line between Paragraphs (or blank
+			 * lines before the first one, or stray whitespace after
+			 * the last one); skip over them rather than returning an
+			 * empty Paragraph. */
+			lineNumber = -1
+			pending = pending[:0]
+			continue
+		}
+
 		if line == "\n" || line == "\r\n" {
 			/* Lines are ended by a blank line; so we're able to go ahead
 			 * and return this guy as-is. All set. Done. Finished. */
+			paragraph.Comments = append(paragraph.Comments, pending...)
+			p.index++
 			return &paragraph, nil
 		}
 
 		if strings.HasPrefix(line, "#") {
+			if p.preserveComments {
+				/* We don't know which field this comes before until
+				 * we get to the next key line. */
+				pending = append(pending, Comment{
+					Text: strings.TrimRight(line, "\r\n"),
+					Line: lineNumber,
+				})
+			}
 			continue // skip comments
 		}
 
@@ -217,6 +487,11 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		 */
 
 		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			fieldBytes += len(line)
+			if p.maxFieldBytes > 0 && fieldBytes > p.maxFieldBytes {
+				return nil, p.errorf("Field '%s' is longer than %d bytes", lastKey, p.maxFieldBytes)
+			}
+
 			/* This is a continuation line; so we're going to go ahead and
 			 * clean it up, and throw it into the list. We're going to remove
 			 * the first character (which we now know is whitespace), and if
@@ -248,20 +523,175 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 		 * this on the first key, and set that guy */
 		els := strings.SplitN(line, ":", 2)
 		if len(els) != 2 {
-			return nil, fmt.Errorf("Bad line: '%s' has no ':'", line)
+			return nil, p.errorf("Bad line: '%s' has no ':'", strings.TrimRight(line, "\r\n"))
 		}
+		if len(paragraph.Order) == 0 && p.maxParagraphs > 0 && p.index >= p.maxParagraphs {
+			return nil, p.errorf("More than %d Paragraphs", p.maxParagraphs)
+		}
+		fieldBytes = len(line)
 
 		/* We'll go ahead and take off any leading spaces */
 		lastKey = strings.TrimSpace(els[0])
 		value := strings.TrimSpace(els[1])
 
-		paragraph.Order = append(paragraph.Order, lastKey)
-		paragraph.Values[lastKey] = value
+		if _, found := paragraph.lookup(lastKey); found {
+			if p.rejectDuplicates {
+				return nil, p.errorf("Duplicate field '%s' in paragraph", lastKey)
+			}
+			paragraph.Set(lastKey, value)
+		} else {
+			paragraph.Order = append(paragraph.Order, lastKey)
+			paragraph.Values[lastKey] = value
+		}
+		paragraph.lines[lastKey] = p.line
+
+		for _, comment := range pending {
+			comment.Field = lastKey
+			paragraph.Comments = append(paragraph.Comments, comment)
+		}
+		pending = pending[:0]
+	}
+}
+
+const utf8BOM = "\xef\xbb\xbf"
+
+var errLineTooLong = errors.New("Line too long")
+
+// Read the next line, up to and including the '\n', just like ReadString,
+// but without reading more than the MaxFieldBytes, if there is a limit,
+// returning errLineTooLong once a line goes over it.
+func (p *ParagraphReader) readLine() (string, error) {
+	if p.maxFieldBytes <= 0 {
+		return p.reader.ReadString('\n')
+	}
+	line := []byte{}
+	for {
+		chunk, err := p.reader.ReadSlice('\n')
+		if len(line)+len(chunk) > p.maxFieldBytes {
+			return "", errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// Convert a string of ISO-8859-1 bytes into UTF-8. Each byte in Latin-1
+// maps onto the Unicode code point of the same value.
+func latin1ToUTF8(line string) string {
+	ret := make([]rune, len(line))
+	for i := 0; i < len(line); i++ {
+		ret[i] = rune(line[i])
+	}
+	return string(ret)
+}
+
+// Return an UnmarshalError for the line that was just read.
+func (p *ParagraphReader) errorf(format string, args ...interface{}) error {
+	return &UnmarshalError{
+		Paragraph: p.index,
+		Line:      p.line,
+		Err:       fmt.Errorf(format, args...),
 	}
 }
 
 // }}}
 
+// UnmarshalError {{{
+
+// An UnmarshalError describes where in the input a Paragraph couldn't be
+// read or decoded. Paragraph is the index of the Paragraph in the stream,
+// starting at 0, and Line is the line of the input (starting at 1) that the
+// problem was found on, or 0 if that's not known. Field is the name of the
+// field that couldn't be decoded, if the problem was with a single field.
+type UnmarshalError struct {
+	Field     string
+	Paragraph int
+	Line      int
+	Err       error
+}
+
+func (e *UnmarshalError) Error() string {
+	where := fmt.Sprintf("Paragraph %d", e.Paragraph)
+	if e.Line > 0 {
+		where += fmt.Sprintf(", line %d", e.Line)
+	}
+	if e.Field != "" {
+		where += fmt.Sprintf(", field '%s'", e.Field)
+	}
+	return where + ": " + e.Err.Error()
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// }}}
+
+// SplitParagraphs {{{
+
+// ScanParagraphs is a bufio.SplitFunc that splits a stream of Paragraphs
+// on the blank lines between them, without otherwise parsing them. Each
+// token is the raw text of one Paragraph, including the newline at the end
+// of its last line. Continuation lines (which start with whitespace) never
+// end a Paragraph, and runs of blank lines are skipped over, just as
+// ParagraphReader does.
+//
+// OpenPGP clearsigned input is not unwrapped; ScanParagraphs is meant for
+// unsigned streams such as Packages or Sources indexes.
+func ScanParagraphs(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for {
+		if bytes.HasPrefix(data[start:], []byte("\n")) {
+			start++
+		} else if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+			start += 2
+		} else {
+			break
+		}
+	}
+
+	for i := start; i < len(data); i++ {
+		if data[i] != '\n' {
+			continue
+		}
+		rest := data[i+1:]
+		if bytes.HasPrefix(rest, []byte("\n")) {
+			return i + 2, data[start : i+1], nil
+		}
+		if bytes.HasPrefix(rest, []byte("\r\n")) {
+			return i + 3, data[start : i+1], nil
+		}
+	}
+
+	if !atEOF {
+		/* Ask for more, dropping any blank lines we've skipped over */
+		return start, nil, nil
+	}
+	if start == len(data) {
+		return start, nil, nil
+	}
+	return len(data), data[start:], nil
+}
+
+// Read the whole io.Reader, and split it into the raw text of each
+// Paragraph, as ScanParagraphs does. The stanzas may then be handed out
+// to other goroutines to Unmarshal.
+func SplitParagraphs(reader io.Reader) ([][]byte, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, 1<<30)
+	scanner.Split(ScanParagraphs)
+
+	ret := [][]byte{}
+	for scanner.Scan() {
+		ret = append(ret, append([]byte{}, scanner.Bytes()...))
+	}
+	return ret, scanner.Err()
+}
+
+// }}}
+
 // decodeClearsig {{{
 
 // Internal method to read an OpenPGP Clearsigned document, store related
@@ -269,7 +699,7 @@ func (p *ParagraphReader) Next() (*Paragraph, error) {
 // we encounter along the way, such as an invalid signature, unknown
 // signer, or incomplete document. If `keyring` is `nil`, checking of the
 // signed data is *not* preformed.
-func (p *ParagraphReader) decodeClearsig(keyring *openpgp.EntityList) error {
+func (p *ParagraphReader) decodeClearsig(keyring openpgp.KeyRing) error {
 	// One *massive* downside here is that the OpenPGP module in Go operates
 	// on byte arrays in memory, and *not* on Readers and Writers. This is a
 	// huge PITA because it doesn't need to be that way, and this forces
@@ -282,6 +712,9 @@ func (p *ParagraphReader) decodeClearsig(keyring *openpgp.EntityList) error {
 	}
 
 	block, _ := clearsign.Decode(signedData)
+	if block == nil {
+		return fmt.Errorf("Malformed OpenPGP clearsigned document")
+	}
 	/* We're only interested in the first block. This may change in the
 	 * future, in which case, we should likely set reader back to
 	 * the remainder, and return that out to put through another
@@ -296,11 +729,13 @@ func (p *ParagraphReader) decodeClearsig(keyring *openpgp.EntityList) error {
 	}
 
 	/* Now, we have to go ahead and check that the signature is valid and
-	 * relates to an entity we have in our keyring */
+	 * relates to an entity we have in our keyring. Keep a copy of the
+	 * signature packets, to find out which key it was made with. */
+	signature := bytes.Buffer{}
 	signer, err := openpgp.CheckDetachedSignature(
 		keyring,
 		bytes.NewReader(block.Bytes),
-		block.ArmoredSignature.Body,
+		io.TeeReader(block.ArmoredSignature.Body, &signature),
 	)
 
 	if err != nil {
@@ -308,11 +743,69 @@ func (p *ParagraphReader) decodeClearsig(keyring *openpgp.EntityList) error {
 	}
 
 	p.signer = signer
+	p.signature = findSignature(keyring, signature.Bytes())
+	p.signed = block.Bytes
 	p.reader = bufio.NewReader(bytes.NewBuffer(block.Bytes))
 
 	return nil
 }
 
+// signatureInfo is what's known about the signature that was checked, which
+// CheckDetachedSignature doesn't hand back.
+type signatureInfo struct {
+	/* The key the signature was made with, which may be a subkey */
+	keyID uint64
+	key   openpgp.Key
+
+	/* When the signature itself expires, or the zero Time if it doesn't */
+	expires time.Time
+}
+
+// Find the first signature in the given packets that was made by a key in
+// the keyring that can sign, which is the one CheckDetachedSignature checks.
+func findSignature(keyring openpgp.KeyRing, signatures []byte) *signatureInfo {
+	packets := packet.NewReader(bytes.NewReader(signatures))
+	for {
+		next, err := packets.Next()
+		if err != nil {
+			return nil
+		}
+
+		ret := signatureInfo{}
+		switch sig := next.(type) {
+		case *packet.Signature:
+			if sig.IssuerKeyId == nil {
+				return nil
+			}
+			ret.keyID = *sig.IssuerKeyId
+			if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+				ret.expires = sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+			}
+		case *packet.SignatureV3:
+			ret.keyID = sig.IssuerKeyId
+		default:
+			return nil
+		}
+
+		if keys := keyring.KeysByIdUsage(ret.keyID, packet.KeyFlagSign); len(keys) > 0 {
+			ret.key = keys[0]
+			return &ret
+		}
+	}
+}
+
+// Check that neither the signature nor the key it was made with had
+// expired as of the given time.
+func (s *signatureInfo) checkExpiry(now time.Time) error {
+	if !s.expires.IsZero() && now.After(s.expires) {
+		return fmt.Errorf("OpenPGP signature by key %016X expired on %s", s.keyID, s.expires)
+	}
+	if s.key.SelfSignature != nil && s.key.SelfSignature.KeyExpired(now) {
+		return fmt.Errorf("OpenPGP key %016X has expired", s.keyID)
+	}
+	return nil
+}
+
 // }}}
 
 // }}}
@@ -21,10 +21,12 @@
 package control_test
 
 import (
+	"bytes"
 	"io"
 	"log"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/cinello/go-debian/control"
 
@@ -297,4 +299,73 @@ func TestLineWrapping(t *testing.T) {
 `)
 }
 
+func TestCaseInsensitiveParagraph(t *testing.T) {
+	reader, err := control.NewParagraphReader(strings.NewReader(`source: fbautostart
+build-depends: debhelper (>= 9)
+VERSION: 1.0-1
+`), nil)
+	isok(t, err)
+
+	el, err := reader.Next()
+	isok(t, err)
+
+	value, ok := el.Get("Build-Depends")
+	assert(t, ok)
+	assert(t, value == "debhelper (>= 9)")
+	value, ok = el.Get("version")
+	assert(t, ok && value == "1.0-1")
+	_, ok = el.Get("Maintainer")
+	assert(t, !ok)
+
+	el.Set("Source", "hello")
+	assert(t, len(el.Order) == 3)
+	assert(t, el.Order[0] == "Source")
+	assert(t, el.Values["Source"] == "hello")
+}
+
+func TestTranscodeLatin1(t *testing.T) {
+	const data = "Source: foo\nMaintainer: J\xf6rg M\xfcller <jm@example.com>\n"
+
+	reader, err := control.NewParagraphReader(strings.NewReader(data), nil)
+	isok(t, err)
+	el, err := reader.Next()
+	isok(t, err)
+	assert(t, el.Values["Maintainer"] == "J\xf6rg M\xfcller <jm@example.com>")
+
+	reader, err = control.NewParagraphReader(strings.NewReader(data), nil)
+	isok(t, err)
+	reader.TranscodeLatin1()
+	el, err = reader.Next()
+	isok(t, err)
+	assert(t, el.Values["Source"] == "foo")
+	assert(t, el.Values["Maintainer"] == "Jörg Müller <jm@example.com>")
+}
+
+func TestSplitParagraphs(t *testing.T) {
+	input := "\n\nPackage: foo\nDescription: foo\n bar\n .\n baz\n\n\r\n\nPackage: bar\r\n\r\nPackage: baz"
+	stanzas, err := control.SplitParagraphs(strings.NewReader(input))
+	isok(t, err)
+	assert(t, len(stanzas) == 3)
+	assert(t, string(stanzas[0]) == "Package: foo\nDescription: foo\n bar\n .\n baz\n")
+	assert(t, string(stanzas[1]) == "Package: bar\r\n")
+	assert(t, string(stanzas[2]) == "Package: baz")
+
+	for _, stanza := range stanzas {
+		reader, err := control.NewParagraphReader(bytes.NewReader(stanza), nil)
+		isok(t, err)
+		paras, err := reader.All()
+		isok(t, err)
+		assert(t, len(paras) == 1)
+	}
+
+	stanzas, err = control.SplitParagraphs(iotest.OneByteReader(strings.NewReader(input)))
+	isok(t, err)
+	assert(t, len(stanzas) == 3)
+	assert(t, string(stanzas[1]) == "Package: bar\r\n")
+
+	stanzas, err = control.SplitParagraphs(strings.NewReader("\n\n"))
+	isok(t, err)
+	assert(t, len(stanzas) == 0)
+}
+
 // vim: foldmethod=marker
@@ -0,0 +1,158 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priority {{{
+
+// A Priority is the value of a Priority field, saying how important it is
+// that the package is installed. Debian policy only allows the values of
+// the constants below.
+type Priority string
+
+const (
+	PriorityRequired  Priority = "required"
+	PriorityImportant Priority = "important"
+	PriorityStandard  Priority = "standard"
+	PriorityOptional  Priority = "optional"
+
+	// PriorityExtra is deprecated, and should be replaced by
+	// PriorityOptional, which means the same thing; see Normalize.
+	PriorityExtra Priority = "extra"
+)
+
+var knownPriorities = map[Priority]bool{
+	PriorityRequired:  true,
+	PriorityImportant: true,
+	PriorityStandard:  true,
+	PriorityOptional:  true,
+	PriorityExtra:     true,
+}
+
+// Parse a Priority, returning an error if it isn't one policy knows about.
+// Unmarshal doesn't check the Priority, so that unusual archives can still
+// be read; use this (or Known) to be strict about it.
+func ParsePriority(priority string) (Priority, error) {
+	ret := Priority(strings.TrimSpace(priority))
+	if !ret.Known() {
+		return ret, fmt.Errorf("Unknown priority '%s'", priority)
+	}
+	return ret, nil
+}
+
+// Check to see if this is one of the Priorities policy knows about,
+// including the deprecated `extra`.
+func (p Priority) Known() bool {
+	return knownPriorities[p]
+}
+
+// Check to see if this is the deprecated `extra` Priority.
+func (p Priority) Deprecated() bool {
+	return p == PriorityExtra
+}
+
+// Return the Priority that should be used in place of this one, which is
+// `optional` for the deprecated `extra`, and the Priority itself otherwise.
+func (p Priority) Normalize() Priority {
+	if p.Deprecated() {
+		return PriorityOptional
+	}
+	return p
+}
+
+// }}}
+
+// Section {{{
+
+// A Section is the value of a Section field, which is the area of the
+// archive the package belongs to, such as `net`. Packages outside of the
+// main component have the component in front, as in `contrib/net`.
+type Section string
+
+var knownComponents = map[string]bool{
+	"main":              true,
+	"contrib":           true,
+	"non-free":          true,
+	"non-free-firmware": true,
+}
+
+// The sections listed by Debian policy, along with debian-installer, which
+// the archive uses for udebs.
+var knownSections = map[string]bool{}
+
+func init() {
+	for _, section := range strings.Fields(`
+		admin cli-mono comm database debian-installer debug devel doc
+		editors education electronics embedded fonts games gnome gnu-r
+		gnustep golang graphics hamradio haskell httpd interpreters
+		introspection java javascript kde kernel libdevel libs lisp
+		localization mail math metapackages misc net news ocaml oldlibs
+		otherosfs perl php python ruby rust science shells sound tasks tex
+		text utils vcs video web x11 xfce zope`) {
+		knownSections[section] = true
+	}
+}
+
+// Parse a Section, returning an error if the section (or the component in
+// front of it) isn't one policy knows about. As with ParsePriority,
+// Unmarshal doesn't check the Section.
+func ParseSection(section string) (Section, error) {
+	ret := Section(strings.TrimSpace(section))
+	if !knownComponents[ret.Component()] {
+		return ret, fmt.Errorf("Unknown component '%s' in section '%s'", ret.Component(), section)
+	}
+	if !knownSections[ret.Name()] {
+		return ret, fmt.Errorf("Unknown section '%s'", section)
+	}
+	return ret, nil
+}
+
+// Check to see if both the component and the section are ones policy
+// knows about.
+func (s Section) Known() bool {
+	_, err := ParseSection(string(s))
+	return err == nil
+}
+
+// Return the component the Section is in, which is `main` unless another
+// one is given in front of the section.
+func (s Section) Component() string {
+	if i := strings.LastIndex(string(s), "/"); i >= 0 {
+		return string(s)[:i]
+	}
+	return "main"
+}
+
+// Return the Section without the component in front of it.
+func (s Section) Name() string {
+	if i := strings.LastIndex(string(s), "/"); i >= 0 {
+		return string(s)[i+1:]
+	}
+	return string(s)
+}
+
+// }}}
+
+// vim: foldmethod=marker
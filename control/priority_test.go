@@ -0,0 +1,81 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+func TestPriority(t *testing.T) {
+	for _, priority := range []string{"required", "important", "standard", "optional", "extra"} {
+		parsed, err := control.ParsePriority(priority)
+		isok(t, err)
+		assert(t, parsed.Known())
+	}
+
+	_, err := control.ParsePriority("critical")
+	notok(t, err)
+
+	assert(t, control.PriorityExtra.Deprecated())
+	assert(t, control.PriorityExtra.Normalize() == control.PriorityOptional)
+	assert(t, !control.PriorityStandard.Deprecated())
+	assert(t, control.PriorityStandard.Normalize() == control.PriorityStandard)
+}
+
+func TestSection(t *testing.T) {
+	section, err := control.ParseSection("net")
+	isok(t, err)
+	assert(t, section.Component() == "main")
+	assert(t, section.Name() == "net")
+
+	section, err = control.ParseSection("non-free/libs")
+	isok(t, err)
+	assert(t, section.Component() == "non-free")
+	assert(t, section.Name() == "libs")
+
+	_, err = control.ParseSection("networking")
+	notok(t, err)
+	_, err = control.ParseSection("universe/net")
+	notok(t, err)
+	assert(t, !control.Section("contrib/networking").Known())
+	assert(t, control.Section("contrib/debian-installer").Known())
+}
+
+func TestBinaryIndexPriority(t *testing.T) {
+	index, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(`Package: fbautostart
+Section: contrib/x11
+Priority: extra
+`)))
+	isok(t, err)
+	assert(t, len(index) == 1)
+	assert(t, index[0].Section.Component() == "contrib")
+	assert(t, index[0].Priority.Normalize() == control.PriorityOptional)
+}
+
+// vim: foldmethod=marker
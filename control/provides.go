@@ -0,0 +1,120 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"github.com/cinello/go-debian/dependency"
+	"github.com/cinello/go-debian/version"
+)
+
+// A Provider is a binary package that can satisfy a relation on some name,
+// either because that's the name of the package, or because the package
+// Provides it.
+type Provider struct {
+	Package string
+
+	// The version the name is provided at. For the package itself this is
+	// the version of the package, for a versioned Provides such as
+	// `foo (= 1.2)` it's 1.2, and for an unversioned Provides it's nil,
+	// which only satisfies relations without a version restriction.
+	Version *version.Version
+}
+
+// A ProvidesIndex maps the name of each real or virtual package to the
+// Providers for that name.
+type ProvidesIndex map[string][]Provider
+
+// Build a ProvidesIndex out of the given binary packages, such as those
+// parsed out of an APT Packages file, taking each package's Provides field
+// into account.
+func BuildProvidesIndex(packages []BinaryIndex) ProvidesIndex {
+	ret := ProvidesIndex{}
+	for _, pkg := range packages {
+		ver := pkg.Version
+		ret[pkg.Package] = append(ret[pkg.Package], Provider{
+			Package: pkg.Package,
+			Version: &ver,
+		})
+
+		for _, possi := range pkg.Provides.GetAllPossibilities() {
+			provider := Provider{Package: pkg.Package}
+			if possi.Version != nil && possi.Version.Operator == "=" {
+				if ver, err := version.Parse(possi.Version.Number); err == nil {
+					provider.Version = &ver
+				}
+			}
+			ret[possi.Name] = append(ret[possi.Name], provider)
+		}
+	}
+	return ret
+}
+
+// Return the Providers that satisfy the given Possibility, honoring its
+// version restriction, if it has one.
+func (index ProvidesIndex) Providers(possi dependency.Possibility) []Provider {
+	ret := []Provider{}
+	for _, provider := range index[possi.Name] {
+		if possi.Version == nil {
+			ret = append(ret, provider)
+			continue
+		}
+		if provider.Version != nil && possi.Version.SatisfiedBy(*provider.Version) {
+			ret = append(ret, provider)
+		}
+	}
+	return ret
+}
+
+// Check to see if every Relation of the Dependency that applies to the
+// given Arch can be satisfied by one of the packages in the index, either
+// directly or through a Provides. The Relations that can't be satisfied
+// are returned as well.
+func (index ProvidesIndex) Satisfies(dep dependency.Dependency, arch dependency.Arch) (bool, []dependency.Relation) {
+	var unsatisfied []dependency.Relation
+
+	for _, relation := range dep.Relations {
+		applicable := false
+		satisfied := false
+
+		for _, possi := range relation.Possibilities {
+			if possi.Substvar {
+				continue
+			}
+			if possi.Architectures != nil && !possi.Architectures.Matches(&arch) {
+				continue
+			}
+			applicable = true
+
+			if len(index.Providers(possi)) != 0 {
+				satisfied = true
+				break
+			}
+		}
+
+		if applicable && !satisfied {
+			unsatisfied = append(unsatisfied, relation)
+		}
+	}
+
+	return len(unsatisfied) == 0, unsatisfied
+}
+
+// vim: foldmethod=marker
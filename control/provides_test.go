@@ -0,0 +1,82 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+	"github.com/cinello/go-debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestProvidesIndex(t *testing.T) {
+	// Test Packages {{{
+	packages, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(`Package: postfix
+Version: 3.5.6-1
+Provides: mail-transport-agent, default-mta
+
+Package: bar
+Version: 2.0-1
+Provides: foo (= 1.2), libfoo
+
+Package: foo
+Version: 0.9-1
+`)))
+	// }}}
+	isok(t, err)
+
+	index := control.BuildProvidesIndex(packages)
+	assert(t, len(index["foo"]) == 2)
+	assert(t, index["mail-transport-agent"][0].Package == "postfix")
+	assert(t, index["mail-transport-agent"][0].Version == nil)
+
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	for in, ok := range map[string]bool{
+		"mail-transport-agent":           true,
+		"foo (>= 1)":                     true,
+		"foo (>= 1.5) | bar":             true,
+		"foo (>= 1.5)":                   false,
+		"libfoo":                         true,
+		"libfoo (>= 1)":                  false,
+		"postfix (>= 3)":                 true,
+		"exim4 [amd64] | postfix (<< 3)": false,
+		"exim4 [sparc]":                  true,
+		"${misc:Depends}, default-mta":   true,
+	} {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		satisfied, unsatisfied := index.Satisfies(*dep, *arch)
+		if satisfied != ok {
+			t.Errorf("Satisfies(%q) = %v, want %v", in, satisfied, ok)
+		}
+		assert(t, satisfied == (len(unsatisfied) == 0))
+	}
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,173 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cinello/go-debian/dependency"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// {{{ Release dates
+
+// The layouts used in the Date and Valid-Until fields of Release files. The
+// first one is what the archive software writes, the others are accepted
+// as well, since apt does.
+var releaseDateLayouts = []string{
+	"Mon, 02 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+}
+
+// A ReleaseDate is a point in time as written in the Date and Valid-Until
+// fields of a Release file, such as `Sat, 14 Oct 2017 08:52:11 UTC`.
+type ReleaseDate struct {
+	time.Time
+}
+
+func (d *ReleaseDate) UnmarshalControl(data string) error {
+	var err error
+	for _, layout := range releaseDateLayouts {
+		var when time.Time
+		if when, err = time.Parse(layout, data); err == nil {
+			d.Time = when
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown date format in Release file: '%s'", data)
+}
+
+func (d ReleaseDate) MarshalControl() (string, error) {
+	if d.IsZero() {
+		return "", nil
+	}
+	return d.UTC().Format(releaseDateLayouts[0]), nil
+}
+
+// }}}
+
+// The Release struct represents the Release (or InRelease) file at the top
+// of each distribution in an APT repository, such as `dists/unstable/Release`.
+// It lists the Components and Architectures of the distribution, as well as
+// the size and hashes of each of the index files under it.
+type Release struct {
+	Paragraph
+
+	Origin        string
+	Label         string
+	Suite         string
+	Version       string
+	Codename      string
+	Date          ReleaseDate
+	ValidUntil    ReleaseDate       `control:"Valid-Until"`
+	Architectures []dependency.Arch `delim:" "`
+	Components    []string          `delim:" "`
+	Description   string
+	AcquireByHash bool             `control:"Acquire-By-Hash"`
+	MD5Sum        []MD5FileHash    `control:"MD5Sum" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA1          []SHA1FileHash   `control:"SHA1" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA256        []SHA256FileHash `control:"SHA256" delim:"\n" strip:"\n\r\t " multiline:"true"`
+	SHA512        []SHA512FileHash `control:"SHA512" delim:"\n" strip:"\n\r\t " multiline:"true"`
+}
+
+// Given a bufio.Reader, consume the Reader, and return a Release struct.
+// InRelease files may be passed in as-is, although the OpenPGP signature
+// isn't checked.
+func ParseRelease(reader *bufio.Reader) (*Release, error) {
+	ret := &Release{}
+	return ret, Unmarshal(ret, reader)
+}
+
+// Given an InRelease file, check its OpenPGP clearsignature against the
+// given keyring, and return the Release it contains, along with the ID of
+// the key that made the signature (which may be a subkey), so that it can
+// be logged. This is what an APT client does before trusting a mirror.
+//
+// An error is returned if the InRelease isn't signed (ErrNotSigned), if
+// the signature can't be checked against the keyring, if the signature or
+// the key that made it has expired, or if the Release is past its
+// Valid-Until date.
+func OpenInRelease(reader io.Reader, keyring openpgp.KeyRing) (*Release, uint64, error) {
+	ret := &Release{}
+	decoder, err := openSigned(bufio.NewReader(reader), keyring, ret)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	signature := decoder.paragraphReader.signature
+	if signature == nil {
+		return nil, 0, fmt.Errorf("Can't find the key the InRelease was signed with")
+	}
+
+	now := time.Now()
+	if err := signature.checkExpiry(now); err != nil {
+		return nil, 0, err
+	}
+	if ret.Expired(now) {
+		return nil, 0, fmt.Errorf("Release file expired on %s", ret.ValidUntil.Time)
+	}
+	return ret, signature.keyID, nil
+}
+
+// Given a path on the filesystem, Parse the file off the disk and return
+// a pointer to a brand new Release struct, unless error is set to a value
+// other than nil.
+func ParseReleaseFile(path string) (*Release, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseRelease(bufio.NewReader(f))
+}
+
+// Find the SHA256 entry for the index at the given path, relative to the
+// Release file, such as `main/binary-amd64/Packages.xz`. The boolean is
+// false if the Release file doesn't list that path.
+func (r *Release) Find(filename string) (SHA256FileHash, bool) {
+	filename = path.Clean(filename)
+	for _, hash := range r.SHA256 {
+		if path.Clean(hash.Filename) == filename {
+			return hash, true
+		}
+	}
+	return SHA256FileHash{}, false
+}
+
+// Check to see if the Release file has expired as of the given time. A
+// Release file without a Valid-Until field never expires.
+func (r *Release) Expired(now time.Time) bool {
+	if r.ValidUntil.IsZero() {
+		return false
+	}
+	return now.After(r.ValidUntil.Time)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,194 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cinello/go-debian/control"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+/*
+ *
+ */
+
+// {{{ test Release file
+var releaseFile = `Origin: Debian
+Label: Debian
+Suite: unstable
+Codename: sid
+Date: Sat, 14 Oct 2017 08:52:11 UTC
+Valid-Until: Sat, 21 Oct 2017 08:52:11 UTC
+Acquire-By-Hash: yes
+Architectures: amd64 arm64 i386
+Components: main contrib non-free
+Description: Debian x.y Unstable - Not Released
+MD5Sum:
+ 5e3ef4a0d4f6bc41d23f2ea2c27a47d4 38164760 main/binary-amd64/Packages
+ 6d5ebd4b6a3b34e5c9ea2281a4993e1c 9929099 main/binary-amd64/Packages.xz
+SHA256:
+ 5b8f89e24b2ec2bc3a520e1d8d2c0d0b46b7b2f6cd17a6a6c92c2272e747e50b 38164760 main/binary-amd64/Packages
+ 3a8f0f0d6adb2fbb9d1b2bfae27d5e7e4c0c0e2c6e7b6f1b4c6dc0c2f1e7b7f1 9929099 main/binary-amd64/Packages.xz
+`
+
+// }}}
+
+func TestReleaseParse(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(releaseFile)))
+	isok(t, err)
+
+	assert(t, release.Origin == "Debian")
+	assert(t, release.Codename == "sid")
+	assert(t, release.AcquireByHash)
+	assert(t, len(release.Architectures) == 3)
+	assert(t, release.Architectures[1].CPU == "arm64")
+	assert(t, len(release.Components) == 3)
+	assert(t, release.Components[2] == "non-free")
+	assert(t, len(release.MD5Sum) == 2)
+	assert(t, len(release.SHA256) == 2)
+
+	assert(t, release.Date.Equal(time.Date(2017, 10, 14, 8, 52, 11, 0, time.UTC)))
+	assert(t, release.ValidUntil.Sub(release.Date.Time) == 7*24*time.Hour)
+	assert(t, !release.Expired(time.Date(2017, 10, 20, 0, 0, 0, 0, time.UTC)))
+	assert(t, release.Expired(time.Date(2017, 10, 22, 0, 0, 0, 0, time.UTC)))
+
+	hash, ok := release.Find("main/binary-amd64/Packages.xz")
+	assert(t, ok)
+	assert(t, hash.Size == 9929099)
+	assert(t, hash.Algorithm == "sha256")
+	assert(t, strings.HasPrefix(hash.Hash, "3a8f0f0d"))
+
+	_, ok = release.Find("main/binary-sparc/Packages.xz")
+	assert(t, !ok)
+}
+
+func TestReleaseBadDate(t *testing.T) {
+	_, err := control.ParseRelease(bufio.NewReader(strings.NewReader(`Origin: Debian
+Valid-Until: next week
+`)))
+	notok(t, err)
+}
+
+func TestReleaseMarshal(t *testing.T) {
+	release, err := control.ParseRelease(bufio.NewReader(strings.NewReader(releaseFile)))
+	isok(t, err)
+
+	writer := bytes.Buffer{}
+	isok(t, control.Marshal(&writer, release))
+	assert(t, writer.String() == releaseFile)
+}
+
+func TestOpenInRelease(t *testing.T) {
+	signer, err := openpgp.NewEntity("Archive Signer", "", "archive@example.com", nil)
+	isok(t, err)
+	stranger, err := openpgp.NewEntity("Stranger", "", "stranger@example.com", nil)
+	isok(t, err)
+
+	sign := func(data string) []byte {
+		signed := bytes.Buffer{}
+		w, err := clearsign.Encode(&signed, signer.PrivateKey, nil)
+		isok(t, err)
+		_, err = w.Write([]byte(data))
+		isok(t, err)
+		isok(t, w.Close())
+		return signed.Bytes()
+	}
+
+	validUntil := time.Now().Add(7 * 24 * time.Hour).UTC().Format("Mon, 02 Jan 2006 15:04:05 MST")
+	current := strings.Replace(releaseFile, "Sat, 21 Oct 2017 08:52:11 UTC", validUntil, 1)
+
+	release, keyID, err := control.OpenInRelease(bytes.NewReader(sign(current)), openpgp.EntityList{signer})
+	isok(t, err)
+	assert(t, release.Codename == "sid")
+	assert(t, len(release.SHA256) > 0)
+	assert(t, keyID == signer.PrimaryKey.KeyId)
+
+	_, _, err = control.OpenInRelease(bytes.NewReader(sign(current)), openpgp.EntityList{stranger})
+	notok(t, err)
+
+	/* Signed just fine, but past its Valid-Until */
+	_, _, err = control.OpenInRelease(bytes.NewReader(sign(releaseFile)), openpgp.EntityList{signer})
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "expired"))
+
+	_, _, err = control.OpenInRelease(strings.NewReader(current), openpgp.EntityList{signer})
+	assert(t, err == control.ErrNotSigned)
+
+	/* Signed yesterday, with a signature that was good for an hour.
+	 * clearsign can't set a lifetime, so the signature is put together by
+	 * hand, over the text with CRLF line endings and without the final
+	 * newline. */
+	digest := sha256.New()
+	digest.Write([]byte(strings.Replace(strings.TrimSuffix(current, "\n"), "\n", "\r\n", -1)))
+	lifetime := uint32(60 * 60)
+	sig := &packet.Signature{
+		SigType:         packet.SigTypeText,
+		PubKeyAlgo:      signer.PrivateKey.PubKeyAlgo,
+		Hash:            crypto.SHA256,
+		CreationTime:    time.Now().Add(-24 * time.Hour),
+		IssuerKeyId:     &signer.PrivateKey.KeyId,
+		SigLifetimeSecs: &lifetime,
+	}
+	isok(t, sig.Sign(digest, signer.PrivateKey, nil))
+	signed := bytes.NewBufferString("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA256\n\n" + current)
+	w, err := armor.Encode(signed, "PGP SIGNATURE", nil)
+	isok(t, err)
+	isok(t, sig.Serialize(w))
+	isok(t, w.Close())
+	_, _, err = control.OpenInRelease(signed, openpgp.EntityList{signer})
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "signature"))
+	assert(t, strings.Contains(err.Error(), "expired"))
+
+	/* Signed two days ago, while the key was still good, but the key
+	 * expired the day after */
+	past := &packet.Config{Time: func() time.Time { return time.Now().Add(-48 * time.Hour) }}
+	retired, err := openpgp.NewEntity("Retired Signer", "", "retired@example.com", past)
+	isok(t, err)
+	lifetime = uint32(24 * 60 * 60)
+	for _, identity := range retired.Identities {
+		identity.SelfSignature.KeyLifetimeSecs = &lifetime
+		isok(t, identity.SelfSignature.SignUserId(identity.UserId.Id, retired.PrimaryKey, retired.PrivateKey, past))
+	}
+	signed = &bytes.Buffer{}
+	w, err = clearsign.Encode(signed, retired.PrivateKey, past)
+	isok(t, err)
+	_, err = w.Write([]byte(current))
+	isok(t, err)
+	isok(t, w.Close())
+	_, _, err = control.OpenInRelease(signed, openpgp.EntityList{retired})
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "key"))
+	assert(t, strings.Contains(err.Error(), "expired"))
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,124 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A GitLocation is the parsed form of a Vcs-Git field, which looks
+// something like:
+//
+//   https://salsa.debian.org/go-team/packages/foo.git -b debian/sid [sub/dir]
+//
+// Where both the `-b branch` and the `[path]` are optional.
+type GitLocation struct {
+	URL    string
+	Branch string
+	Path   string
+}
+
+// Parse a Vcs-Git field value into a GitLocation.
+func ParseGitLocation(value string) (*GitLocation, error) {
+	ret := GitLocation{}
+	fields := strings.Fields(value)
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch {
+		case field == "-b":
+			if i+1 >= len(fields) {
+				return nil, fmt.Errorf("Vcs-Git '%s' has a -b without a branch", value)
+			}
+			if ret.Branch != "" {
+				return nil, fmt.Errorf("Vcs-Git '%s' has more than one branch", value)
+			}
+			i++
+			ret.Branch = fields[i]
+		case strings.HasPrefix(field, "["):
+			if !strings.HasSuffix(field, "]") {
+				return nil, fmt.Errorf("Vcs-Git '%s' has an unterminated path", value)
+			}
+			if ret.Path != "" {
+				return nil, fmt.Errorf("Vcs-Git '%s' has more than one path", value)
+			}
+			ret.Path = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+		default:
+			if ret.URL != "" {
+				return nil, fmt.Errorf("Vcs-Git '%s' has trailing garbage: '%s'", value, field)
+			}
+			ret.URL = field
+		}
+	}
+
+	if ret.URL == "" {
+		return nil, fmt.Errorf("Vcs-Git '%s' has no URL", value)
+	}
+	return &ret, nil
+}
+
+func (g GitLocation) String() string {
+	els := []string{g.URL}
+	if g.Branch != "" {
+		els = append(els, "-b", g.Branch)
+	}
+	if g.Path != "" {
+		els = append(els, "["+g.Path+"]")
+	}
+	return strings.Join(els, " ")
+}
+
+// A DgitInfo is the parsed form of the Dgit field dgit adds to the .dsc of
+// the sources it uploads, which looks something like:
+//
+//   9a3c5e7c0a4f2ab0a9dd0d3c2e6f41e1b8b4f2f7 debian archive/debian/1.0-1 https://git.dgit.debian.org/foo
+//
+// Commit is the git object id of the commit the source was made from, and
+// Metadata holds whatever tokens follow it (the distro, the tag and the
+// repository, with current versions of dgit), as they were given.
+type DgitInfo struct {
+	Commit   string
+	Metadata []string
+}
+
+// Parse a Dgit field value into a DgitInfo. An empty value gives the zero
+// DgitInfo, since most sources aren't uploaded with dgit; otherwise the
+// value has to start with a full (SHA-1 or SHA-256) git object id.
+func ParseDgit(value string) (DgitInfo, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return DgitInfo{}, nil
+	}
+
+	commit := fields[0]
+	if (len(commit) != 40 && len(commit) != 64) ||
+		strings.Trim(strings.ToLower(commit), "0123456789abcdef") != "" {
+		return DgitInfo{}, fmt.Errorf("Dgit '%s' doesn't start with a git object id", value)
+	}
+	return DgitInfo{Commit: commit, Metadata: fields[1:]}, nil
+}
+
+func (d DgitInfo) String() string {
+	return strings.Join(append([]string{d.Commit}, d.Metadata...), " ")
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,104 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package control_test
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/control"
+)
+
+/*
+ *
+ */
+
+func TestDSCVcsParse(t *testing.T) {
+	// Test DSC {{{
+	reader := bufio.NewReader(strings.NewReader(`Format: 3.0 (quilt)
+Source: fbautostart
+Version: 2.718281828-1
+Vcs-Browser: https://salsa.debian.org/debian/fbautostart
+Vcs-Git: https://salsa.debian.org/debian/fbautostart.git -b debian/sid [packaging]
+Vcs-Svn: svn://svn.debian.org/fbautostart
+`))
+	// }}}
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+
+	assert(t, c.VcsBrowser == "https://salsa.debian.org/debian/fbautostart")
+	assert(t, c.VcsSvn == "svn://svn.debian.org/fbautostart")
+	assert(t, c.VcsBzr == "")
+
+	location, err := c.GitLocation()
+	isok(t, err)
+	assert(t, location.URL == "https://salsa.debian.org/debian/fbautostart.git")
+	assert(t, location.Branch == "debian/sid")
+	assert(t, location.Path == "packaging")
+	assert(t, location.String() == c.VcsGit)
+}
+
+func TestParseGitLocation(t *testing.T) {
+	location, err := control.ParseGitLocation("git://git.debian.org/collab-maint/fbautostart.git")
+	isok(t, err)
+	assert(t, location.URL == "git://git.debian.org/collab-maint/fbautostart.git")
+	assert(t, location.Branch == "")
+	assert(t, location.Path == "")
+
+	location, err = control.ParseGitLocation("https://example.com/foo.git [sub/dir] -b main")
+	isok(t, err)
+	assert(t, location.Branch == "main")
+	assert(t, location.Path == "sub/dir")
+
+	_, err = control.ParseGitLocation("https://example.com/foo.git -b")
+	notok(t, err)
+	_, err = control.ParseGitLocation("https://example.com/foo.git https://example.com/bar.git")
+	notok(t, err)
+	_, err = control.ParseGitLocation("")
+	notok(t, err)
+}
+
+func TestDSCDgitParse(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(`Source: fbautostart
+Version: 2.718281828-1
+Dgit: 9a3c5e7c0a4f2ab0a9dd0d3c2e6f41e1b8b4f2f7 debian archive/debian/2.718281828-1 https://git.dgit.debian.org/fbautostart
+`))
+	c, err := control.ParseDsc(reader, "")
+	isok(t, err)
+	dgit, err := c.ParsedDgit()
+	isok(t, err)
+	assert(t, dgit.Commit == "9a3c5e7c0a4f2ab0a9dd0d3c2e6f41e1b8b4f2f7")
+	assert(t, len(dgit.Metadata) == 3)
+	assert(t, dgit.Metadata[1] == "archive/debian/2.718281828-1")
+	assert(t, dgit.String() == c.Dgit)
+
+	dgit, err = (&control.DSC{}).ParsedDgit()
+	isok(t, err)
+	assert(t, dgit.Commit == "" && len(dgit.Metadata) == 0)
+
+	_, err = control.ParseDgit("9a3c5e7 debian")
+	notok(t, err)
+	_, err = control.ParseDgit("zz3c5e7c0a4f2ab0a9dd0d3c2e6f41e1b8b4f2f7")
+	notok(t, err)
+}
+
+// vim: foldmethod=marker
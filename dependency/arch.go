@@ -53,6 +53,9 @@ func ParseArchitectures(arch string) ([]Arch, error) {
 }
 
 func (arch *Arch) UnmarshalControl(data string) error {
+	/* Start from any-any-any, as ParseArch does, so that the parts
+	 * `linux-any` leaves out are wildcards rather than empty. */
+	*arch = Arch{ABI: "any", OS: "any", CPU: "any"}
 	return parseArchInto(arch, data)
 }
 
@@ -70,16 +73,20 @@ func ParseArch(arch string) (*Arch, error) {
 func parseArchInto(ret *Arch, arch string) error {
 	/* May be in the following form:
 	 * `any` (implicitly any-any-any)
+	 * `source` (source-source-source, as found in a .changes)
 	 * kfreebsd-any (implicitly any-kfreebsd-any)
 	 * kfreebsd-amd64 (implicitly any-kfreebsd-any)
 	 * bsd-openbsd-i386 */
 	flavors := strings.SplitN(arch, "-", 3)
+	for i, flavor := range flavors {
+		flavors[i] = foldKeyword(flavor)
+	}
 	switch len(flavors) {
 	case 1:
 		flavor := flavors[0]
 		/* OK, we've got a single guy like `any` or `amd64` */
 		switch flavor {
-		case "all", "any":
+		case "all", "any", "source":
 			ret.ABI = flavor
 			ret.OS = flavor
 			ret.CPU = flavor
@@ -95,6 +102,9 @@ func parseArchInto(ret *Arch, arch string) error {
 		 * gnu-kfreebsd-amd64 */
 		ret.OS = flavors[0]
 		ret.CPU = flavors[1]
+		if ret.OS != "any" && ret.CPU != "any" {
+			ret.ABI = "gnu"
+		}
 	case 3:
 		/* This is something like bsd-openbsd-amd64 */
 		ret.ABI = flavors[0]
@@ -107,6 +117,34 @@ func parseArchInto(ret *Arch, arch string) error {
 	return nil
 }
 
+// Architecture names are compared without regard to case, but anything
+// other than the `all`, `any` and `source` keywords keeps the case it was
+// written in, so it's written back out the same way.
+func foldKeyword(part string) string {
+	switch lower := strings.ToLower(part); lower {
+	case "all", "any", "source":
+		return lower
+	}
+	return part
+}
+
+// Return a copy of the Arch with every part in lower case, for comparing.
+func (arch Arch) folded() Arch {
+	return Arch{
+		ABI: strings.ToLower(arch.ABI),
+		OS:  strings.ToLower(arch.OS),
+		CPU: strings.ToLower(arch.CPU),
+	}
+}
+
+// Check to see if this is the same architecture as the other one. As with
+// the rest of the comparisons, case doesn't matter, so `AMD64` is the same
+// as `amd64`. Wildcards are only equal to the same wildcard; use Matches to
+// check if an Arch is one of the architectures a wildcard stands for.
+func (arch Arch) Equals(other Arch) bool {
+	return arch.folded() == other.folded()
+}
+
 /*
  */
 func (set *ArchSet) Matches(other *Arch) bool {
@@ -119,7 +157,7 @@ func (set *ArchSet) Matches(other *Arch) bool {
 
 	not := set.Not
 	for _, el := range set.Architectures {
-		if el.Is(other) {
+		if other.Matches(el) {
 			/* For each arch; check if it matches. If it does, then
 			 * return true (unless we're negated) */
 			return !not
@@ -129,9 +167,33 @@ func (set *ArchSet) Matches(other *Arch) bool {
 	return not
 }
 
-/*
- */
-func (arch *Arch) IsWildcard() bool {
+// Check to see if this is the special `all` arch, used by packages that
+// are the same on every architecture.
+func (arch Arch) IsAll() bool {
+	arch = arch.folded()
+	return arch.ABI == "all" && arch.OS == "all" && arch.CPU == "all"
+}
+
+// Check to see if this is the special `source` arch, which the Architecture
+// field of a .changes lists when the upload contains a source package. It
+// isn't a real architecture, so no wildcard matches it.
+func (arch Arch) IsSource() bool {
+	arch = arch.folded()
+	return arch.ABI == "source" && arch.OS == "source" && arch.CPU == "source"
+}
+
+// Check to see if this is the `any` arch (any-any-any), which matches
+// every real architecture.
+func (arch Arch) IsAny() bool {
+	arch = arch.folded()
+	return arch.ABI == "any" && arch.OS == "any" && arch.CPU == "any"
+}
+
+// Check to see if any part of this arch is `any`, such as `any` itself,
+// `linux-any` or `any-amd64`, meaning it stands for a set of
+// architectures rather than a concrete one.
+func (arch Arch) IsWildcard() bool {
+	arch = arch.folded()
 	if arch.CPU == "all" {
 		return false
 	}
@@ -142,6 +204,28 @@ func (arch *Arch) IsWildcard() bool {
 	return false
 }
 
+// Check to see if this (concrete) Arch matches the given pattern, using
+// the same wildcard rules as dpkg-architecture. Each of the ABI, OS and
+// CPU parts of the pattern may be `any`, which matches whatever the Arch
+// has in that spot, so `linux-any` matches `amd64` (gnu-linux-amd64), and
+// `any-i386` matches `i386` as well as `kfreebsd-i386`. The special `all`
+// and `source` archs only match themselves. Case doesn't matter.
+func (arch Arch) Matches(pattern Arch) bool {
+	arch, pattern = arch.folded(), pattern.folded()
+	if arch.CPU == "all" || pattern.CPU == "all" ||
+		arch.IsSource() || pattern.IsSource() {
+		return arch.CPU == pattern.CPU
+	}
+
+	matches := func(value, pattern string) bool {
+		return pattern == "any" || value == pattern
+	}
+
+	return matches(arch.ABI, pattern.ABI) &&
+		matches(arch.OS, pattern.OS) &&
+		matches(arch.CPU, pattern.CPU)
+}
+
 /*
  */
 func (arch *Arch) Is(other *Arch) bool {
@@ -156,9 +240,14 @@ func (arch *Arch) Is(other *Arch) bool {
 		return other.Is(arch)
 	}
 
-	if (arch.CPU == other.CPU || (arch.CPU != "all" && other.CPU == "any")) &&
-		(arch.OS == other.OS || other.OS == "any") &&
-		(arch.ABI == other.ABI || other.ABI == "any") {
+	if arch.IsSource() || other.IsSource() {
+		return arch.IsSource() && other.IsSource()
+	}
+
+	a, o := arch.folded(), other.folded()
+	if (a.CPU == o.CPU || (a.CPU != "all" && o.CPU == "any")) &&
+		(a.OS == o.OS || o.OS == "any") &&
+		(a.ABI == o.ABI || o.ABI == "any") {
 
 		return true
 	}
@@ -119,4 +119,127 @@ func TestArchSetCompare(t *testing.T) {
 	assert(t, barArch.Matches(iAmNot))
 }
 
+func TestArchMatches(t *testing.T) {
+	for arch, patterns := range map[string][]string{
+		"amd64":         []string{"any", "linux-any", "any-amd64", "gnu-linux-any", "amd64", "linux-amd64"},
+		"kfreebsd-i386": []string{"any", "kfreebsd-any", "any-i386", "gnu-kfreebsd-i386"},
+		"all":           []string{"all"},
+		"source":        []string{"source"},
+	} {
+		concrete, err := dependency.ParseArch(arch)
+		isok(t, err)
+		for _, el := range patterns {
+			pattern, err := dependency.ParseArch(el)
+			isok(t, err)
+			assert(t, concrete.Matches(*pattern))
+		}
+	}
+
+	for arch, patterns := range map[string][]string{
+		"amd64":         []string{"all", "kfreebsd-any", "any-i386", "musl-linux-any", "i386", "source"},
+		"kfreebsd-i386": []string{"linux-any", "i386"},
+		"all":           []string{"any", "amd64"},
+		"source":        []string{"any", "linux-any", "all"},
+	} {
+		concrete, err := dependency.ParseArch(arch)
+		isok(t, err)
+		for _, el := range patterns {
+			pattern, err := dependency.ParseArch(el)
+			isok(t, err)
+			assert(t, !concrete.Matches(*pattern))
+		}
+	}
+}
+
+func TestArchSetWildcards(t *testing.T) {
+	dep, err := dependency.Parse("foo [linux-any], bar [!any-i386], baz [kfreebsd-any hurd-any]")
+	isok(t, err)
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	els := dep.GetPossibilities(*amd64)
+	assert(t, len(els) == 2)
+	assert(t, els[0].Name == "foo")
+	assert(t, els[1].Name == "bar")
+
+	i386, err := dependency.ParseArch("kfreebsd-i386")
+	isok(t, err)
+	els = dep.GetPossibilities(*i386)
+	assert(t, len(els) == 1)
+	assert(t, els[0].Name == "baz")
+}
+
+func TestArchAllAnyWildcard(t *testing.T) {
+	all, err := dependency.ParseArch("all")
+	isok(t, err)
+	assert(t, all.IsAll())
+	assert(t, !all.IsAny())
+	assert(t, !all.IsWildcard())
+	assert(t, all.String() == "all")
+
+	any, err := dependency.ParseArch("any")
+	isok(t, err)
+	assert(t, !any.IsAll())
+	assert(t, any.IsAny())
+	assert(t, any.IsWildcard())
+	assert(t, any.String() == "any")
+
+	linux, err := dependency.ParseArch("linux-any")
+	isok(t, err)
+	assert(t, linux.OS == "linux")
+	assert(t, linux.CPU == "any")
+	assert(t, !linux.IsAny())
+	assert(t, linux.IsWildcard())
+	assert(t, linux.String() == "linux-any")
+
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	assert(t, !amd64.IsAll())
+	assert(t, !amd64.IsAny())
+	assert(t, !amd64.IsWildcard())
+	assert(t, !amd64.IsSource())
+
+	source, err := dependency.ParseArch("source")
+	isok(t, err)
+	assert(t, source.IsSource())
+	assert(t, !source.IsWildcard())
+	assert(t, source.String() == "source")
+	assert(t, source.Is(source))
+	assert(t, !source.Is(any))
+	assert(t, !any.Is(source))
+}
+
+func TestArchCaseInsensitive(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	upper := dependency.Arch{ABI: "gnu", OS: "linux", CPU: "AMD64"}
+	assert(t, upper.Equals(*amd64))
+	assert(t, upper.Matches(*amd64))
+	assert(t, amd64.Matches(upper))
+	assert(t, upper.Is(amd64))
+	assert(t, upper.String() == "AMD64")
+
+	for _, el := range []string{"ANY", "Linux-Any", "any-AMD64"} {
+		pattern, err := dependency.ParseArch(el)
+		isok(t, err)
+		assert(t, pattern.IsWildcard())
+		assert(t, amd64.Matches(*pattern))
+		assert(t, upper.Matches(*pattern))
+	}
+
+	all, err := dependency.ParseArch("ALL")
+	isok(t, err)
+	assert(t, all.IsAll())
+	assert(t, all.String() == "all")
+
+	set := dependency.ArchSet{Architectures: []dependency.Arch{upper}}
+	assert(t, set.Matches(amd64))
+
+	dep, err := dependency.Parse("foo [AMD64 Kfreebsd-any]")
+	isok(t, err)
+	assert(t, len(dep.GetPossibilities(*amd64)) == 1)
+	assert(t, dep.String() == "foo [AMD64 Kfreebsd-any]")
+}
+
 // vim: foldmethod=marker
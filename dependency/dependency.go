@@ -21,6 +21,9 @@
 package dependency
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/cinello/go-debian/version"
 )
 
@@ -44,7 +47,34 @@ func (dep *Dependency) GetPossibilities(arch Arch) []Possibility {
 	return possies
 }
 
-//
+// Get the Possibilities that apply when building on the given Arch with
+// the given set of build profiles active. Relations that are restricted
+// to other profiles are dropped, just like relations restricted to other
+// architectures.
+func (dep *Dependency) GetPossibilitiesWithProfiles(arch Arch, profiles []string) []Possibility {
+	possies := []Possibility{}
+
+	for _, relation := range dep.Relations {
+		for _, possibility := range relation.Possibilities {
+			if possibility.Substvar {
+				continue
+			}
+
+			if possibility.Architectures.Matches(&arch) && possibility.SatisfiesProfiles(profiles) {
+				possies = append(possies, possibility)
+				break
+			}
+		}
+	}
+
+	return possies
+}
+
+// Get every Possibility of every Relation, regardless of any architecture
+// or build profile restriction, in the order they were written. Substvars
+// are skipped. The restrictions are left on each Possibility, so callers
+// building a dependency graph across all architectures can do their own
+// filtering; the AND/OR structure itself is in dep.Relations.
 func (dep *Dependency) GetAllPossibilities() []Possibility {
 	possies := []Possibility{}
 
@@ -60,7 +90,7 @@ func (dep *Dependency) GetAllPossibilities() []Possibility {
 	return possies
 }
 
-//
+// Get every Possibility that is a substvar, such as `${misc:Depends}`.
 func (dep *Dependency) GetSubstvars() []Possibility {
 	possies := []Possibility{}
 
@@ -75,6 +105,373 @@ func (dep *Dependency) GetSubstvars() []Possibility {
 	return possies
 }
 
+// Check to see if any Relation names the given package in any of its
+// alternatives, regardless of version, architecture or build profile
+// restrictions. Substvars are not package names, and never match.
+func (dep Dependency) References(pkg string) bool {
+	for _, relation := range dep.Relations {
+		for _, possi := range relation.Possibilities {
+			if !possi.Substvar && possi.Name == pkg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return the sorted set of package names referenced anywhere in the
+// Dependency, including in alternatives, such as for building a reverse
+// dependency index. Substvars are left out.
+func (dep Dependency) Packages() []string {
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, relation := range dep.Relations {
+		for _, possi := range relation.Possibilities {
+			if possi.Substvar || seen[possi.Name] {
+				continue
+			}
+			seen[possi.Name] = true
+			ret = append(ret, possi.Name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Check to see if the Dependency is met by the given set of installed
+// packages, mapping the package name to the installed version, when on the
+// given Arch. Alternatives restricted to other architectures are ignored,
+// as are substvars.
+//
+// Installed packages may be keyed either by their bare name, which is taken
+// to be a package of the given Arch, or by `name:arch`. A Possibility with
+// the `:any` qualifier is satisfied by the package from any architecture,
+// and one with a concrete qualifier only by the package of that
+// architecture.
+//
+// If the Dependency is not met, the Relations that aren't satisfied by
+// any of the installed packages are returned as well.
+func (dep Dependency) SatisfiedBy(installed map[string]version.Version, arch Arch) (bool, []Relation) {
+	var unsatisfied []Relation
+
+	for _, relation := range dep.Relations {
+		applicable := false
+		satisfied := false
+
+		for _, possibility := range relation.Possibilities {
+			if possibility.Substvar {
+				continue
+			}
+			if possibility.Architectures != nil && !possibility.Architectures.Matches(&arch) {
+				continue
+			}
+			applicable = true
+
+			if possibility.satisfiedBy(installed, arch) {
+				satisfied = true
+				break
+			}
+		}
+
+		/* If none of the alternatives apply to this arch, there's
+		 * nothing to satisfy. */
+		if applicable && !satisfied {
+			unsatisfied = append(unsatisfied, relation)
+		}
+	}
+
+	return len(unsatisfied) == 0, unsatisfied
+}
+
+// Check to see if a single installed package, of the given name and version,
+// satisfies one of the Possibilities of the Relation, when resolving for
+// the given Arch. The name may be qualified with the architecture of the
+// package (such as `libc6:i386`), otherwise the package is taken to be of
+// the given Arch, just like the keys of the map given to
+// Dependency.SatisfiedBy. Possibilities restricted to other architectures
+// (such as `foo [!amd64]` on amd64) and substvars never match.
+func (relation Relation) Satisfies(name string, ver version.Version, arch Arch) bool {
+	installed := map[string]version.Version{name: ver}
+	for _, possibility := range relation.Possibilities {
+		if possibility.Substvar {
+			continue
+		}
+		if possibility.Architectures != nil && !possibility.Architectures.Matches(&arch) {
+			continue
+		}
+		if possibility.satisfiedBy(installed, arch) {
+			return true
+		}
+	}
+	return false
+}
+
+func (possi Possibility) satisfiedBy(installed map[string]version.Version, arch Arch) bool {
+	for _, ver := range possi.candidates(installed, arch) {
+		if possi.Version == nil || possi.Version.SatisfiedBy(ver) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the installed versions that may satisfy this Possibility, taking
+// the Multi-Arch qualifier into account.
+func (possi Possibility) candidates(installed map[string]version.Version, arch Arch) []version.Version {
+	ret := []version.Version{}
+	prefix := possi.Name + ":"
+
+	switch possi.ArchQualifier {
+	case "any":
+		for name, ver := range installed {
+			if name == possi.Name || strings.HasPrefix(name, prefix) {
+				ret = append(ret, ver)
+			}
+		}
+		return ret
+	case "", "native":
+		break
+	default:
+		if possi.Arch != nil && !possi.Arch.Is(&arch) {
+			/* Only the qualified arch will do. */
+			if ver, ok := installed[prefix+possi.ArchQualifier]; ok {
+				ret = append(ret, ver)
+			}
+			return ret
+		}
+	}
+
+	if ver, ok := installed[possi.Name]; ok {
+		ret = append(ret, ver)
+	}
+	if ver, ok := installed[prefix+arch.String()]; ok {
+		ret = append(ret, ver)
+	}
+	return ret
+}
+
+// Return a copy of the Dependency with duplicate Relations removed, and
+// version constraints on the same package collapsed down to the tightest
+// one, with the Relations sorted by their string form, such as turning
+//
+//   libc6 (>= 2.27), foo | bar, libc6 (>= 2.31), foo | bar
+//
+// into `foo | bar, libc6 (>= 2.31)`. Only Relations without alternatives
+// are collapsed, and only with others on the same package with the same
+// Multi-Arch qualifier, architecture and build profile restrictions. An
+// unversioned Relation is dropped if there's a versioned one on the same
+// package, since the latter implies it.
+func (dep Dependency) Normalize() Dependency {
+	type group struct {
+		relations []Relation
+		lower     *Possibility
+		upper     *Possibility
+		versioned bool
+	}
+
+	groups := map[string]*group{}
+	keys := []string{}
+	others := []Relation{}
+
+	for _, relation := range dep.Relations {
+		if len(relation.Possibilities) != 1 || relation.Possibilities[0].Substvar {
+			others = append(others, relation)
+			continue
+		}
+		possi := relation.Possibilities[0]
+		key := possi.normalizeKey()
+		if _, ok := groups[key]; !ok {
+			groups[key] = &group{}
+			keys = append(keys, key)
+		}
+		g := groups[key]
+		g.relations = append(g.relations, relation)
+		if possi.Version == nil {
+			continue
+		}
+		g.versioned = true
+		switch possi.Version.Operator {
+		case ">=", ">>":
+			if g.lower == nil || possi.Version.tighterThan(*g.lower.Version) {
+				possi := possi
+				g.lower = &possi
+			}
+		case "<=", "<<":
+			if g.upper == nil || possi.Version.tighterThan(*g.upper.Version) {
+				possi := possi
+				g.upper = &possi
+			}
+		}
+	}
+
+	relations := others
+	for _, key := range keys {
+		g := groups[key]
+		for _, relation := range g.relations {
+			possi := relation.Possibilities[0]
+			if possi.Version == nil && g.versioned {
+				continue
+			}
+			if possi.Version != nil {
+				switch possi.Version.Operator {
+				case ">=", ">>":
+					possi = *g.lower
+				case "<=", "<<":
+					possi = *g.upper
+				}
+			}
+			relations = append(relations, Relation{Possibilities: []Possibility{possi}})
+		}
+	}
+
+	seen := map[string]bool{}
+	ret := Dependency{Relations: []Relation{}}
+	for _, relation := range relations {
+		str := relation.String()
+		if seen[str] {
+			continue
+		}
+		seen[str] = true
+		ret.Relations = append(ret.Relations, relation)
+	}
+
+	sort.Stable(relationsByString(ret.Relations))
+	return ret
+}
+
+// relationsByString sorts Relations by how they're written out.
+type relationsByString []Relation
+
+func (a relationsByString) Len() int {
+	return len(a)
+}
+
+func (a relationsByString) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a relationsByString) Less(i, j int) bool {
+	return a[i].String() < a[j].String()
+}
+
+// Return a Dependency that's satisfied when both this Dependency and the
+// other one are, which is all of the Relations of both, Normalized.
+func (dep Dependency) And(other Dependency) Dependency {
+	relations := append(append([]Relation{}, dep.Relations...), other.Relations...)
+	return Dependency{Relations: relations}.Normalize()
+}
+
+// Return a Dependency that's satisfied when either this Dependency or the
+// other one is. Since a Dependency is a list of Relations that must all be
+// satisfied, this distributes the Relations of one over the other, so
+//
+//   a, b  OR  c | d, e
+//
+// becomes `a | c | d, a | e, b | c | d, b | e` (Normalized), rather than a
+// single Relation, which couldn't express it. The number of Relations is
+// the product of the two, so this is best kept to small formulas. As an
+// empty Dependency is always satisfied, so is the Or of one with anything.
+func (dep Dependency) Or(other Dependency) Dependency {
+	if len(dep.Relations) == 0 || len(other.Relations) == 0 {
+		return Dependency{Relations: []Relation{}}
+	}
+
+	relations := []Relation{}
+	for _, left := range dep.Relations {
+		for _, right := range other.Relations {
+			seen := map[string]bool{}
+			possis := []Possibility{}
+			for _, possi := range append(append([]Possibility{}, left.Possibilities...), right.Possibilities...) {
+				if str := possi.String(); !seen[str] {
+					seen[str] = true
+					possis = append(possis, possi)
+				}
+			}
+			relations = append(relations, Relation{Possibilities: possis})
+		}
+	}
+	return Dependency{Relations: relations}.Normalize()
+}
+
+// The Possibility without its version constraint, as a string, so that
+// Possibilities that only differ in their version can be grouped.
+func (possi Possibility) normalizeKey() string {
+	possi.Version = nil
+	return possi.String()
+}
+
+// Check to see if this bound is stricter than the other one, which must be
+// a bound in the same direction (both lower or both upper).
+func (v VersionRelation) tighterThan(other VersionRelation) bool {
+	ver, err := version.Parse(v.Number)
+	if err != nil {
+		return false
+	}
+	otherVer, err := version.Parse(other.Number)
+	if err != nil {
+		return false
+	}
+
+	q := version.Compare(ver, otherVer)
+	if q == 0 {
+		/* (>> 1.0) is stricter than (>= 1.0), and so is (<< 1.0) than
+		 * (<= 1.0) */
+		return len(v.Operator) == 2 && v.Operator[0] == v.Operator[1] &&
+			other.Operator[1] == '='
+	}
+
+	switch v.Operator {
+	case ">=", ">>":
+		return q > 0
+	}
+	return q < 0
+}
+
+// Check to see if the Possibility applies when the given build profiles
+// are active. A Possibility without any profile restriction always
+// applies.
+func (possi Possibility) SatisfiesProfiles(active []string) bool {
+	return possi.StageSets.SatisfiedBy(active)
+}
+
+// Check to see if the formula holds for the given active build profiles.
+// An empty formula is always satisfied, otherwise at least one of the
+// StageSets has to be.
+func (formula ProfileFormula) SatisfiedBy(active []string) bool {
+	if len(formula) == 0 {
+		return true
+	}
+	for _, stageSet := range formula {
+		if stageSet.SatisfiedBy(active) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check to see if every Stage in the set holds for the given active build
+// profiles.
+func (stageSet StageSet) SatisfiedBy(active []string) bool {
+	for _, stage := range stageSet.Stages {
+		if !stage.SatisfiedBy(active) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check to see if the Stage holds for the given active build profiles;
+// that is, the profile is active, or it is inactive and the Stage is
+// negated.
+func (stage Stage) SatisfiedBy(active []string) bool {
+	for _, profile := range active {
+		if profile == stage.Name {
+			return !stage.Not
+		}
+	}
+	return stage.Not
+}
+
 func (v VersionRelation) SatisfiedBy(ver version.Version) bool {
 	vVer, err := version.Parse(v.Number)
 	if err != nil {
@@ -21,6 +21,7 @@
 package dependency_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/cinello/go-debian/dependency"
@@ -69,6 +70,39 @@ func TestSliceAllParse(t *testing.T) {
 	assert(t, els[2].Name == "baz")
 }
 
+func TestSliceAllRestricted(t *testing.T) {
+	dep, err := dependency.Parse("foo [amd64], bar [!i386] <!nocheck> | baz <stage1>")
+	isok(t, err)
+
+	els := dep.GetAllPossibilities()
+	assert(t, len(els) == 3)
+
+	assert(t, els[0].Name == "foo")
+	assert(t, len(els[0].Architectures.Architectures) == 1)
+	assert(t, els[1].Name == "bar")
+	assert(t, els[1].Architectures.Not)
+	assert(t, len(els[1].StageSets) == 1)
+	assert(t, els[2].Name == "baz")
+	assert(t, len(els[2].StageSets) == 1)
+
+	arch, err := dependency.ParseArch("i386")
+	isok(t, err)
+	assert(t, len(dep.GetPossibilities(*arch)) == 1)
+}
+
+func TestReferences(t *testing.T) {
+	dep, err := dependency.Parse("libc6 (>= 2.14) [amd64], foo | bar:any <!nocheck>, ${misc:Depends}, libc6")
+	isok(t, err)
+
+	assert(t, dep.References("libc6"))
+	assert(t, dep.References("bar"))
+	assert(t, !dep.References("baz"))
+	assert(t, !dep.References("misc:Depends"))
+	assert(t, strings.Join(dep.Packages(), " ") == "bar foo libc6")
+
+	assert(t, len(dependency.Dependency{}.Packages()) == 0)
+}
+
 func TestSliceSubParse(t *testing.T) {
 	dep, err := dependency.Parse("${foo:Depends}, foo, bar | baz, ${bar:Depends}")
 	isok(t, err)
@@ -118,4 +152,205 @@ func TestVersionRelationSatisfiedBy(t *testing.T) {
 	}
 }
 
+func TestDependencySatisfiedBy(t *testing.T) {
+	dep, err := dependency.Parse("foo (>= 1.0), bar | baz (<< 2.0), qux [sparc], ${misc:Depends}")
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	parse := func(in string) version.Version {
+		v, err := version.Parse(in)
+		isok(t, err)
+		return v
+	}
+
+	ok, unsatisfied := dep.SatisfiedBy(map[string]version.Version{
+		"foo": parse("1.0-1"),
+		"baz": parse("1.9"),
+	}, *arch)
+	assert(t, ok)
+	assert(t, len(unsatisfied) == 0)
+
+	ok, unsatisfied = dep.SatisfiedBy(map[string]version.Version{
+		"foo": parse("0.9"),
+		"baz": parse("2.0"),
+	}, *arch)
+	assert(t, !ok)
+	assert(t, len(unsatisfied) == 2)
+	assert(t, unsatisfied[0].Possibilities[0].Name == "foo")
+	assert(t, unsatisfied[1].Possibilities[1].Name == "baz")
+
+	/* qux only matters on sparc */
+	sparc, err := dependency.ParseArch("sparc")
+	isok(t, err)
+	ok, unsatisfied = dep.SatisfiedBy(map[string]version.Version{
+		"foo": parse("1.0"),
+		"bar": parse("1.0"),
+	}, *sparc)
+	assert(t, !ok)
+	assert(t, len(unsatisfied) == 1)
+	assert(t, unsatisfied[0].Possibilities[0].Name == "qux")
+}
+
+func TestDependencyProfiles(t *testing.T) {
+	dep, err := dependency.Parse("debhelper, python3-sphinx <!nocheck>, gcc-cross <stage1 cross> <stage2>")
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	sphinx := dep.Relations[1].Possibilities[0]
+	assert(t, len(sphinx.StageSets) == 1)
+	assert(t, sphinx.SatisfiesProfiles(nil))
+	assert(t, !sphinx.SatisfiesProfiles([]string{"nocheck"}))
+	assert(t, dep.Relations[0].Possibilities[0].SatisfiesProfiles([]string{"nocheck"}))
+
+	cross := dep.Relations[2].Possibilities[0]
+	assert(t, !cross.SatisfiesProfiles(nil))
+	assert(t, !cross.SatisfiesProfiles([]string{"stage1"}))
+	assert(t, cross.SatisfiesProfiles([]string{"stage1", "cross"}))
+	assert(t, cross.SatisfiesProfiles([]string{"stage2"}))
+
+	els := dep.GetPossibilitiesWithProfiles(*arch, nil)
+	assert(t, len(els) == 2)
+	assert(t, els[1].Name == "python3-sphinx")
+
+	els = dep.GetPossibilitiesWithProfiles(*arch, []string{"nocheck", "stage2"})
+	assert(t, len(els) == 2)
+	assert(t, els[1].Name == "gcc-cross")
+}
+
+func TestDependencySatisfiedByMultiarch(t *testing.T) {
+	dep, err := dependency.Parse("python3:any, libfoo:native, libbar:i386")
+	isok(t, err)
+	arch, err := dependency.ParseArch("amd64")
+	isok(t, err)
+
+	ver, err := version.Parse("1.0")
+	isok(t, err)
+
+	ok, unsatisfied := dep.SatisfiedBy(map[string]version.Version{
+		"python3:i386": ver,
+		"libfoo":       ver,
+		"libbar:i386":  ver,
+	}, *arch)
+	assert(t, ok)
+	assert(t, len(unsatisfied) == 0)
+
+	ok, unsatisfied = dep.SatisfiedBy(map[string]version.Version{
+		"python3":      ver,
+		"libfoo:amd64": ver,
+		"libbar":       ver,
+	}, *arch)
+	assert(t, !ok)
+	assert(t, len(unsatisfied) == 1)
+	assert(t, unsatisfied[0].Possibilities[0].Name == "libbar")
+}
+
+func TestDependencyNormalize(t *testing.T) {
+	for in, out := range map[string]string{
+		"libc6 (>= 2.27), foo | bar, libc6 (>= 2.31), foo | bar": "foo | bar, libc6 (>= 2.31)",
+		"libc6, libc6 (>= 2.27)":                                 "libc6 (>= 2.27)",
+		"foo (>= 1.0), foo (>> 1.0), foo (<< 2.0), foo (<= 2.0)": "foo (<< 2.0), foo (>> 1.0)",
+		"foo (>= 1.0), foo:any (>= 2.0), foo (>= 3.0) [amd64]":   "foo (>= 1.0), foo (>= 3.0) [amd64], foo:any (>= 2.0)",
+		"foo (>= 2.0) | bar, foo (>= 1.0)":                       "foo (>= 1.0), foo (>= 2.0) | bar",
+		"foo (= 1.0), foo (= 1.0), foo (= 1.1)":                  "foo (= 1.0), foo (= 1.1)",
+		"b, ${misc:Depends}, a, ${misc:Depends}":                 "${misc:Depends}, a, b",
+	} {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		normalized := dep.Normalize()
+		if normalized.String() != out {
+			t.Errorf("Normalize(%q) = %q, want %q", in, normalized.String(), out)
+		}
+	}
+}
+
+func TestDependencyAndOr(t *testing.T) {
+	parse := func(in string) dependency.Dependency {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		return *dep
+	}
+
+	for _, test := range []struct {
+		a, b, and, or string
+	}{
+		{"a, b", "c | d, e", "a, b, c | d, e", "a | c | d, a | e, b | c | d, b | e"},
+		{"libc6 (>= 2.27)", "libc6 (>= 2.31), foo", "foo, libc6 (>= 2.31)", "libc6 (>= 2.27) | foo, libc6 (>= 2.27) | libc6 (>= 2.31)"},
+		{"a | b", "b | c", "a | b, b | c", "a | b | c"},
+		{"a", "", "a", ""},
+	} {
+		a, b := parse(test.a), parse(test.b)
+		if got := a.And(b).String(); got != test.and {
+			t.Errorf("%q And %q = %q, want %q", test.a, test.b, got, test.and)
+		}
+		if got := a.Or(b).String(); got != test.or {
+			t.Errorf("%q Or %q = %q, want %q", test.a, test.b, got, test.or)
+		}
+	}
+}
+
+func TestRelationSatisfies(t *testing.T) {
+	amd64, err := dependency.ParseArch("amd64")
+	isok(t, err)
+	i386, err := dependency.ParseArch("i386")
+	isok(t, err)
+
+	relation := func(in string) dependency.Relation {
+		dep, err := dependency.Parse(in)
+		isok(t, err)
+		assert(t, len(dep.Relations) == 1)
+		return dep.Relations[0]
+	}
+	ver := func(in string) version.Version {
+		v, err := version.Parse(in)
+		isok(t, err)
+		return v
+	}
+
+	/* Operators around an epoch boundary: 1:0.9 is newer than 2.0 */
+	for _, test := range []struct {
+		relation  string
+		installed string
+		satisfied bool
+	}{
+		{"foo (<< 1:1.0)", "1:0.9", true},
+		{"foo (<< 1:1.0)", "1:1.0", false},
+		{"foo (<< 1:1.0)", "2.0", true},
+		{"foo (<< 1:1.0)", "2:0.1", false},
+		{"foo (<= 1:1.0)", "1:1.0", true},
+		{"foo (<= 1:1.0)", "1:1.0-1", false},
+		{"foo (<= 1:1.0)", "9.9", true},
+		{"foo (= 1:1.0)", "1:1.0", true},
+		{"foo (= 1:1.0)", "1.0", false},
+		{"foo (= 0:1.0)", "1.0", true},
+		{"foo (>= 1:1.0)", "1:1.0", true},
+		{"foo (>= 1:1.0)", "1:1.0~rc1", false},
+		{"foo (>= 1:1.0)", "99.0", false},
+		{"foo (>= 1:1.0)", "2:0", true},
+		{"foo (>> 1:1.0)", "1:1.0", false},
+		{"foo (>> 1:1.0)", "1:1.0+b1", true},
+		{"foo (>> 1.0)", "1:0.1", true},
+		{"foo", "0.1", true},
+		{"bar | foo (>= 2.0)", "2.0", true},
+		{"bar (>= 2.0)", "2.0", false},
+	} {
+		got := relation(test.relation).Satisfies("foo", ver(test.installed), *amd64)
+		if got != test.satisfied {
+			t.Errorf("%q satisfied by foo %s: got %t, want %t",
+				test.relation, test.installed, got, test.satisfied)
+		}
+	}
+
+	/* Architecture qualifiers and restrictions */
+	assert(t, relation("foo [amd64]").Satisfies("foo", ver("1.0"), *amd64))
+	assert(t, !relation("foo [amd64]").Satisfies("foo", ver("1.0"), *i386))
+	assert(t, !relation("foo [!amd64]").Satisfies("foo", ver("1.0"), *amd64))
+	assert(t, relation("foo:i386").Satisfies("foo:i386", ver("1.0"), *amd64))
+	assert(t, !relation("foo:i386").Satisfies("foo", ver("1.0"), *amd64))
+	assert(t, relation("foo:any").Satisfies("foo:i386", ver("1.0"), *amd64))
+	assert(t, !relation("foo").Satisfies("foo:i386", ver("1.0"), *amd64))
+	assert(t, !relation("${misc:Depends}").Satisfies("misc:Depends", ver("1.0"), *amd64))
+}
+
 // vim: foldmethod=marker
@@ -43,15 +43,24 @@ type VersionRelation struct {
 	Operator string
 }
 
+// Stage models a single build profile name in a restriction formula, such
+// as `stage1` or `!nocheck`.
 type Stage struct {
 	Not  bool
 	Name string
 }
 
+// StageSet models one `<...>` group of a restriction formula. All the
+// Stages in the set must hold for the set to be satisfied.
 type StageSet struct {
 	Stages []Stage
 }
 
+// ProfileFormula models the full build profile restriction on a
+// Possibility, such as `<!nocheck> <stage1 cross>`. The Possibility
+// applies if any one of the StageSets is satisfied.
+type ProfileFormula []StageSet
+
 // Possibility models a concrete Possibility that may be satisfied in order
 // to satisfy the Dependency Relation. Given the Dependency line:
 //
@@ -61,11 +70,23 @@ type StageSet struct {
 // further restrictions, such as restrictions on Version, Architecture, or
 // Build Stage.
 //
+// The ArchQualifier holds the Multi-Arch qualifier exactly as written after
+// the package name, such as `any`, `native` or `amd64`, or an empty string
+// if the Possibility didn't have one. Arch is the parsed form of the same
+// qualifier.
+//
+// The Architectures hold the architecture restriction list, such as
+// `[amd64 arm64]` or `[!armhf]` (in which case Architectures.Not is set).
+// If the Possibility didn't have one, the parser leaves it as an empty
+// ArchSet rather than nil. GetPossibilities filters on it, but it's kept
+// as parsed so that String writes out the same list.
+//
 type Possibility struct {
 	Name          string
 	Arch          *Arch
+	ArchQualifier string
 	Architectures *ArchSet
-	StageSets     []StageSet
+	StageSets     ProfileFormula
 	Version       *VersionRelation
 	Substvar      bool
 }
@@ -63,6 +63,52 @@ func (i *input) Next() byte {
 	return chr
 }
 
+/* Return a SyntaxError for the given offset into the input. */
+func (i *input) errorf(offset int, format string, args ...interface{}) error {
+	return &SyntaxError{
+		Data:   i.Data,
+		Offset: offset,
+		Err:    fmt.Errorf(format, args...),
+	}
+}
+
+// }}}
+
+// SyntaxError {{{
+
+// A SyntaxError is returned by Parse when a relation is malformed in a way
+// that can be pinned down to one spot, such as an opening `(`, `[` or `<`
+// that's never closed (in which case Offset points at the opening one), or
+// a closing `)`, `]` or `>` that was never opened. Offset is the offset of
+// the problem (in bytes, starting at 0) into Data, the string being parsed.
+type SyntaxError struct {
+	Data   string
+	Offset int
+	Err    error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d of '%s'", e.Err, e.Offset, e.Data)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Check if the byte closes one of the restrictions on a Possibility, and
+// return the one that opens it if so.
+func openerOf(chr byte) (byte, bool) {
+	switch chr {
+	case ')':
+		return '(', true
+	case ']':
+		return '[', true
+	case '>':
+		return '<', true
+	}
+	return 0, false
+}
+
 // }}}
 
 // Parse Helpers {{{
@@ -166,7 +212,9 @@ func parsePossibility(input *input, relation *Relation) error {
 				return err
 			}
 			continue
-		case ' ':
+		case ' ', '\t', '\r', '\n', '(', '[', '<':
+			/* The name ends at the first bit of whitespace, or at the
+			 * start of a restriction, as in `foo(>= 1.0)` */
 			err := parsePossibilityControllers(input, ret)
 			if err != nil {
 				return err
@@ -178,6 +226,9 @@ func parsePossibility(input *input, relation *Relation) error {
 			}
 			relation.Possibilities = append(relation.Possibilities, *ret)
 			return nil
+		case ')', ']', '>':
+			opener, _ := openerOf(peek)
+			return input.errorf(input.Index, "Unbalanced '%c' without a '%c'", peek, opener)
 		}
 		/* Not a control, let's append */
 		ret.Name += string(input.Next())
@@ -186,6 +237,7 @@ func parsePossibility(input *input, relation *Relation) error {
 
 func parseSubstvar(input *input, relation *Relation) error {
 	eatWhitespace(input)
+	open := input.Index
 	input.Next() /* Assert ch == '$' */
 	input.Next() /* Assert ch == '{' */
 
@@ -199,7 +251,7 @@ func parseSubstvar(input *input, relation *Relation) error {
 		peek := input.Peek()
 		switch peek {
 		case 0:
-			return errors.New("Oh no. Reached EOF before substvar finished")
+			return input.errorf(open, "Unbalanced '${' without a '}'")
 		case '}':
 			input.Next()
 			relation.Possibilities = append(relation.Possibilities, *ret)
@@ -222,7 +274,11 @@ func parseMultiarch(input *input, possi *Possibility) error {
 				return err
 			}
 			possi.Arch = arch
+			possi.ArchQualifier = name
 			return nil
+		case ')', ']', '>':
+			opener, _ := openerOf(peek)
+			return input.errorf(input.Index, "Unbalanced '%c' without a '%c'", peek, opener)
 		default:
 			name += string(input.Next())
 		}
@@ -267,7 +323,10 @@ func parsePossibilityControllers(input *input, possi *Possibility) error {
 			}
 			continue
 		}
-		return fmt.Errorf("Trailing garbage in a Possibility: %c", peek)
+		if opener, ok := openerOf(peek); ok {
+			return input.errorf(input.Index, "Unbalanced '%c' without a '%c'", peek, opener)
+		}
+		return input.errorf(input.Index, "Trailing garbage in a Possibility: %c", peek)
 	}
 	return nil
 }
@@ -275,16 +334,17 @@ func parsePossibilityControllers(input *input, possi *Possibility) error {
 /* */
 func parsePossibilityVersion(input *input, possi *Possibility) error {
 	eatWhitespace(input)
+	open := input.Index
 	input.Next() /* mandated to be ( */
 	// assert ch == '('
 	version := VersionRelation{}
 
-	err := parsePossibilityOperator(input, &version)
+	err := parsePossibilityOperator(input, open, &version)
 	if err != nil {
 		return err
 	}
 
-	err = parsePossibilityNumber(input, &version)
+	err = parsePossibilityNumber(input, open, &version)
 	if err != nil {
 		return err
 	}
@@ -297,9 +357,12 @@ func parsePossibilityVersion(input *input, possi *Possibility) error {
 }
 
 /* */
-func parsePossibilityOperator(input *input, version *VersionRelation) error {
+func parsePossibilityOperator(input *input, open int, version *VersionRelation) error {
 	eatWhitespace(input)
-	leader := input.Next() /* may be 0 */
+	if input.Peek() == 0 {
+		return input.errorf(open, "Unbalanced '(' without a ')'")
+	}
+	leader := input.Next()
 
 	if leader == '=' {
 		/* Great, good enough. */
@@ -310,8 +373,8 @@ func parsePossibilityOperator(input *input, version *VersionRelation) error {
 	/* This is always one of:
 	 * >=, <=, <<, >> */
 	secondary := input.Next()
-	if leader == 0 || secondary == 0 {
-		return errors.New("Oh no. Reached EOF before Operator finished")
+	if secondary == 0 {
+		return input.errorf(open, "Unbalanced '(' without a ')'")
 	}
 
 	operator := string([]rune{rune(leader), rune(secondary)})
@@ -330,15 +393,29 @@ func parsePossibilityOperator(input *input, version *VersionRelation) error {
 }
 
 /* */
-func parsePossibilityNumber(input *input, version *VersionRelation) error {
+func parsePossibilityNumber(input *input, open int, version *VersionRelation) error {
 	eatWhitespace(input)
 	for {
 		peek := input.Peek()
 		switch peek {
-		case 0:
-			return errors.New("Oh no. Reached EOF before Number finished")
+		case 0, ',', '|':
+			return input.errorf(open, "Unbalanced '(' without a ')'")
+		case '(', '[', ']', '<', '>':
+			return input.errorf(input.Index, "Unexpected '%c' in a version", peek)
 		case ')':
+			if version.Number == "" {
+				return input.errorf(input.Index, "Missing version number")
+			}
 			return nil
+		case ' ', '\t', '\r', '\n':
+			/* Space before the closing paren isn't part of the number,
+			 * but space inside of it is an error */
+			space := input.Index
+			eatWhitespace(input)
+			if input.Peek() != ')' && input.Peek() != 0 {
+				return input.errorf(space, "Version number '%s' has a space in it", version.Number)
+			}
+			continue
 		}
 		version.Number += string(input.Next())
 	}
@@ -347,19 +424,22 @@ func parsePossibilityNumber(input *input, version *VersionRelation) error {
 /* */
 func parsePossibilityArchs(input *input, possi *Possibility) error {
 	eatWhitespace(input)
+	open := input.Index
 	input.Next() /* Assert ch == '[' */
 
 	for {
+		/* Whitespace before the ']' doesn't make for another arch */
+		eatWhitespace(input)
 		peek := input.Peek()
 		switch peek {
-		case 0:
-			return errors.New("Oh no. Reached EOF before Arch list finished")
+		case 0, ',', '|':
+			return input.errorf(open, "Unbalanced '[' without a ']'")
 		case ']':
 			input.Next()
 			return nil
 		}
 
-		err := parsePossibilityArch(input, possi)
+		err := parsePossibilityArch(input, open, possi)
 		if err != nil {
 			return err
 		}
@@ -367,7 +447,7 @@ func parsePossibilityArchs(input *input, possi *Possibility) error {
 }
 
 /* */
-func parsePossibilityArch(input *input, possi *Possibility) error {
+func parsePossibilityArch(input *input, open int, possi *Possibility) error {
 	eatWhitespace(input)
 	arch := ""
 
@@ -387,11 +467,13 @@ func parsePossibilityArch(input *input, possi *Possibility) error {
 	for {
 		peek := input.Peek()
 		switch peek {
-		case 0:
-			return errors.New("Oh no. Reached EOF before Arch list finished")
+		case 0, ',', '|':
+			return input.errorf(open, "Unbalanced '[' without a ']'")
+		case '(', ')', '[', '<', '>':
+			return input.errorf(input.Index, "Unexpected '%c' in an arch list", peek)
 		case '!':
 			return errors.New("You can only negate whole blocks :(")
-		case ']', ' ': /* Let our parent deal with both of these */
+		case ']', ' ', '\t', '\r', '\n': /* Let our parent deal with these */
 			archObj, err := ParseArch(arch)
 			if err != nil {
 				return err
@@ -409,21 +491,22 @@ func parsePossibilityArch(input *input, possi *Possibility) error {
 /* */
 func parsePossibilityStageSet(input *input, possi *Possibility) error {
 	eatWhitespace(input)
+	open := input.Index
 	input.Next() /* Assert ch == '<' */
 
 	stageSet := StageSet{}
 	for {
 		peek := input.Peek()
 		switch peek {
-		case 0:
-			return errors.New("Oh no. Reached EOF before StageSet finished")
+		case 0, ',', '|':
+			return input.errorf(open, "Unbalanced '<' without a '>'")
 		case '>':
 			input.Next()
 			possi.StageSets = append(possi.StageSets, stageSet)
 			return nil
 		}
 
-		err := parsePossibilityStage(input, &stageSet)
+		err := parsePossibilityStage(input, open, &stageSet)
 		if err != nil {
 			return err
 		}
@@ -431,15 +514,17 @@ func parsePossibilityStageSet(input *input, possi *Possibility) error {
 }
 
 /* */
-func parsePossibilityStage(input *input, stageSet *StageSet) error {
+func parsePossibilityStage(input *input, open int, stageSet *StageSet) error {
 	eatWhitespace(input)
 
 	stage := Stage{}
 	for {
 		peek := input.Peek()
 		switch peek {
-		case 0:
-			return errors.New("Oh no. Reached EOF before Stage finished")
+		case 0, ',', '|':
+			return input.errorf(open, "Unbalanced '<' without a '>'")
+		case '(', ')', '[', ']', '<':
+			return input.errorf(input.Index, "Unexpected '%c' in a build profile", peek)
 		case '!':
 			input.Next()
 			if stage.Not {
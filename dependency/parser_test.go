@@ -86,6 +86,18 @@ func TestMultiarchParse(t *testing.T) {
 	assert(t, dep.Relations[0].Possibilities[0].Architectures.Architectures[1].CPU == "sparc")
 }
 
+func TestMultiarchQualifier(t *testing.T) {
+	for _, qualifier := range []string{"any", "native", "amd64", "kfreebsd-i386"} {
+		dep, err := dependency.Parse("foo:" + qualifier + " (>= 1.0)")
+		isok(t, err)
+
+		possi := dep.Relations[0].Possibilities[0]
+		assert(t, possi.Name == "foo")
+		assert(t, possi.ArchQualifier == qualifier)
+		assert(t, dep.String() == "foo:"+qualifier+" (>= 1.0)")
+	}
+}
+
 func TestTwoRelations(t *testing.T) {
 	dep, err := dependency.Parse("foo, bar")
 	isok(t, err)
@@ -175,6 +187,76 @@ func TestDoubleArch(t *testing.T) {
 	}
 }
 
+func TestArchRoundTrip(t *testing.T) {
+	for _, depStr := range []string{
+		"libfoo [amd64 arm64]",
+		"libfoo [!armhf]",
+		"libfoo [linux-any kfreebsd-any]",
+		"libfoo (>= 1.0) [amd64 arm64]",
+		"libfoo:any (<< 2.0) [!i386 !hurd-i386] <!nocheck>",
+	} {
+		dep, err := dependency.Parse(depStr)
+		isok(t, err)
+		assert(t, dep.String() == depStr)
+
+		possi := dep.Relations[0].Possibilities[0]
+		assert(t, possi.Architectures != nil)
+		for _, arch := range possi.Architectures.Architectures {
+			assert(t, arch.String() != "")
+		}
+	}
+
+	dep, err := dependency.Parse("libfoo [ amd64  arm64 ] (>= 1.0)")
+	isok(t, err)
+	assert(t, dep.String() == "libfoo (>= 1.0) [amd64 arm64]")
+
+	dep, err = dependency.Parse("libfoo [ !armhf ]")
+	isok(t, err)
+	possi := dep.Relations[0].Possibilities[0]
+	assert(t, possi.Architectures.Not)
+	assert(t, len(possi.Architectures.Architectures) == 1)
+	assert(t, possi.Architectures.Architectures[0].CPU == "armhf")
+}
+
+func TestVersionedAlternatives(t *testing.T) {
+	for depStr, expected := range map[string]string{
+		"debhelper (>= 12) | debhelper-compat (= 13)":     "debhelper (>= 12) | debhelper-compat (= 13)",
+		"debhelper(>= 12)|debhelper-compat(= 13)":         "debhelper (>= 12) | debhelper-compat (= 13)",
+		"debhelper ( >= 12 ) | debhelper-compat ( = 13 )": "debhelper (>= 12) | debhelper-compat (= 13)",
+		"debhelper (>= 12)\n | debhelper-compat\t(= 13)":  "debhelper (>= 12) | debhelper-compat (= 13)",
+	} {
+		dep, err := dependency.Parse(depStr)
+		isok(t, err)
+		assert(t, len(dep.Relations) == 1)
+		assert(t, dep.String() == expected)
+
+		possis := dep.Relations[0].Possibilities
+		assert(t, len(possis) == 2)
+		assert(t, possis[0].Name == "debhelper")
+		assert(t, possis[0].Version.Operator == ">=")
+		assert(t, possis[0].Version.Number == "12")
+		assert(t, possis[1].Name == "debhelper-compat")
+		assert(t, possis[1].Version.Operator == "=")
+		assert(t, possis[1].Version.Number == "13")
+	}
+
+	dep, err := dependency.Parse("a | b (<< 2) [amd64] <!nocheck> | c (>> 1:3)")
+	isok(t, err)
+	possis := dep.Relations[0].Possibilities
+	assert(t, len(possis) == 3)
+	assert(t, possis[0].Version == nil)
+	assert(t, possis[1].Version.String() == "(<< 2)")
+	assert(t, possis[2].Version.String() == "(>> 1:3)")
+	assert(t, possis[1].Architectures.Architectures[0].CPU == "amd64")
+	assert(t, dep.String() == "a | b (<< 2) [amd64] <!nocheck> | c (>> 1:3)")
+
+	_, err = dependency.Parse("foo (>= 1 .0)")
+	notok(t, err)
+	syntaxErr, ok := err.(*dependency.SyntaxError)
+	assert(t, ok)
+	assert(t, syntaxErr.Offset == 9)
+}
+
 func TestVersioningOperators(t *testing.T) {
 	opers := map[string]string{
 		">=": "foo (>= 1.0)",
@@ -303,18 +385,48 @@ func TestSingleSubstvar(t *testing.T) {
 	assert(t, !dep.Relations[2].Possibilities[0].Substvar)
 }
 
+func TestUnbalancedBrackets(t *testing.T) {
+	for input, offset := range map[string]int{
+		"foo (>= 1.0":              4,
+		"foo (>= 1.0, bar":         4,
+		"foo (>= (1.0))":           8,
+		"foo (>= 1.0))":            12,
+		"foo [amd64":               4,
+		"foo [amd64, bar":          4,
+		"foo [amd64 [i386]]":       11,
+		"foo [amd64]]":             11,
+		"foo <stage1":              4,
+		"foo <stage1 | bar":        4,
+		"foo <stage1 <cross>>":     12,
+		"foo)":                     3,
+		"bar, foo:any]":            12,
+		"bar, foo (>= 1.0) [amd64": 18,
+		"${foo:Depends":            0,
+	} {
+		_, err := dependency.Parse(input)
+		notok(t, err)
+		syntaxErr, ok := err.(*dependency.SyntaxError)
+		if !ok {
+			t.Fatalf("%q: expected a SyntaxError, got %v", input, err)
+		}
+		if syntaxErr.Offset != offset {
+			t.Fatalf("%q: expected offset %d, got %d (%v)", input, offset, syntaxErr.Offset, err)
+		}
+	}
+}
+
 func TestInsaneRoundTrip(t *testing.T) {
 	dep, err := dependency.Parse("foo:armhf <stage1 !cross> [amd64 i386] (>= 1.2:3.4~5.6-7.8~9.0) <!stage1 cross>")
 	isok(t, err)
 
-	assert(t, dep.String() == "foo:armhf [amd64 i386] (>= 1.2:3.4~5.6-7.8~9.0) <stage1 !cross> <!stage1 cross>")
+	assert(t, dep.String() == "foo:armhf (>= 1.2:3.4~5.6-7.8~9.0) [amd64 i386] <stage1 !cross> <!stage1 cross>")
 
 	rtDep, err := dependency.Parse(dep.String())
 	isok(t, err)
 	assert(t, dep.String() == rtDep.String())
 
 	dep.Relations[0].Possibilities[0].Architectures.Not = true
-	assert(t, dep.String() == "foo:armhf [!amd64 !i386] (>= 1.2:3.4~5.6-7.8~9.0) <stage1 !cross> <!stage1 cross>")
+	assert(t, dep.String() == "foo:armhf (>= 1.2:3.4~5.6-7.8~9.0) [!amd64 !i386] <stage1 !cross> <!stage1 cross>")
 
 	rtDep, err = dependency.Parse(dep.String())
 	isok(t, err)
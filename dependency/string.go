@@ -30,17 +30,25 @@ func (a Arch) MarshalControl() (string, error) {
 
 func (a Arch) String() string {
 	/* ABI-OS-CPU -- gnu-linux-amd64 */
-	els := []string{}
-	if a.ABI != "any" && a.ABI != "all" && a.ABI != "gnu" && a.ABI != "" {
-		els = append(els, a.ABI)
+	f := a.folded()
+	switch {
+	case f.CPU == "all":
+		return "all"
+	case a.IsSource():
+		return "source"
+	case f.ABI == "any" && f.OS == "any" && f.CPU == "any":
+		return "any"
+	case f.ABI == "gnu" && f.OS == "linux" && f.CPU != "any":
+		return a.CPU
+	case f.ABI == "gnu" && f.OS != "any" && f.CPU != "any":
+		return a.OS + "-" + a.CPU
+	case f.ABI == "any" && (f.OS == "any" || f.CPU == "any"):
+		/* linux-any and any-amd64 parse with any for the ABI */
+		return a.OS + "-" + a.CPU
+	case a.ABI == "" && a.OS == "":
+		return a.CPU
 	}
-
-	if a.OS != "any" && a.OS != "all" && a.OS != "linux" {
-		els = append(els, a.OS)
-	}
-
-	els = append(els, a.CPU)
-	return strings.Join(els, "-")
+	return strings.Join([]string{a.ABI, a.OS, a.CPU}, "-")
 }
 
 func (set ArchSet) String() string {
@@ -81,18 +89,23 @@ func (stageSet StageSet) String() string {
 }
 
 func (possi Possibility) String() string {
+	if possi.Substvar {
+		return "${" + possi.Name + "}"
+	}
 	str := possi.Name
-	if possi.Arch != nil {
+	if possi.ArchQualifier != "" {
+		str += ":" + possi.ArchQualifier
+	} else if possi.Arch != nil {
 		str += ":" + possi.Arch.String()
 	}
+	if possi.Version != nil {
+		str += " " + possi.Version.String()
+	}
 	if possi.Architectures != nil {
 		if arch := possi.Architectures.String(); arch != "" {
 			str += " " + arch
 		}
 	}
-	if possi.Version != nil {
-		str += " " + possi.Version.String()
-	}
 	for _, stageSet := range possi.StageSets {
 		if stages := stageSet.String(); stages != "" {
 			str += " " + stages
@@ -117,4 +130,21 @@ func (dependency Dependency) String() string {
 	return strings.Join(relations, ", ")
 }
 
+// MarshalWrapped returns the Dependency with each Relation on its own line,
+// each followed by a comma, the way wrap-and-sort writes debian/control:
+//
+//   Build-Depends:
+//    debhelper-compat (= 13),
+//    python3-sphinx <!nocheck>,
+//
+// The value starts with a newline, so that when it's used as the value of
+// a Paragraph field, the first Relation goes on the line after the key.
+func (dependency Dependency) MarshalWrapped() string {
+	str := ""
+	for _, relation := range dependency.Relations {
+		str += "\n" + relation.String() + ","
+	}
+	return str
+}
+
 // vim: foldmethod=marker
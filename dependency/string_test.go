@@ -42,4 +42,42 @@ func TestArchString(t *testing.T) {
 	}
 }
 
+func TestArchWildcardString(t *testing.T) {
+	for _, el := range []string{
+		"linux-any", "any-amd64", "kfreebsd-any", "kfreebsd-amd64",
+		"musl-linux-any", "musl-linux-amd64", "any-linux-amd64",
+	} {
+		arch, err := dependency.ParseArch(el)
+		isok(t, err)
+		assert(t, arch.String() == el)
+	}
+}
+
+func TestPossibilityString(t *testing.T) {
+	dep, err := dependency.Parse("foo:any (>= 1.0) [linux-any !hurd-any] <!nocheck> <stage1 cross>")
+	notok(t, err)
+
+	dep, err = dependency.Parse("foo:any (>= 1.0) [linux-any any-i386] <!nocheck> <stage1 cross>")
+	isok(t, err)
+	assert(t, dep.String() == "foo:any (>= 1.0) [linux-any any-i386] <!nocheck> <stage1 cross>")
+}
+
+func TestMarshalWrapped(t *testing.T) {
+	dep, err := dependency.Parse("debhelper-compat (= 13), foo:native [linux-any] | bar, libbaz-dev (>= 2.0) [!hurd-any] <!nocheck>, python3-sphinx <!nocheck>")
+	isok(t, err)
+
+	wrapped := dep.MarshalWrapped()
+	assert(t, wrapped == `
+debhelper-compat (= 13),
+foo:native [linux-any] | bar,
+libbaz-dev (>= 2.0) [!hurd-any] <!nocheck>,
+python3-sphinx <!nocheck>,`)
+
+	rtDep, err := dependency.Parse(wrapped)
+	isok(t, err)
+	assert(t, rtDep.String() == dep.String())
+
+	assert(t, dependency.Dependency{}.MarshalWrapped() == "")
+}
+
 // vim: foldmethod=marker
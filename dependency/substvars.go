@@ -0,0 +1,125 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Substvars maps the names of substitution variables, such as
+// `misc:Depends` or `shlibs:Depends`, to the value they expand to, in the
+// same way as a debian/substvars file.
+type Substvars map[string]string
+
+// Mark the named substvar as optional, so that Substitute won't complain
+// if it was never set. An optional substvar that isn't set expands to
+// nothing.
+func (sv Substvars) Optional(name string) {
+	if _, ok := sv[name]; !ok {
+		sv[name] = ""
+	}
+}
+
+// Parse a debian/substvars file, which has one `name=value` assignment per
+// line. Lines using `name?=value` mark the substvar as optional, the same
+// as dpkg-gencontrol does (see Substvars.Optional), and lines starting with
+// `#` are ignored.
+func ParseSubstvars(reader io.Reader) (Substvars, error) {
+	ret := Substvars{}
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		assignment := strings.SplitN(text, "=", 2)
+		if len(assignment) != 2 {
+			return nil, fmt.Errorf("Line %d of substvars isn't an assignment: %s", line, text)
+		}
+		name := strings.TrimSpace(assignment[0])
+		value := strings.TrimSpace(assignment[1])
+		if strings.HasSuffix(name, "?") {
+			name = strings.TrimSpace(strings.TrimSuffix(name, "?"))
+			ret.Optional(name)
+			if value == "" {
+				continue
+			}
+		}
+		ret[name] = value
+	}
+	return ret, scanner.Err()
+}
+
+// Replace each `${name}` in the string with the value it has in the
+// Substvars.
+func (sv Substvars) expand(str string) (string, error) {
+	ret := ""
+	for {
+		start := strings.Index(str, "${")
+		if start < 0 {
+			return ret + str, nil
+		}
+		end := strings.Index(str[start:], "}")
+		if end < 0 {
+			return "", fmt.Errorf("Unbalanced '${' without a '}': %s", str[start:])
+		}
+		name := str[start+2 : start+end]
+		value, ok := sv[name]
+		if !ok {
+			return "", fmt.Errorf("Unknown substvar: ${%s}", name)
+		}
+		ret += str[:start] + strings.TrimSpace(value)
+		str = str[start+end+1:]
+	}
+}
+
+// Expand each `${name}` in the relations of the Dependency, such as a
+// whole `${shlibs:Depends}` or the version in `foo (= ${binary:Version})`,
+// with the value it has in the Substvars, and parse the resulting relation
+// string. Any substvar without a value is an error, unless it was marked
+// as optional (see Substvars.Optional), in which case it expands to
+// nothing.
+func (dep Dependency) Substitute(sv Substvars) (Dependency, error) {
+	relations := []string{}
+	for _, relation := range dep.Relations {
+		expanded, err := sv.expand(relation.String())
+		if err != nil {
+			return Dependency{}, err
+		}
+		/* A Relation made up only of empty substvars goes away */
+		if strings.Trim(expanded, " |") != "" {
+			relations = append(relations, expanded)
+		}
+	}
+
+	ret, err := Parse(strings.Join(relations, ", "))
+	if err != nil {
+		return Dependency{}, err
+	}
+	return *ret, nil
+}
+
+// vim: foldmethod=marker
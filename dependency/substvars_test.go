@@ -0,0 +1,97 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cinello/go-debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestParseSubstvars(t *testing.T) {
+	sv, err := dependency.ParseSubstvars(strings.NewReader(`# generated
+shlibs:Depends=libc6 (>= 2.31), libfoo1
+misc:Depends=
+misc:Pre-Depends?=dpkg (>= 1.19)
+misc:Recommends?=
+`))
+	isok(t, err)
+	assert(t, len(sv) == 4)
+	assert(t, sv["shlibs:Depends"] == "libc6 (>= 2.31), libfoo1")
+	assert(t, sv["misc:Depends"] == "")
+	assert(t, sv["misc:Pre-Depends"] == "dpkg (>= 1.19)")
+	assert(t, sv["misc:Recommends"] == "")
+
+	_, err = dependency.ParseSubstvars(strings.NewReader("shlibs:Depends\n"))
+	notok(t, err)
+}
+
+func TestSubstitute(t *testing.T) {
+	dep, err := dependency.Parse("${shlibs:Depends}, ${misc:Depends}, bar | ${alt}, baz")
+	isok(t, err)
+	assert(t, dep.String() == "${shlibs:Depends}, ${misc:Depends}, bar | ${alt}, baz")
+
+	sv := dependency.Substvars{
+		"shlibs:Depends": "libc6 (>= 2.31), libfoo1",
+		"misc:Depends":   "",
+		"alt":            "quux (>> 1.0)",
+	}
+	expanded, err := dep.Substitute(sv)
+	isok(t, err)
+	assert(t, expanded.String() == "libc6 (>= 2.31), libfoo1, bar | quux (>> 1.0), baz")
+	assert(t, len(expanded.GetSubstvars()) == 0)
+
+	delete(sv, "alt")
+	_, err = dep.Substitute(sv)
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "${alt}"))
+
+	sv.Optional("alt")
+	expanded, err = dep.Substitute(sv)
+	isok(t, err)
+	assert(t, expanded.String() == "libc6 (>= 2.31), libfoo1, bar, baz")
+
+	sv.Optional("shlibs:Depends")
+	assert(t, sv["shlibs:Depends"] == "libc6 (>= 2.31), libfoo1")
+}
+
+func TestSubstituteVersion(t *testing.T) {
+	dep, err := dependency.Parse("libfoo (= ${binary:Version}), bar, ${misc:Depends}")
+	isok(t, err)
+
+	sv := dependency.Substvars{"binary:Version": "1.0-1"}
+	sv.Optional("misc:Depends")
+	expanded, err := dep.Substitute(sv)
+	isok(t, err)
+	assert(t, expanded.String() == "libfoo (= 1.0-1), bar")
+	assert(t, expanded.Relations[0].Possibilities[0].Version.Number == "1.0-1")
+
+	_, err = dep.Substitute(dependency.Substvars{})
+	notok(t, err)
+	assert(t, strings.Contains(err.Error(), "${binary:Version}"))
+}
+
+// vim: foldmethod=marker
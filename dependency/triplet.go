@@ -0,0 +1,147 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The GNU CPU names of each Debian CPU, from dpkg's cputable.
+var gnuCPUs = map[string]string{
+	"alpha":    "alpha",
+	"amd64":    "x86_64",
+	"arm64":    "aarch64",
+	"armel":    "arm",
+	"armhf":    "arm",
+	"hppa":     "hppa",
+	"i386":     "i686",
+	"ia64":     "ia64",
+	"loong64":  "loongarch64",
+	"m68k":     "m68k",
+	"mips64el": "mips64el",
+	"mipsel":   "mipsel",
+	"powerpc":  "powerpc",
+	"ppc64":    "powerpc64",
+	"ppc64el":  "powerpc64le",
+	"riscv64":  "riscv64",
+	"s390x":    "s390x",
+	"sh4":      "sh4",
+	"sparc64":  "sparc64",
+	"x32":      "x86_64",
+}
+
+// Debian CPUs that share a GNU CPU name with another, and are told apart by
+// a suffix on the ABI part of the GNU system name instead, such as the
+// `eabihf` in `arm-linux-gnueabihf`.
+var gnuABISuffixes = map[string]string{
+	"armel":    "eabi",
+	"armhf":    "eabihf",
+	"mips64el": "abi64",
+	"x32":      "x32",
+}
+
+// The GNU system names of each Debian ABI and OS pair, from dpkg's ostable.
+var gnuSystems = map[[2]string]string{
+	{"gnu", "linux"}:    "linux-gnu",
+	{"musl", "linux"}:   "linux-musl",
+	{"gnu", "kfreebsd"}: "kfreebsd-gnu",
+	{"gnu", "hurd"}:     "gnu",
+}
+
+// Return the GNU system name for the given Debian ABI, OS and CPU, such as
+// `linux-gnueabihf`.
+func gnuSystem(abi, os, cpu string) (string, bool) {
+	system, ok := gnuSystems[[2]string{abi, os}]
+	if !ok {
+		return "", false
+	}
+	if os == "linux" {
+		system += gnuABISuffixes[cpu]
+	}
+	return system, true
+}
+
+// Return the GNU triplet for the architecture, as used by autotools and
+// cross compilers, such as `x86_64-linux-gnu` for amd64, or
+// `arm-linux-gnueabihf` for armhf. Wildcards and `all` have no triplet.
+func (arch Arch) GNUTriplet() (string, error) {
+	if arch.IsWildcard() || arch.IsAll() {
+		return "", fmt.Errorf("Architecture '%s' has no GNU triplet", arch)
+	}
+	folded := arch.folded()
+	cpu, ok := gnuCPUs[folded.CPU]
+	if !ok {
+		return "", fmt.Errorf("Unknown CPU '%s' in architecture '%s'", arch.CPU, arch)
+	}
+	system, ok := gnuSystem(folded.ABI, folded.OS, folded.CPU)
+	if !ok {
+		return "", fmt.Errorf("Unknown system in architecture '%s'", arch)
+	}
+	return cpu + "-" + system, nil
+}
+
+// Parse a GNU triplet such as `x86_64-linux-gnu` (or a quadruplet with a
+// vendor, such as `x86_64-pc-linux-gnu`) into the Debian architecture it
+// is the triplet of, amd64 in this case. Any of i386 through i686 are
+// accepted as the CPU of i386.
+func ParseArchTriplet(triplet string) (Arch, error) {
+	parts := strings.Split(triplet, "-")
+	switch {
+	case len(parts) == 4:
+		parts = append(parts[:1], parts[2:]...)
+	case len(parts) == 3 && (parts[1] == "pc" || parts[1] == "unknown"):
+		parts = append(parts[:1], parts[2:]...)
+	}
+	if len(parts) < 2 {
+		return Arch{}, fmt.Errorf("Malformed GNU triplet: '%s'", triplet)
+	}
+
+	cpu := parts[0]
+	switch cpu {
+	case "i386", "i486", "i586", "i686":
+		cpu = "i686"
+	}
+	system := strings.Join(parts[1:], "-")
+
+	/* Walk the tables in a stable order, since x86_64 is the CPU of both
+	 * amd64 and x32 (told apart by the system) */
+	debianCPUs := []string{}
+	for name := range gnuCPUs {
+		debianCPUs = append(debianCPUs, name)
+	}
+	sort.Strings(debianCPUs)
+
+	for key := range gnuSystems {
+		for _, name := range debianCPUs {
+			if gnuCPUs[name] != cpu {
+				continue
+			}
+			if expected, _ := gnuSystem(key[0], key[1], name); expected == system {
+				return Arch{ABI: key[0], OS: key[1], CPU: name}, nil
+			}
+		}
+	}
+	return Arch{}, fmt.Errorf("Unknown GNU triplet: '%s'", triplet)
+}
+
+// vim: foldmethod=marker
@@ -0,0 +1,87 @@
+/* {{{ Copyright (c) Paul R. Tagliamonte <paultag@debian.org>, 2015
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in
+ * all copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+ * THE SOFTWARE. }}} */
+
+package dependency_test
+
+import (
+	"testing"
+
+	"github.com/cinello/go-debian/dependency"
+)
+
+/*
+ *
+ */
+
+func TestGNUTripletRoundTrip(t *testing.T) {
+	for name, triplet := range map[string]string{
+		"amd64":            "x86_64-linux-gnu",
+		"arm64":            "aarch64-linux-gnu",
+		"i386":             "i686-linux-gnu",
+		"armhf":            "arm-linux-gnueabihf",
+		"armel":            "arm-linux-gnueabi",
+		"x32":              "x86_64-linux-gnux32",
+		"ppc64el":          "powerpc64le-linux-gnu",
+		"mips64el":         "mips64el-linux-gnuabi64",
+		"kfreebsd-amd64":   "x86_64-kfreebsd-gnu",
+		"hurd-i386":        "i686-gnu",
+		"musl-linux-amd64": "x86_64-linux-musl",
+	} {
+		arch, err := dependency.ParseArch(name)
+		isok(t, err)
+
+		got, err := arch.GNUTriplet()
+		isok(t, err)
+		assert(t, got == triplet)
+
+		parsed, err := dependency.ParseArchTriplet(triplet)
+		isok(t, err)
+		assert(t, parsed == *arch)
+		assert(t, parsed.String() == name)
+	}
+}
+
+func TestParseArchTriplet(t *testing.T) {
+	arch, err := dependency.ParseArchTriplet("x86_64-pc-linux-gnu")
+	isok(t, err)
+	assert(t, arch.String() == "amd64")
+
+	arch, err = dependency.ParseArchTriplet("i386-linux-gnu")
+	isok(t, err)
+	assert(t, arch.String() == "i386")
+
+	arch, err = dependency.ParseArchTriplet("i586-pc-gnu")
+	isok(t, err)
+	assert(t, arch.String() == "hurd-i386")
+
+	for _, bad := range []string{"x86_64", "x86_64-apple-darwin", "vax-linux-gnu"} {
+		_, err := dependency.ParseArchTriplet(bad)
+		notok(t, err)
+	}
+
+	for _, name := range []string{"any", "linux-any", "all"} {
+		arch, err := dependency.ParseArch(name)
+		isok(t, err)
+		_, err = arch.GNUTriplet()
+		notok(t, err)
+	}
+}
+
+// vim: foldmethod=marker
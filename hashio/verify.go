@@ -0,0 +1,58 @@
+package hashio
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+type verifyReader struct {
+	reader io.Reader
+	hasher *Hasher
+	want   []byte
+	size   int64
+}
+
+// NewVerifyReader wraps the given Reader, hashing the data as it's read
+// with the named algorithm. Once the underlying Reader is exhausted, the
+// final Read returns an error instead of io.EOF if the size or the hex
+// encoded hash of the data doesn't match what was expected. Reading more
+// than the expected size fails right away.
+func NewVerifyReader(target io.Reader, algorithm, hash string, size int64) (io.Reader, error) {
+	hasher, err := NewHasher(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	want, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyReader{
+		reader: target,
+		hasher: hasher,
+		want:   want,
+		size:   size,
+	}, nil
+}
+
+func (v *verifyReader) Read(p []byte) (int, error) {
+	n, err := v.reader.Read(p)
+	v.hasher.Write(p[:n])
+
+	if v.hasher.Size() > v.size {
+		return n, fmt.Errorf("Size mismatch: expected %d bytes, got more", v.size)
+	}
+
+	if err != io.EOF {
+		return n, err
+	}
+
+	if v.hasher.Size() != v.size {
+		return n, fmt.Errorf("Size mismatch: expected %d bytes, got %d", v.size, v.hasher.Size())
+	}
+	if got := v.hasher.Sum(nil); !bytes.Equal(got, v.want) {
+		return n, fmt.Errorf("%s mismatch: expected %x, got %x", v.hasher.Name(), v.want, got)
+	}
+	return n, io.EOF
+}
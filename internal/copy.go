@@ -1,26 +1,112 @@
 package internal
 
 import (
+	"context"
 	"io"
 	"os"
+	"syscall"
 )
 
 func Copy(source, dest string) error {
+	return CopyPreserving(source, dest, false)
+}
+
+/* CopyPreserving copies source to dest, carrying over the permission bits
+ * of the source file. If preserveTimes is set, the access and modification
+ * times are carried over as well. */
+func CopyPreserving(source, dest string, preserveTimes bool) error {
+	return CopyContext(context.Background(), source, dest, preserveTimes)
+}
+
+/* contextReader fails reads once its context has been cancelled, so that
+ * io.Copy returns promptly. */
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+/* ContextReader wraps r in a contextReader, for reading loops outside of
+ * this package that need to stop when ctx is cancelled. */
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return contextReader{ctx: ctx, r: r}
+}
+
+/* CopyContext is CopyPreserving, checking ctx during the copy. If the copy
+ * fails or is cancelled, the partially written dest is removed. */
+func CopyContext(ctx context.Context, source, dest string, preserveTimes bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	in, err := os.Open(source)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	out, err := os.Create(dest)
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
 	defer out.Close()
-	_, err = io.Copy(out, in)
+	_, err = io.Copy(out, contextReader{ctx: ctx, r: in})
 	cerr := out.Close()
+	if err == nil {
+		err = cerr
+	}
 	if err != nil {
+		os.Remove(dest)
+		return err
+	}
+
+	/* The umask applies on create, and an existing dest keeps its old
+	 * mode, so set the bits explicitly. */
+	if err := os.Chmod(dest, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if preserveTimes {
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+/* Move renames source to dest. Renames can't cross filesystems, so fall
+ * back to copying (preserving mode and times) and removing the source in
+ * that case. */
+func Move(source, dest string) error {
+	return MoveContext(context.Background(), source, dest)
+}
+
+/* MoveContext is Move, checking ctx before the rename and during any
+ * fallback copy. */
+func MoveContext(ctx context.Context, source, dest string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := os.Rename(source, dest)
+	if err == nil {
+		return nil
+	}
+
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	if err := CopyContext(ctx, source, dest, true); err != nil {
 		return err
 	}
-	return cerr
+	return os.Remove(source)
 }
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func Link(source, dest string) error {
+	err := os.Link(source, dest)
+	if err == nil {
+		return nil
+	}
+
+	/* Hardlinks can't cross filesystems, so fall back to a symlink in
+	 * that case. */
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+
+	source, err = filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(source, dest)
+}
@@ -0,0 +1,94 @@
+//go:build go1.18
+// +build go1.18
+
+/* {{{ Copyright © 2012 Michael Stapelberg and contributors
+ * All rights reserved.
+ *
+ * Redistribution and use in source and binary forms, with or without
+ * modification, are permitted provided that the following conditions are met:
+ *
+ *     * Redistributions of source code must retain the above copyright
+ *       notice, this list of conditions and the following disclaimer.
+ *
+ *     * Redistributions in binary form must reproduce the above copyright
+ *       notice, this list of conditions and the following disclaimer in the
+ *       documentation and/or other materials provided with the distribution.
+ *
+ *     * Neither the name of Michael Stapelberg nor the
+ *       names of contributors may be used to endorse or promote products
+ *       derived from this software without specific prior written permission.
+ *
+ * THIS SOFTWARE IS PROVIDED BY Michael Stapelberg ''AS IS'' AND ANY
+ * EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+ * WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+ * DISCLAIMED. IN NO EVENT SHALL Michael Stapelberg BE LIABLE FOR ANY
+ * DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+ * (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+ * LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+ * ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+ * (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+ * SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE. }}} */
+
+package version
+
+import (
+	"testing"
+)
+
+// Check that Compare is a total order over whatever versions Parse accepts,
+// and that String gives back a version that compares as equal. The seed
+// corpus is made up of the examples from Debian policy, and the usual
+// suspects: tildes, empty revisions, and hyphens or colons in the upstream
+// version.
+func FuzzCompare(f *testing.F) {
+	for _, seed := range [][3]string{
+		{"1.0~rc1", "1.0", "1.0+b1"},
+		{"~~", "~~a", "~"},
+		{"~", "", "a"},
+		{"1.0-1", "1.0-", "1.0"},
+		{"1:1.0", "0:1.0", "1.0"},
+		{"1.0-2-3", "1.0-2", "1.0-2-"},
+		{"1:2:3-4", "0:2:3", "2:3"},
+		{"1.0a", "1.0.", "1.0+"},
+		{"1.001", "1.1", "1.01"},
+		{"2.0", "10.0", "9.99"},
+		{"1.0~bpo10+1", "1.0~~", "1.0~"},
+	} {
+		f.Add(seed[0], seed[1], seed[2])
+	}
+
+	f.Fuzz(func(t *testing.T, a, b, c string) {
+		va, erra := Parse(a)
+		vb, errb := Parse(b)
+		vc, errc := Parse(c)
+		if erra != nil || errb != nil || errc != nil {
+			return
+		}
+
+		if Compare(va, va) != 0 {
+			t.Errorf("%q doesn't compare equal to itself", a)
+		}
+		if Compare(va, vb) != -Compare(vb, va) {
+			t.Errorf("Comparing %q and %q isn't antisymmetric", a, b)
+		}
+		if Compare(va, vb) <= 0 && Compare(vb, vc) <= 0 && Compare(va, vc) > 0 {
+			t.Errorf("Comparing %q, %q and %q isn't transitive", a, b, c)
+		}
+
+		for _, v := range []Version{va, vb, vc} {
+			if v.Empty() {
+				/* Parsed from "-", but written out as "" */
+				continue
+			}
+			again, err := Parse(v.String())
+			if err != nil {
+				t.Fatalf("%q (from %#v) doesn't parse: %s", v, v, err)
+			}
+			if again != v || Compare(again, v) != 0 {
+				t.Errorf("%q didn't round trip: %#v != %#v", v, again, v)
+			}
+		}
+	})
+}
+
+// vim:ts=4:sw=4:noexpandtab foldmethod=marker
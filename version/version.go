@@ -32,6 +32,7 @@ package version
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -52,6 +53,28 @@ func (a Slice) Less(i, j int) bool {
 	return Compare(a[i], a[j]) < 0
 }
 
+// ByVersion sorts the same way as Slice, reading a bit more naturally as
+// `sort.Sort(version.ByVersion(vs))`.
+type ByVersion []Version
+
+func (a ByVersion) Len() int {
+	return len(a)
+}
+
+func (a ByVersion) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a ByVersion) Less(i, j int) bool {
+	return Compare(a[i], a[j]) < 0
+}
+
+// Sort sorts the given versions in place, oldest first. Versions that
+// compare as equal keep their order.
+func Sort(versions []Version) {
+	sort.Stable(Slice(versions))
+}
+
 type Version struct {
 	Epoch    uint
 	Version  string
@@ -62,10 +85,113 @@ func (v *Version) Empty() bool {
 	return v.Epoch == 0 && v.Version == "" && v.Revision == ""
 }
 
-func (v *Version) IsNative() bool {
+// IsNative returns true if the version has no Debian revision, as is the
+// case for native packages.
+func (v Version) IsNative() bool {
 	return len(v.Revision) == 0
 }
 
+// HasEpoch returns true if the version has a non-zero epoch. A version
+// written with an explicit "0:" epoch has none, since that's the default.
+func (v Version) HasEpoch() bool {
+	return v.Epoch > 0
+}
+
+// Upstream returns the upstream portion of the version, without the epoch
+// or the Debian revision.
+func (v Version) Upstream() string {
+	return v.Version
+}
+
+// DebianRevision returns the Debian revision of the version, or an empty
+// string for native versions.
+func (v Version) DebianRevision() string {
+	return v.Revision
+}
+
+// WithoutEpoch returns a copy of the version with the epoch removed, as is
+// used in the names of files in the archive.
+func (v Version) WithoutEpoch() Version {
+	v.Epoch = 0
+	return v
+}
+
+// binNMUSuffix returns the index of the "+bN" suffix of s, along with N,
+// or -1 if s doesn't end in one.
+func binNMUSuffix(s string) (int, int) {
+	i := strings.LastIndex(s, "+b")
+	if i < 0 || i+2 == len(s) {
+		return -1, 0
+	}
+	digits := s[i+2:]
+	if digits[0] == '0' {
+		return -1, 0
+	}
+	for _, r := range digits {
+		if !cisdigit(r) {
+			return -1, 0
+		}
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return -1, 0
+	}
+	return i, n
+}
+
+// BinNMU returns the version of the n'th binary-only NMU of this version,
+// by appending "+bN" to the Debian revision (or to the upstream version of
+// native packages), as the buildds do. If the version is already a binNMU,
+// its suffix is replaced rather than stacked.
+//
+// The buildds count binNMUs from 1, and IsBinNMU doesn't treat "+b0" as one,
+// so BinNMU panics if n is less than 1.
+func (v Version) BinNMU(n int) Version {
+	if n < 1 {
+		panic(fmt.Sprintf("version: binNMU number %d is less than 1", n))
+	}
+	v = v.SourceVersion()
+	part := &v.Revision
+	if v.IsNative() {
+		part = &v.Version
+	}
+	*part += "+b" + strconv.Itoa(n)
+	return v
+}
+
+// IsBinNMU returns true along with the binNMU number if the version ends in
+// a "+bN" suffix, as produced by BinNMU.
+func (v Version) IsBinNMU() (bool, int) {
+	part := v.Revision
+	if v.IsNative() {
+		part = v.Version
+	}
+	i, n := binNMUSuffix(part)
+	return i >= 0, n
+}
+
+// SourceVersion returns the version of the source package a binary package
+// of this version was built from, which is the version itself with any
+// binNMU ("+bN") suffix removed, as added by BinNMU. Unlike WithoutEpoch,
+// the epoch is kept.
+func (v Version) SourceVersion() Version {
+	part := &v.Revision
+	if v.IsNative() {
+		part = &v.Version
+	}
+	if i, _ := binNMUSuffix(*part); i >= 0 {
+		*part = (*part)[:i]
+	}
+	return v
+}
+
+// CompareSource compares a and b as Compare does, but ignoring any binNMU
+// suffix, so that "1.2-3+b1" and "1.2-3" compare as equal, since they're
+// built from the same source.
+func CompareSource(a Version, b Version) int {
+	return Compare(a.SourceVersion(), b.SourceVersion())
+}
+
 func (version *Version) UnmarshalControl(data string) error {
 	return parseInto(version, data)
 }
@@ -74,14 +200,23 @@ func (version Version) MarshalControl() (string, error) {
 	return version.String(), nil
 }
 
+// String returns the canonical form of the version, which parses back into
+// the same Version. The epoch is left out when it's 0, even if the version
+// was parsed from a string with an explicit "0:" epoch, since dpkg treats
+// the two as the same version. The one exception is an upstream version
+// that has a colon in it, which needs the "0:" to keep its first part from
+// being taken as the epoch. Likewise, an empty revision is written out as a
+// trailing "-" if the upstream version has a hyphen in it, so that the last
+// part of the upstream version isn't taken as the revision. The zero Version
+// is written out as an empty string.
 func (v Version) String() string {
 	var result string
-	if v.Epoch > 0 {
+	if v.Epoch > 0 || strings.Contains(v.Version, ":") {
 		result = strconv.Itoa(int(v.Epoch)) + ":" + v.Version
 	} else {
 		result = v.Version
 	}
-	if len(v.Revision) > 0 {
+	if len(v.Revision) > 0 || strings.Contains(v.Version, "-") || (v.Version == "" && v.Epoch > 0) {
 		result += "-" + v.Revision
 	}
 	return result
@@ -161,9 +296,9 @@ func verrevcmp(a string, b string) int {
 	return 0
 }
 
-// Compare compares the two provided Debian versions. It returns 0 if a and b
-// are equal, a value < 0 if a is smaller than b and a value > 0 if a is
-// greater than b.
+// Compare compares the two provided Debian versions, using the same rules
+// as dpkg(1). It returns 0 if a and b are equal, -1 if a is smaller than b
+// and 1 if a is greater than b.
 func Compare(a Version, b Version) int {
 	if a.Epoch > b.Epoch {
 		return 1
@@ -173,11 +308,33 @@ func Compare(a Version, b Version) int {
 	}
 
 	rc := verrevcmp(a.Version, b.Version)
-	if rc != 0 {
-		return rc
+	if rc == 0 {
+		rc = verrevcmp(a.Revision, b.Revision)
 	}
 
-	return verrevcmp(a.Revision, b.Revision)
+	switch {
+	case rc < 0:
+		return -1
+	case rc > 0:
+		return 1
+	}
+	return 0
+}
+
+// LessThan returns true if v sorts before o.
+func (v Version) LessThan(o Version) bool {
+	return Compare(v, o) < 0
+}
+
+// GreaterThan returns true if v sorts after o.
+func (v Version) GreaterThan(o Version) bool {
+	return Compare(v, o) > 0
+}
+
+// Equal returns true if v and o compare as equal. Note that this isn't the
+// same as the two being identical, since `1.0` and `1.00` are equal.
+func (v Version) Equal(o Version) bool {
+	return Compare(v, o) == 0
 }
 
 // Parse returns a Version struct filled with the epoch, version and revision
@@ -188,6 +345,116 @@ func Parse(input string) (Version, error) {
 	return result, parseInto(&result, input)
 }
 
+// ParseStrict is like Parse, but also rejects version strings that dpkg(1)
+// would only warn about, and which Debian policy doesn't allow: surrounding
+// whitespace, an epoch that isn't plain digits, an empty upstream version
+// or revision, or a colon in the upstream version. The error names the
+// offending part of the version string, such as the character that isn't
+// allowed, or the upstream version that doesn't start with a digit.
+func ParseStrict(input string) (Version, error) {
+	if input != strings.TrimSpace(input) {
+		return Version{}, fmt.Errorf("version string %q has leading or trailing spaces", input)
+	}
+	if input == "" {
+		return Version{}, fmt.Errorf("version string is empty")
+	}
+
+	upstream := input
+	if colon := strings.Index(input, ":"); colon != -1 {
+		epoch := input[:colon]
+		if epoch == "" || strings.IndexFunc(epoch, func(c rune) bool { return !cisdigit(c) }) != -1 {
+			return Version{}, fmt.Errorf("epoch %q is not a non-negative integer", epoch)
+		}
+		upstream = input[colon+1:]
+	}
+
+	revision := ""
+	if hyphen := strings.LastIndex(upstream, "-"); hyphen != -1 {
+		if hyphen == len(upstream)-1 {
+			return Version{}, fmt.Errorf("revision after %q is empty", strings.TrimSuffix(input, "-"))
+		}
+		revision = upstream[hyphen+1:]
+		upstream = upstream[:hyphen]
+	}
+
+	if upstream == "" {
+		return Version{}, fmt.Errorf("upstream version in %q is empty", input)
+	}
+
+	if !cisdigit(rune(upstream[0])) {
+		return Version{}, fmt.Errorf("upstream version %q does not start with a digit", upstream)
+	}
+
+	if i := strings.IndexFunc(upstream, func(c rune) bool {
+		return !cisdigit(c) && !cisalpha(c) && c != '.' && c != '-' && c != '+' && c != '~'
+	}); i != -1 {
+		return Version{}, fmt.Errorf("invalid character %q in upstream version %q", firstRune(upstream[i:]), upstream)
+	}
+
+	if i := strings.IndexFunc(revision, func(c rune) bool {
+		return !cisdigit(c) && !cisalpha(c) && c != '.' && c != '+' && c != '~'
+	}); i != -1 {
+		return Version{}, fmt.Errorf("invalid character %q in revision %q", firstRune(revision[i:]), revision)
+	}
+
+	return Parse(input)
+}
+
+// Return the first rune of s, as a string.
+func firstRune(s string) string {
+	for _, r := range s {
+		return string(r)
+	}
+	return ""
+}
+
+// ParseStandardsVersion parses the Standards-Version of a package, which is
+// the version of Debian policy it complies with, such as "4.6.2" (or
+// "4.6.2.0"). Unlike Parse, this only accepts three or four dot separated
+// numbers, without an epoch or revision.
+func ParseStandardsVersion(input string) (Version, error) {
+	trimmed := strings.TrimSpace(input)
+	if trimmed == "" {
+		return Version{}, fmt.Errorf("standards version is empty")
+	}
+	components := strings.Split(trimmed, ".")
+	if len(components) < 3 || len(components) > 4 {
+		return Version{}, fmt.Errorf("standards version %q does not have 3 or 4 components", trimmed)
+	}
+	for _, component := range components {
+		if component == "" || strings.IndexFunc(component, func(c rune) bool { return !cisdigit(c) }) != -1 {
+			return Version{}, fmt.Errorf("invalid component %q in standards version %q", component, trimmed)
+		}
+	}
+	return Version{Version: trimmed}, nil
+}
+
+// Behind returns how many of the four components of a policy version (as
+// returned by ParseStandardsVersion) differ between v and other, when v is
+// older than other, or 0 if v is the same as other or newer. A missing
+// fourth component counts as 0, so "4.6.2" is 1 behind "4.6.2.1", and 2
+// behind "4.7.0".
+func (v Version) Behind(other Version) int {
+	if Compare(v, other) >= 0 {
+		return 0
+	}
+	components := func(v Version) []string {
+		ret := strings.Split(v.Version, ".")
+		for len(ret) < 4 {
+			ret = append(ret, "0")
+		}
+		return ret
+	}
+	ours, theirs := components(v), components(other)
+	ret := 0
+	for i := 0; i < 4; i++ {
+		if verrevcmp(ours[i], theirs[i]) != 0 {
+			ret++
+		}
+	}
+	return ret
+}
+
 func parseInto(result *Version, input string) error {
 	trimmed := strings.TrimSpace(input)
 	if trimmed == "" {
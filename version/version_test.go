@@ -29,6 +29,8 @@
 package version
 
 import (
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -106,6 +108,91 @@ func TestCompareCodesearch(t *testing.T) {
 	}
 }
 
+func TestComparePolicyVectors(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		rc   int
+	}{
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1.0", "1.0+b1", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0", "1.00", 0},
+		{"1.2", "1.10", -1},
+		{"1:0.1", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1.0-1", "1.0-1~bpo1", 1},
+		{"1.0-2", "1.0-10", -1},
+		{"2.0-1", "10.0-1", -1},
+		{"1.0-1", "1.0", 1},
+	} {
+		a, err := Parse(test.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(test.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rc := Compare(a, b); rc != test.rc {
+			t.Errorf("Compare(%q, %q) = %d, want %d", test.a, test.b, rc, test.rc)
+		}
+		if rc := Compare(b, a); rc != -test.rc {
+			t.Errorf("Compare(%q, %q) = %d, want %d", test.b, test.a, rc, -test.rc)
+		}
+		if a.LessThan(b) != (test.rc < 0) || a.GreaterThan(b) != (test.rc > 0) || a.Equal(b) != (test.rc == 0) {
+			t.Errorf("%q and %q wrappers disagree with Compare", test.a, test.b)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	versions := []Version{}
+	for _, el := range []string{"2.0", "1.0~rc1", "1:0.1", "1.00", "1.0", "0:2.0"} {
+		ver, err := Parse(el)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, ver)
+	}
+
+	Sort(versions)
+
+	sorted := []string{}
+	for _, ver := range versions {
+		sorted = append(sorted, ver.String())
+	}
+	if strings.Join(sorted, " ") != "1.0~rc1 1.00 1.0 2.0 2.0 1:0.1" {
+		t.Errorf("Unexpected sort order: %s", sorted)
+	}
+	if versions[2].Version != "1.0" || versions[3].Epoch != 0 {
+		t.Errorf("Sort isn't stable: %v", versions)
+	}
+}
+
+func TestByVersion(t *testing.T) {
+	versions := []Version{}
+	for _, el := range []string{"2.0", "1:0.1", "1.0~rc1", "1.0"} {
+		ver, err := Parse(el)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, ver)
+	}
+
+	sort.Sort(ByVersion(versions))
+
+	sorted := []string{}
+	for _, ver := range versions {
+		sorted = append(sorted, ver.String())
+	}
+	if strings.Join(sorted, " ") != "1.0~rc1 1.0 2.0 1:0.1" {
+		t.Errorf("Unexpected sort order: %s", sorted)
+	}
+}
+
 func TestParseZeroVersions(t *testing.T) {
 	var a Version
 	var err error
@@ -357,4 +444,228 @@ func TestParseInvalidCharactersInRevision(t *testing.T) {
 	}
 }
 
+func TestParseStrict(t *testing.T) {
+	for _, verstr := range []string{"1.0", "1:1.0-1", "0:1.0~rc1+dfsg-1.1~bpo1", "1.0-2-3", "2A.b"} {
+		if _, err := ParseStrict(verstr); err != nil {
+			t.Errorf("Parsing %q failed: %v", verstr, err)
+		}
+	}
+
+	for verstr, offending := range map[string]string{
+		" 1.0":    `" 1.0"`,
+		"+1:1.0":  `"+1"`,
+		"1:1:0-1": `":"`,
+		"1.0-":    `"1.0"`,
+		"1:-1":    `"1:-1"`,
+	} {
+		_, err := ParseStrict(verstr)
+		if err == nil {
+			t.Errorf("Expected an error, but %q was parsed without an error", verstr)
+			continue
+		}
+		if !strings.Contains(err.Error(), offending) {
+			t.Errorf("Error for %q doesn't mention %s: %v", verstr, offending, err)
+		}
+		if _, err := Parse(verstr); err != nil {
+			t.Errorf("Lenient Parse unexpectedly rejected %q: %v", verstr, err)
+		}
+	}
+
+	for verstr, expected := range map[string]string{
+		"1:1:0-1": `invalid character ":" in upstream version "1:0"`,
+		"1.0_1-1": `invalid character "_" in upstream version "1.0_1"`,
+		"1.0-1_1": `invalid character "_" in revision "1_1"`,
+		"1.0-1 2": `invalid character " " in revision "1 2"`,
+		"1:2.0é":  `invalid character "é" in upstream version "2.0é"`,
+		"abc-1":   `upstream version "abc" does not start with a digit`,
+		"1:v2.0":  `upstream version "v2.0" does not start with a digit`,
+	} {
+		_, err := ParseStrict(verstr)
+		if err == nil {
+			t.Errorf("Expected an error, but %q was parsed without an error", verstr)
+		} else if err.Error() != expected {
+			t.Errorf("Unexpected error for %q: %v, expected %s", verstr, err, expected)
+		}
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	v, err := Parse("1:2.30-1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.IsNative() || !v.HasEpoch() {
+		t.Errorf("Expected %q to be non-native with an epoch", v)
+	}
+	if v.Upstream() != "2.30" || v.DebianRevision() != "1.1" {
+		t.Errorf("Unexpected upstream %q or revision %q", v.Upstream(), v.DebianRevision())
+	}
+	if stripped := v.WithoutEpoch(); stripped.String() != "2.30-1.1" || v.Epoch != 1 {
+		t.Errorf("Unexpected WithoutEpoch result %q", stripped)
+	}
+
+	v, err = Parse("0:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsNative() || v.HasEpoch() || v.DebianRevision() != "" {
+		t.Errorf("Expected %q to be native without an epoch", v)
+	}
+}
+
+func TestBinNMU(t *testing.T) {
+	for verstr, expected := range map[string]string{
+		"1.0-1":     "1.0-1+b2",
+		"1:1.0-1":   "1:1.0-1+b2",
+		"1.0-1+b1":  "1.0-1+b2",
+		"1.0":       "1.0+b2",
+		"1.0+b1":    "1.0+b2",
+		"1.0-1+bpo": "1.0-1+bpo+b2",
+	} {
+		v, err := Parse(verstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binnmu := v.BinNMU(2)
+		if binnmu.String() != expected {
+			t.Errorf("BinNMU of %q is %q, expected %q", verstr, binnmu, expected)
+		}
+		if ok, n := binnmu.IsBinNMU(); !ok || n != 2 {
+			t.Errorf("Expected %q to be the 2nd binNMU", binnmu)
+		}
+		if Compare(binnmu, v) <= 0 && !strings.Contains(verstr, "+b1") {
+			t.Errorf("Expected %q to be newer than %q", binnmu, verstr)
+		}
+	}
+
+	for _, verstr := range []string{"1.0-1", "1.0-1+bpo", "1.0-1+b", "1.0-1+b0", "1.0+b1-1"} {
+		v, err := Parse(verstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := v.IsBinNMU(); ok {
+			t.Errorf("Didn't expect %q to be a binNMU", verstr)
+		}
+	}
+}
+
+func TestBinNMUInvalid(t *testing.T) {
+	v, err := Parse("1.0-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected BinNMU(%d) to panic", n)
+				}
+			}()
+			v.BinNMU(n)
+		}()
+	}
+}
+
+func TestSourceVersion(t *testing.T) {
+	for verstr, expected := range map[string]string{
+		"1.2-3+b1":    "1.2-3",
+		"1.2-3":       "1.2-3",
+		"1:1.2-3+b12": "1:1.2-3",
+		"1.2+b1":      "1.2",
+		"1.2+bpo1-3":  "1.2+bpo1-3",
+		"1.2+b1-3":    "1.2+b1-3",
+	} {
+		v, err := Parse(verstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if source := v.SourceVersion(); source.String() != expected {
+			t.Errorf("Source version of %q is %q, expected %q", verstr, source, expected)
+		}
+	}
+
+	binnmu, _ := Parse("1.2-3+b1")
+	source, _ := Parse("1.2-3")
+	newer, _ := Parse("1.2-4")
+	if CompareSource(binnmu, source) != 0 {
+		t.Errorf("Expected %q and %q to be built from the same source", binnmu, source)
+	}
+	if Compare(binnmu, source) <= 0 {
+		t.Errorf("Expected %q to be newer than %q", binnmu, source)
+	}
+	if CompareSource(binnmu, newer) >= 0 || CompareSource(newer, binnmu) <= 0 {
+		t.Errorf("Expected the source of %q to be older than %q", binnmu, newer)
+	}
+}
+
+func TestStandardsVersion(t *testing.T) {
+	current, err := ParseStandardsVersion("4.6.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for verstr, expected := range map[string]int{
+		"4.6.2":   0,
+		"4.6.2.0": 0,
+		"4.7.0":   0,
+		"4.6.1.1": 2,
+		"4.6.1":   1,
+		"4.5.1":   2,
+		"3.9.8":   3,
+		"3.9.8.1": 4,
+	} {
+		v, err := ParseStandardsVersion(verstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if behind := v.Behind(current); behind != expected {
+			t.Errorf("Expected %q to be %d behind %q, got %d", verstr, expected, current, behind)
+		}
+	}
+
+	for _, verstr := range []string{"", "4.6", "4.6.2.0.1", "4.6.x", "4..2", "1:4.6.2", "4.6.2-1"} {
+		if _, err := ParseStandardsVersion(verstr); err == nil {
+			t.Errorf("Expected %q to be rejected as a standards version", verstr)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for verstr, expected := range map[string]string{
+		"1.0":                   "1.0",
+		"1.0-1":                 "1.0-1",
+		"0:1.0-1":               "1.0-1",
+		"0:1.0":                 "1.0",
+		"1:1.0-1":               "1:1.0-1",
+		"0:1:2-3":               "0:1:2-3",
+		"2:1.0~rc1+dfsg.1-0.1":  "2:1.0~rc1+dfsg.1-0.1",
+		"1.0+git20200101.abc~1": "1.0+git20200101.abc~1",
+		"1.0-2-3~bpo10+1":       "1.0-2-3~bpo10+1",
+		"1.0-2-":                "1.0-2-",
+		"  1.0-1  ":             "1.0-1",
+	} {
+		v, err := Parse(verstr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.String() != expected {
+			t.Errorf("String of %q is %q, expected %q", verstr, v, expected)
+		}
+		again, err := Parse(v.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != v {
+			t.Errorf("%q didn't round trip: %#v != %#v", verstr, again, v)
+		}
+	}
+
+	if native := v(0, "1.0+dfsg", ""); !native.IsNative() || native.String() != "1.0+dfsg" {
+		t.Errorf("Unexpected native version %q", native)
+	}
+	if colon := v(0, "1:2", "3"); colon.String() != "0:1:2-3" {
+		t.Errorf("Expected the 0 epoch to be kept for %#v, got %q", colon, colon)
+	}
+}
+
 // vim:ts=4:sw=4:noexpandtab foldmethod=marker